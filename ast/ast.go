@@ -3,6 +3,7 @@ package ast
 import (
 	"Pron-Lang/token"
 	"bytes"
+	"math/big"
 	"strings"
 )
 
@@ -37,9 +38,10 @@ func (p *Program) String() string {
 }
 
 type VarStatement struct {
-	Token token.Token // the token.VAR token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token // the token.VAR or token.CONST token
+	Name    *Identifier
+	Pattern Pattern // set instead of Name by var [a, b] = ... and var {"k": v} = ...
+	Value   Expression
 }
 
 func (ls *VarStatement) statementNode()       {}
@@ -48,7 +50,11 @@ func (ls *VarStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -60,6 +66,9 @@ func (ls *VarStatement) String() string {
 	return out.String()
 }
 
+// IsConstant reports whether the statement declares a constant with const
+func (ls *VarStatement) IsConstant() bool { return ls.Token.Type == token.CONST }
+
 type ClassStatement struct {
 	Token      token.Token // the token.Class token
 	Name       *Identifier
@@ -67,6 +76,8 @@ type ClassStatement struct {
 	Functions  []*DirectFunctionStatement
 	InitParams []*InitParam
 	InitBody   *BlockStatement
+	Locals     []string // slots of the class env, set by the resolver
+	InitLocals []string // slots of the env the Init body runs in, set by the resolver
 }
 
 func (cs *ClassStatement) statementNode()       {}
@@ -76,24 +87,26 @@ func (cs *ClassStatement) String() string {
 
 	fields := []string{}
 	for _, field := range cs.Fields {
-		fields = append(fields, "var "+field.Name.Value+" = "+field.Value.String())
+		fields = append(fields, field.TokenLiteral()+" "+field.Name.Value+" = "+field.Value.String())
 	}
 
 	params := []string{}
 	for _, param := range cs.InitParams {
-		params = append(params, param.Parameter.String())
+		params = append(params, param.Declaration())
 	}
 
 	functions := []string{}
 	for _, function := range cs.Functions {
-		params = append(functions, function.String())
+		functions = append(functions, function.String())
 	}
 
 	out.WriteString("class " + cs.Name.Value + " {")
 	out.WriteString(strings.Join(fields, "\n"))
-	out.WriteString("init(" + strings.Join(params, ", ") + ") {")
-	out.WriteString(cs.InitBody.String())
-	out.WriteString("}")
+	if cs.InitBody != nil {
+		out.WriteString("Init(" + strings.Join(params, ", ") + ") {")
+		out.WriteString(cs.InitBody.String())
+		out.WriteString("}")
+	}
 	out.WriteString(strings.Join(functions, "\n"))
 	out.WriteString("}")
 
@@ -103,20 +116,37 @@ func (cs *ClassStatement) String() string {
 type InitParam struct {
 	Token       token.Token
 	Parameter   *Identifier
-	IsThisParam bool // true if it is a 'this.paramName'
+	IsThisParam bool       // true if it is a 'this.paramName'
+	Default     Expression // the value when the argument is left out, or nil
 }
 
 func (ip *InitParam) expressionNode()      {}
 func (ip *InitParam) TokenLiteral() string { return ip.Token.Literal }
 func (ip *InitParam) String() string       { return ip.Parameter.Value }
 
+// Declaration is the parameter the way it's written in Init: this.a = 1
+func (ip *InitParam) Declaration() string {
+	declaration := ip.Parameter.String()
+	if ip.IsThisParam {
+		declaration = "this." + declaration
+	}
+	if ip.Default != nil {
+		declaration += " = " + ip.Default.String()
+	}
+	return declaration
+}
+
 type Identifier struct {
 	Token         token.Token // the token.IDENT token
 	Value         string
 	HasThisPrefix bool // is prefixed with 'this.'
+	Resolved      bool // true when the resolver has set Depth and Slot
+	Depth         int  // number of environments to walk out to find the variable
+	Slot          int  // index of the variable in that environment
 }
 
 func (i *Identifier) expressionNode()      {}
+func (i *Identifier) patternNode()         {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 func (i *Identifier) String() string       { return i.Value }
 
@@ -129,6 +159,7 @@ func (n *Null) String() string       { return "Null" }
 type ReturnStatement struct {
 	Token       token.Token // the 'return' statement
 	ReturnValue Expression
+	Tail        bool // true when ReturnValue is a call the function ends with, set by the resolver
 }
 
 func (rs *ReturnStatement) statementNode()       {}
@@ -178,6 +209,27 @@ func (i *IntegerLiteral) expressionNode()      {}
 func (i *IntegerLiteral) TokenLiteral() string { return i.Token.Literal }
 func (i *IntegerLiteral) String() string       { return i.Token.Literal }
 
+// BigIntegerLiteral is an integer literal that is too big for an IntegerLiteral
+type BigIntegerLiteral struct {
+	Token token.Token
+	Value *big.Int
+}
+
+func (b *BigIntegerLiteral) expressionNode()      {}
+func (b *BigIntegerLiteral) TokenLiteral() string { return b.Token.Literal }
+func (b *BigIntegerLiteral) String() string       { return b.Token.Literal }
+
+// DecimalLiteral is a literal like 1.10d, which is Coefficient * 10^Exponent
+type DecimalLiteral struct {
+	Token       token.Token
+	Coefficient *big.Int
+	Exponent    int
+}
+
+func (d *DecimalLiteral) expressionNode()      {}
+func (d *DecimalLiteral) TokenLiteral() string { return d.Token.Literal }
+func (d *DecimalLiteral) String() string       { return d.Token.Literal }
+
 type RealLiteral struct {
 	Token token.Token
 	Value float64
@@ -227,6 +279,28 @@ func (ie InfixExpression) String() string {
 	return out.String()
 }
 
+// ConditionalExpression is cond ? a : b
+type ConditionalExpression struct {
+	Token       token.Token // the '?' token
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (ce *ConditionalExpression) expressionNode()      {}
+func (ce *ConditionalExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ConditionalExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ce.Condition.String())
+	out.WriteString(" ? ")
+	out.WriteString(ce.Consequence.String())
+	out.WriteString(" : ")
+	out.WriteString(ce.Alternative.String())
+	out.WriteString(")")
+	return out.String()
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -334,8 +408,12 @@ func (bs *BlockStatement) String() string {
 type FunctionLiteral struct {
 	Token      token.Token //the 'func' token
 	Parameters []*Identifier
+	Defaults   []Expression // the value of each parameter when its argument is left out, or nil
+	Variadic   bool         // the last parameter is ...rest and gets the extra arguments
 	Body       *BlockStatement
 	IsPublic   bool
+	Async      bool     // a call returns a promise, and the body can await
+	Locals     []string // parameters followed by local variables, set by the resolver
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -343,19 +421,37 @@ func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
-	}
+	params := ParameterStrings(fl.Parameters, fl.Defaults, fl.Variadic)
 
+	if fl.Async {
+		out.WriteString("async ")
+	}
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(")")
+	out.WriteString(") {")
+	out.WriteString(fl.Body.String())
+	out.WriteString("}")
 
 	return out.String()
 }
 
+// ParameterStrings are parameters the way they are declared: a, b = 1, ...rest
+func ParameterStrings(parameters []*Identifier, defaults []Expression, variadic bool) []string {
+	params := []string{}
+	for i, p := range parameters {
+		param := p.String()
+		if i < len(defaults) && defaults[i] != nil {
+			param += " = " + defaults[i].String()
+		}
+		if variadic && i == len(parameters)-1 {
+			param = "..." + param
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
 type DirectFunctionStatement struct {
 	Token    token.Token // the 'func' token
 	Name     *Identifier
@@ -368,17 +464,16 @@ func (dfs *DirectFunctionStatement) TokenLiteral() string { return dfs.Token.Lit
 func (dfs *DirectFunctionStatement) String() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range dfs.Function.Parameters {
-		//fmt.Print(p.String())
-		params = append(params, p.String())
-	}
+	params := ParameterStrings(dfs.Function.Parameters, dfs.Function.Defaults, dfs.Function.Variadic)
 
 	exps := []string{}
 	for _, e := range dfs.Function.Body.Statements {
 		exps = append(exps, e.String())
 	}
 
+	if dfs.Function.Async {
+		out.WriteString("async ")
+	}
 	out.WriteString(dfs.TokenLiteral() + " ")
 	out.WriteString(dfs.Name.String())
 	out.WriteString("(")
@@ -415,6 +510,28 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// NamedArgument is an argument that is given to the parameter with its name:
+// connect(host: "x")
+type NamedArgument struct {
+	Token token.Token // the name token
+	Name  *Identifier
+	Value Expression
+}
+
+func (na *NamedArgument) expressionNode()      {}
+func (na *NamedArgument) TokenLiteral() string { return na.Token.Literal }
+func (na *NamedArgument) String() string       { return na.Name.String() + ": " + na.Value.String() }
+
+// SpreadExpression gives the elements of an array as separate arguments: f(...arr)
+type SpreadExpression struct {
+	Token token.Token // the '...' token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -446,10 +563,33 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+type SetLiteral struct {
+	Token    token.Token // the '#{' token
+	Elements []Expression
+}
+
+func (sl *SetLiteral) expressionNode()      {}
+func (sl *SetLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *SetLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range sl.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("#{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
 type IndexExpression struct {
-	Token token.Token //the '[' token
-	Left  Expression  //the object being accessed: myArr[2], returnsArray()[1], etc.
-	Index Expression
+	Token    token.Token //the '[' or '?[' token
+	Left     Expression  //the object being accessed: myArr[2], returnsArray()[1], etc.
+	Index    Expression
+	Optional bool // arr?[i] is null when arr is null
 }
 
 func (ie *IndexExpression) expressionNode()      {}
@@ -458,6 +598,9 @@ func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?")
+	}
 	out.WriteString("[")
 	out.WriteString(ie.Index.String())
 	out.WriteString("])")
@@ -467,6 +610,7 @@ func (ie *IndexExpression) String() string {
 type HashLiteral struct {
 	Token token.Token //The ´{´ token
 	Pairs map[Expression]Expression
+	Keys  []Expression // The keys of Pairs in the order they were written
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -475,8 +619,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -492,6 +636,8 @@ type IncrementForloopExpression struct {
 	From     Expression
 	To       Expression
 	Body     *BlockStatement
+	Locals   []string // LocalVar followed by the variables of Body, set by the resolver
+	Reuse    bool     // Body makes no functions, so the iterations can share a frame. Set by the resolver
 }
 
 func (ic *IncrementForloopExpression) expressionNode()      {}
@@ -517,6 +663,8 @@ type ArrayForloopExpression struct {
 	LocalVar  Expression
 	ArrayName Expression
 	Body      *BlockStatement
+	Locals    []string // LocalVar followed by the variables of Body, set by the resolver
+	Reuse     bool     // Body makes no functions, so the iterations can share a frame. Set by the resolver
 }
 
 func (af *ArrayForloopExpression) expressionNode()      {}
@@ -535,6 +683,139 @@ func (af *ArrayForloopExpression) String() string {
 	return out.String()
 }
 
+// ComprehensionExpression builds an array, [x * x for x in xs if x > 0], or
+// a map, {k: v * 2 for k, v in m}, from the values of Iterable
+type ComprehensionExpression struct {
+	Token     token.Token // the '[' or '{' token
+	Key       Expression  // nil when an array is built
+	Value     Expression
+	Variables []Pattern
+	Binding   Pattern // the pattern each value of Iterable is destructured with
+	Iterable  Expression
+	Condition Expression // nil when there is no 'if'
+	Locals    []string   // the variables, set by the resolver
+}
+
+func (ce *ComprehensionExpression) expressionNode()      {}
+func (ce *ComprehensionExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ComprehensionExpression) String() string {
+	var out bytes.Buffer
+
+	variables := []string{}
+	for _, variable := range ce.Variables {
+		variables = append(variables, variable.String())
+	}
+
+	out.WriteString(ce.Token.Literal)
+	if ce.Key != nil {
+		out.WriteString(ce.Key.String() + ":")
+	}
+	out.WriteString(ce.Value.String())
+	out.WriteString(" for " + strings.Join(variables, ", "))
+	out.WriteString(" in " + ce.Iterable.String())
+	if ce.Condition != nil {
+		out.WriteString(" if " + ce.Condition.String())
+	}
+	if ce.Key != nil {
+		out.WriteString("}")
+	} else {
+		out.WriteString("]")
+	}
+
+	return out.String()
+}
+
+// EnumStatement declares an enum: enum Status { Pending, Running, Done }
+type EnumStatement struct {
+	Token   token.Token // the 'enum' token
+	Name    *Identifier
+	Members []*Identifier
+}
+
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) String() string {
+	members := []string{}
+	for _, member := range es.Members {
+		members = append(members, member.String())
+	}
+	return "enum " + es.Name.String() + " {" + strings.Join(members, ", ") + "}"
+}
+
+// MemberExpression gets a member of an enum: Status.Done
+type MemberExpression struct {
+	Token    token.Token // the '.' or '?.' token
+	Object   *Identifier
+	Member   *Identifier
+	Optional bool
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	return me.Object.String() + me.Token.Literal + me.Member.String()
+}
+
+// SpawnExpression runs a call in a task of its own: spawn f(x)
+type SpawnExpression struct {
+	Token token.Token // the 'spawn' token
+	Call  *CallExpression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) String() string {
+	return se.TokenLiteral() + " " + se.Call.String()
+}
+
+// AwaitExpression waits for a promise or a spawned task: await f(x)
+type AwaitExpression struct {
+	Token token.Token // the 'await' token
+	Value Expression
+}
+
+func (ae *AwaitExpression) expressionNode()      {}
+func (ae *AwaitExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AwaitExpression) String() string {
+	return ae.TokenLiteral() + " " + ae.Value.String()
+}
+
+// MacroLiteral is a function that runs before the program, on the code of its
+// arguments, and returns the code its calls are replaced with:
+// macro(x) { quote(unquote(x) + 1) }
+type MacroLiteral struct {
+	Token    token.Token      // the 'macro' token
+	Function *FunctionLiteral // the parameters and body of the macro
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) String() string       { return ml.Function.String() }
+
+// QuoteExpression is code as a value: quote(x + 1)
+type QuoteExpression struct {
+	Token token.Token // the 'quote' token
+	Node  Expression
+}
+
+func (qe *QuoteExpression) expressionNode()      {}
+func (qe *QuoteExpression) TokenLiteral() string { return qe.Token.Literal }
+func (qe *QuoteExpression) String() string {
+	return qe.TokenLiteral() + "(" + qe.Node.String() + ")"
+}
+
+// UnquoteExpression puts a value into the code of the quote it's in: unquote(x)
+type UnquoteExpression struct {
+	Token token.Token // the 'unquote' token
+	Value Expression
+}
+
+func (ue *UnquoteExpression) expressionNode()      {}
+func (ue *UnquoteExpression) TokenLiteral() string { return ue.Token.Literal }
+func (ue *UnquoteExpression) String() string {
+	return ue.TokenLiteral() + "(" + ue.Value.String() + ")"
+}
+
 type ObjectInitialization struct {
 	Token     token.Token // the 'new' token
 	Name      *Identifier
@@ -559,10 +840,11 @@ func (oi *ObjectInitialization) String() string {
 }
 
 type CallObjectFunction struct {
-	Token        token.Token // the DOT token
+	Token        token.Token // the DOT or OPTIONAL_DOT token
 	ObjectName   *Identifier
 	FunctionName *Identifier
 	Arguments    []Expression
+	Optional     bool // obj?.Method() is null when obj is null
 }
 
 func (cof *CallObjectFunction) expressionNode()      {}
@@ -576,7 +858,7 @@ func (cof *CallObjectFunction) String() string {
 	}
 
 	out.WriteString(cof.ObjectName.String())
-	out.WriteString(".")
+	out.WriteString(cof.Token.Literal)
 	out.WriteString(cof.FunctionName.String())
 	out.WriteString("(")
 	out.WriteString(strings.Join(args, ", "))
@@ -602,3 +884,132 @@ type Decrement struct {
 func (d *Decrement) expressionNode()      {}
 func (d *Decrement) TokenLiteral() string { return d.Token.Literal }
 func (d *Decrement) String() string       { return d.Name.Value + "--" }
+
+// MatchExpression is match (subject) { pattern, pattern if guard => body, ... }
+type MatchExpression struct {
+	Token   token.Token // the 'match' token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") {")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// MatchArm runs Body when one of its patterns matches and Guard, if there is one, is truthy
+type MatchArm struct {
+	Token    token.Token // the '=>' token
+	Patterns []Pattern
+	Guard    Expression
+	Body     *BlockStatement
+}
+
+func (ma *MatchArm) TokenLiteral() string { return ma.Token.Literal }
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	patterns := []string{}
+	for _, pattern := range ma.Patterns {
+		patterns = append(patterns, pattern.String())
+	}
+
+	out.WriteString(strings.Join(patterns, ", "))
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
+// Pattern is what a match arm compares a value with. An identifier binds
+// the value to a variable, except _ which matches anything without binding it
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// LiteralPattern matches a value equal to a literal: 1, -2.5, "a", true
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+
+// ArrayPattern matches an array of the same length whose elements match.
+// With a RestPattern among the elements the array can be longer
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []Pattern
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, elem := range ap.Elements {
+		elements = append(elements, elem.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// RestPattern binds the elements of an array that the other elements of an
+// ArrayPattern don't match: [head, ...tail]
+type RestPattern struct {
+	Token token.Token // the '...' token
+	Name  *Identifier
+}
+
+func (rp *RestPattern) patternNode()         {}
+func (rp *RestPattern) TokenLiteral() string { return rp.Token.Literal }
+func (rp *RestPattern) String() string       { return "..." + rp.Name.String() }
+
+// HashPattern matches a hash that has the keys, with values that match.
+// The hash can have other keys too
+type HashPattern struct {
+	Token  token.Token // the '{' token
+	Keys   []Expression
+	Values []Pattern
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		pairs = append(pairs, key.String()+": "+hp.Values[i].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// TypePattern matches an instance of a class, or a value of a builtin type
+// like int or string, and binds it to Name
+type TypePattern struct {
+	Token    token.Token // the type name token
+	TypeName *Identifier
+	Name     *Identifier
+}
+
+func (tp *TypePattern) patternNode()         {}
+func (tp *TypePattern) TokenLiteral() string { return tp.Token.Literal }
+func (tp *TypePattern) String() string       { return tp.TypeName.String() + " " + tp.Name.String() }
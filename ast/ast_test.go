@@ -26,3 +26,86 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. get=%q", program.String())
 	}
 }
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "2"}, Value: 2} }
+	turnOneIntoTwo := func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok && integer.Value == 1 {
+			return two()
+		}
+		return node
+	}
+
+	tests := []struct {
+		input    Node
+		expected string
+	}{
+		{one(), "2"},
+		{&InfixExpression{Left: one(), Operator: "+", Right: one()}, "(2 + 2)"},
+		{&PrefixExpression{Operator: "-", Right: one()}, "(-2)"},
+		{&ArrayLiteral{Elements: []Expression{one(), two(), one()}}, "[2, 2, 2]"},
+		{&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}}, "2"},
+		{&IfExpression{Condition: one(), Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}}, "if2 2"},
+	}
+
+	for _, tt := range tests {
+		before := tt.input.String()
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if modified.String() != tt.expected {
+			t.Errorf("wrong modified node for %q. expected=%q, got=%q", before, tt.expected, modified.String())
+		}
+		if tt.input.String() != before {
+			t.Errorf("Modify changed the node. expected=%q, got=%q", before, tt.input.String())
+		}
+	}
+}
+
+func TestModifyScoped(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1} }
+	node := &InfixExpression{Left: one(), Operator: "+", Right: &PrefixExpression{Operator: "-", Right: one()}}
+
+	depth := 0
+	enter := func(Node) func() {
+		depth++
+		return func() { depth-- }
+	}
+	depths := []int{}
+	ModifyScoped(node, enter, func(node Node) Node {
+		if _, ok := node.(*IntegerLiteral); ok {
+			depths = append(depths, depth)
+		}
+		return node
+	})
+
+	if len(depths) != 2 || depths[0] != 2 || depths[1] != 3 {
+		t.Errorf("wrong depths of the integers. expected=[2 3], got=%v", depths)
+	}
+	if depth != 0 {
+		t.Errorf("not every node entered was left. depth=%d", depth)
+	}
+}
+
+func TestSetPosition(t *testing.T) {
+	kept := &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Pos: token.Position{Line: 1, Column: 1}}, Value: "x"}
+	node := &InfixExpression{
+		Token:    token.Token{Type: token.PLUS, Literal: "+"},
+		Left:     &Identifier{Token: token.Token{Type: token.IDENT, Literal: "y"}, Value: "y"},
+		Operator: "+",
+		Right:    kept,
+	}
+	pos := token.Position{Line: 3, Column: 7}
+
+	SetPosition(node, pos, func(node Node) bool { return node == kept })
+
+	if node.Token.Pos != pos {
+		t.Errorf("wrong position of the node. expected=%s, got=%s", pos, node.Token.Pos)
+	}
+	if left := node.Left.(*Identifier).Token.Pos; left != pos {
+		t.Errorf("wrong position of the left node. expected=%s, got=%s", pos, left)
+	}
+	if kept.Token.Pos != (token.Position{Line: 1, Column: 1}) {
+		t.Errorf("kept node got a new position %s", kept.Token.Pos)
+	}
+}
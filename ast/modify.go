@@ -0,0 +1,184 @@
+package ast
+
+import (
+	"Pron-Lang/token"
+	"reflect"
+)
+
+// Walk and Modify go through the fields of the nodes with reflection, so they
+// reach every node, pattern and argument without a case for each type
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType = reflect.TypeOf(token.Token{})
+	astPath   = reflect.TypeOf(Program{}).PkgPath()
+
+	expressionType  = reflect.TypeOf((*Expression)(nil)).Elem()
+	hashLiteralType = reflect.TypeOf(HashLiteral{})
+)
+
+// holdsNodes tells whether values of type t can have nodes in them
+func holdsNodes(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		return holdsNodes(t.Elem())
+	case reflect.Map:
+		return holdsNodes(t.Key()) || holdsNodes(t.Elem())
+	case reflect.Interface:
+		return t.Implements(nodeType)
+	case reflect.Struct:
+		return t.PkgPath() == astPath
+	}
+	return false
+}
+
+// Walk calls visit for node and the nodes in it, a node before the nodes in
+// it. When visit returns false the nodes in that node are skipped
+func Walk(node Node, visit func(Node) bool) {
+	walk(reflect.ValueOf(node), visit)
+}
+
+func walk(v reflect.Value, visit func(Node) bool) {
+	if !holdsNodes(v.Type()) {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			walk(v.Elem(), visit)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walk(v.Index(i), visit)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			walk(key, visit)
+			walk(v.MapIndex(key), visit)
+		}
+	case reflect.Struct:
+		// A node is a pointer to the struct, or a struct inside another node
+		if v.CanAddr() {
+			if node, ok := v.Addr().Interface().(Node); ok && !visit(node) {
+				return
+			}
+		}
+		for i := 0; i < v.NumField(); i++ {
+			walk(v.Field(i), visit)
+		}
+	}
+}
+
+// Modify returns a copy of node in which modifier has replaced nodes. It calls
+// modifier with the copy of every node, after the nodes in it, and puts what
+// modifier returns in place of the node when its type fits there. Node itself
+// isn't changed
+func Modify(node Node, modifier func(Node) Node) Node {
+	return ModifyScoped(node, nil, modifier)
+}
+
+// ModifyScoped is Modify, but also calls enter with every node before the
+// nodes in it are modified, and the function enter returns once modifier
+// has had the node. So enter can keep track of the nodes around the one
+// modifier gets, like the names they declare. enter can be nil
+func ModifyScoped(node Node, enter func(Node) func(), modifier func(Node) Node) Node {
+	return modify(reflect.ValueOf(node), nodeType, enter, modifier).Interface().(Node)
+}
+
+// modify returns a copy of v for a place of type want
+func modify(v reflect.Value, want reflect.Type, enter func(Node) func(), modifier func(Node) Node) reflect.Value {
+	if !holdsNodes(v.Type()) {
+		return v
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		return modify(v.Elem(), want, enter, modifier)
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if node, ok := v.Interface().(Node); ok && enter != nil {
+			defer enter(node)()
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(modify(v.Elem(), v.Type().Elem(), enter, modifier))
+
+		if node, ok := copied.Interface().(Node); ok {
+			if replaced := modifier(node); replaced != nil && reflect.TypeOf(replaced).AssignableTo(want) {
+				return reflect.ValueOf(replaced)
+			}
+		}
+		return copied
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(modify(v.Index(i), v.Type().Elem(), enter, modifier))
+		}
+		return copied
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range v.MapKeys() {
+			copied.SetMapIndex(modify(key, v.Type().Key(), enter, modifier), modify(v.MapIndex(key), v.Type().Elem(), enter, modifier))
+		}
+		return copied
+
+	case reflect.Struct:
+		if v.Type() == hashLiteralType {
+			return modifyHash(v, enter, modifier)
+		}
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			copied.Field(i).Set(modify(v.Field(i), v.Type().Field(i).Type, enter, modifier))
+		}
+		return copied
+	}
+	return v
+}
+
+// modifyHash copies a hash literal. Pairs is rebuilt from the copied Keys,
+// since copying the keys of Pairs on their own would make new keys that
+// aren't in Keys
+func modifyHash(v reflect.Value, enter func(Node) func(), modifier func(Node) Node) reflect.Value {
+	hash := v.Interface().(HashLiteral)
+	copied := HashLiteral{Token: hash.Token, Pairs: map[Expression]Expression{}}
+	for _, key := range hash.Keys {
+		newKey := modify(reflect.ValueOf(key), expressionType, enter, modifier).Interface().(Expression)
+		value := modify(reflect.ValueOf(hash.Pairs[key]), expressionType, enter, modifier).Interface().(Expression)
+		copied.Keys = append(copied.Keys, newKey)
+		copied.Pairs[newKey] = value
+	}
+	return reflect.ValueOf(copied)
+}
+
+// SetPosition gives node, and the nodes in it, the position pos. The nodes
+// that keep returns true for keep their positions, and so do the nodes in them
+func SetPosition(node Node, pos token.Position, keep func(Node) bool) {
+	Walk(node, func(node Node) bool {
+		if keep(node) {
+			return false
+		}
+		v := reflect.ValueOf(node)
+		if v.Kind() != reflect.Ptr {
+			return true
+		}
+		if tok := v.Elem().FieldByName("Token"); tok.IsValid() && tok.Type() == tokenType {
+			tok.FieldByName("Pos").Set(reflect.ValueOf(pos))
+		}
+		return true
+	})
+}
@@ -0,0 +1,290 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // push constant
+	OpPop                    // discard the top of the stack
+	OpNull                   // push null
+	OpNil                    // push the result of a statement without a value
+	OpTrue
+	OpFalse
+
+	// Operators. Integers are handled by the vm, everything else by the evaluator
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpInfix // operator without its own opcode, the operand is the operator constant
+	OpMinus
+	OpBang
+	OpPrefix // operator without its own opcode, the operand is the operator constant
+	OpIndex
+
+	OpJump
+	OpJumpNotTruthy
+	OpJumpNull // jump when the top of the stack is null, which stays on the stack
+	OpRaise    // stop the program with the error on the top of the stack
+
+	// Variables resolved to a (depth, slot) pair. The name is kept for error messages
+	OpGetVar
+	OpSetVar
+	OpDefine
+	OpDefineConstant
+	OpIncrement
+	OpDecrement
+
+	// Variables the resolver couldn't place, e.g. builtins
+	OpGetName
+	OpSetName
+	OpDefineName
+	OpDefineConstantName
+
+	OpArray
+	OpHash
+	OpSet
+
+	OpClosure
+	OpCall
+	OpReturnValue
+
+	// Forloops
+	OpRangeFrom   // check the 'from' value
+	OpRangeTo     // check the 'to' value and replace both with an iterator
+	OpIterStart   // replace an array with an iterator
+	OpLoopBegin   // push the env of the loop and the loop result
+	OpLoopNext    // bind the next value or jump to the end of the loop
+	OpLoopBreak   // 'return' inside a loop ends the loop with a value
+	OpLoopEnd     // leave only the result of the loop on the stack
+	OpClass       // run the class body in a new env
+	OpMakeClass   // turn the env of the class body into a class
+	OpLoadClass   // push a class, or load it from its file
+	OpNew         // create an instance and run Init
+	OpGetMethod   // replace an instance with one of its public methods
+	OpGetMember   // replace an enum with one of its members
+	OpMatch       // push whether the value on the stack matches the patterns constant, and bind its variables
+	OpNoMatch     // stop the program, since no arm matched the value on the stack
+	OpDestructure // pop a value and bind the variables of the pattern constant to its parts
+	OpArguments   // pack the values of the call arguments constant into one value for a call
+
+	// Comprehensions
+	OpIterRows  // replace an array, hash or set with an iterator over the rows of a comprehension
+	OpLoopValue // push the next value or jump to the end of the loop
+	OpCollect   // add the value, or key and value, on the stack to the loop result
+
+	OpTailCall // call a function in the frame of the function that returns its result
+	OpSpawn    // start a task that calls a function, and replace the function and arguments with it
+	OpAwait    // replace a promise or task with its result, once it's there
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpNull:     {"OpNull", []int{}},
+	OpNil:      {"OpNil", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+
+	OpAdd:         {"OpAdd", []int{}},
+	OpSub:         {"OpSub", []int{}},
+	OpMul:         {"OpMul", []int{}},
+	OpDiv:         {"OpDiv", []int{}},
+	OpMod:         {"OpMod", []int{}},
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+	OpInfix:       {"OpInfix", []int{2}},
+	OpMinus:       {"OpMinus", []int{}},
+	OpBang:        {"OpBang", []int{}},
+	OpPrefix:      {"OpPrefix", []int{2}},
+	OpIndex:       {"OpIndex", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJumpNull:      {"OpJumpNull", []int{2}},
+	OpRaise:         {"OpRaise", []int{}},
+
+	// depth, slot, name constant, 1 if prefixed with 'this.'
+	OpGetVar: {"OpGetVar", []int{1, 2, 2, 1}},
+	OpSetVar: {"OpSetVar", []int{1, 2, 2, 1}},
+	// depth, slot, name constant
+	OpIncrement: {"OpIncrement", []int{1, 2, 2}},
+	OpDecrement: {"OpDecrement", []int{1, 2, 2}},
+	// slot, name constant
+	OpDefine:         {"OpDefine", []int{2, 2}},
+	OpDefineConstant: {"OpDefineConstant", []int{2, 2}},
+
+	// name constant, 1 if prefixed with 'this.'
+	OpGetName:            {"OpGetName", []int{2, 1}},
+	OpSetName:            {"OpSetName", []int{2, 1}},
+	OpDefineName:         {"OpDefineName", []int{2}},
+	OpDefineConstantName: {"OpDefineConstantName", []int{2}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpSet:   {"OpSet", []int{2}},
+
+	OpClosure:     {"OpClosure", []int{2}},
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+
+	OpRangeFrom: {"OpRangeFrom", []int{}},
+	OpRangeTo:   {"OpRangeTo", []int{}},
+	OpIterStart: {"OpIterStart", []int{}},
+	// locals constant
+	OpLoopBegin: {"OpLoopBegin", []int{2}},
+	// end of loop, slot, name constant
+	OpLoopNext:  {"OpLoopNext", []int{2, 2, 2}},
+	OpLoopBreak: {"OpLoopBreak", []int{2}},
+	OpLoopEnd:   {"OpLoopEnd", []int{}},
+
+	OpClass:     {"OpClass", []int{2}},
+	OpMakeClass: {"OpMakeClass", []int{2}},
+	// depth, slot, name constant, 1 if the class is resolved
+	OpLoadClass: {"OpLoadClass", []int{1, 2, 2, 1}},
+	// number of arguments, name constant
+	OpNew: {"OpNew", []int{1, 2}},
+	// method name constant, object name constant
+	OpGetMethod: {"OpGetMethod", []int{2, 2}},
+	// member name constant, object name constant
+	OpGetMember: {"OpGetMember", []int{2, 2}},
+	// patterns constant
+	OpMatch:       {"OpMatch", []int{2}},
+	OpNoMatch:     {"OpNoMatch", []int{}},
+	OpDestructure: {"OpDestructure", []int{2}},
+	OpArguments:   {"OpArguments", []int{2}},
+
+	// number of variables
+	OpIterRows: {"OpIterRows", []int{1}},
+	// end of loop
+	OpLoopValue: {"OpLoopValue", []int{2}},
+	// 1 for a value, 2 for a key and value
+	OpCollect: {"OpCollect", []int{1}},
+
+	// number of arguments
+	OpTailCall: {"OpTailCall", []int{1}},
+	// number of arguments
+	OpSpawn: {"OpSpawn", []int{1}},
+	OpAwait: {"OpAwait", []int{}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes an instruction with its operands in big endian
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction.
+// Returns the operands and the number of bytes read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// String disassembles the instructions, one per line
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			break
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	out := def.Name
+	for _, operand := range operands {
+		out += fmt.Sprintf(" %d", operand)
+	}
+	return out
+}
@@ -0,0 +1,895 @@
+package compiler
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/code"
+	"Pron-Lang/object"
+	"fmt"
+)
+
+// UnresolvedSlot is the slot operand of a forloop variable the resolver hasn't placed
+const UnresolvedSlot = 0xFFFF
+
+// Locals is the constant a forloop creates its env from
+type Locals struct {
+	Names []string
+	Reuse bool // the iterations of a forloop can share a frame, since its body makes no functions
+}
+
+func (l *Locals) Type() object.ObjectType { return "LOCALS" }
+func (l *Locals) Inspect() string         { return fmt.Sprintf("Locals%v", l.Names) }
+
+// Patterns is the constant a match arm compares the value with, or the
+// pattern a var statement destructures the value with
+type Patterns struct {
+	Patterns []ast.Pattern
+}
+
+func (p *Patterns) Type() object.ObjectType { return "PATTERNS" }
+func (p *Patterns) Inspect() string         { return fmt.Sprintf("Patterns%v", p.Patterns) }
+
+// CallArguments is the constant that tells which arguments of a call are
+// spread or named
+type CallArguments struct {
+	Arguments []ast.Expression
+}
+
+func (a *CallArguments) Type() object.ObjectType { return "CALL_ARGUMENTS" }
+func (a *CallArguments) Inspect() string         { return fmt.Sprintf("CallArguments%v", a.Arguments) }
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+}
+
+// CompilationScope holds the instructions of the function being compiled
+type CompilationScope struct {
+	instructions code.Instructions
+	loops        [][]int // positions of the OpLoopBreak of each enclosing loop
+}
+
+type Compiler struct {
+	constants []object.Object
+	names     map[string]int // constant index of each name and operator
+
+	scopes     []CompilationScope
+	scopeIndex int
+}
+
+// New creates a compiler for a program that has been resolved with resolver.Resolve
+func New() *Compiler {
+	mainScope := CompilationScope{instructions: code.Instructions{}}
+
+	return &Compiler{
+		constants: []object.Object{},
+		names:     make(map[string]int),
+		scopes:    []CompilationScope{mainScope},
+	}
+}
+
+// NewWithState creates a compiler that adds to the constants of an earlier compilation
+func NewWithState(constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.constants = constants
+	for i, constant := range constants {
+		if str, ok := constant.(*object.String); ok {
+			compiler.names[str.Value] = i
+		}
+	}
+	return compiler
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+	}
+}
+
+// Compile compiles a program. Every statement leaves its result on the
+// stack like the evaluator returns it, and the program returns the last one.
+func (c *Compiler) Compile(program *ast.Program) error {
+	if err := c.compileStatements(program.Statements); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+	return nil
+}
+
+// compileStatements leaves the result of the last statement on the stack
+func (c *Compiler) compileStatements(stmts []ast.Statement) error {
+	if len(stmts) == 0 {
+		c.emit(code.OpNil)
+		return nil
+	}
+
+	for i, stmt := range stmts {
+		if err := c.compileStatement(stmt); err != nil {
+			return err
+		}
+		if i < len(stmts)-1 {
+			c.emit(code.OpPop)
+		}
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileStatement(stmt ast.Statement) error {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		return c.compileExpression(stmt.Expression)
+
+	case *ast.VarStatement:
+		if err := c.compileExpression(stmt.Value); err != nil {
+			return err
+		}
+		if stmt.Pattern != nil {
+			c.emit(code.OpDestructure, c.addConstant(&Patterns{Patterns: []ast.Pattern{stmt.Pattern}}))
+		} else if stmt.IsConstant() {
+			c.emitDefineConstant(stmt.Name)
+		} else {
+			c.emitDefine(stmt.Name)
+		}
+		c.emit(code.OpNil)
+
+	case *ast.ReturnStatement:
+		if stmt.Tail {
+			if err := c.compileCall(stmt.ReturnValue.(*ast.CallExpression), code.OpTailCall); err != nil {
+				return err
+			}
+		} else if err := c.compileExpression(stmt.ReturnValue); err != nil {
+			return err
+		}
+		c.emitReturn()
+
+	case *ast.DirectFunctionStatement:
+		if err := c.compileFunction(&stmt.Function, stmt.IsPublic); err != nil {
+			return err
+		}
+		c.emitDefine(stmt.Name)
+		c.emit(code.OpNil)
+
+	case *ast.ClassStatement:
+		if err := c.compileClass(stmt); err != nil {
+			return err
+		}
+		c.emitDefine(stmt.Name)
+		c.emitGet(stmt.Name)
+
+	case *ast.EnumStatement:
+		names := []string{}
+		for _, member := range stmt.Members {
+			names = append(names, member.Value)
+		}
+		c.emit(code.OpConstant, c.addConstant(object.NewEnum(stmt.Name.Value, names)))
+		c.emitDefineConstant(stmt.Name)
+		c.emitGet(stmt.Name)
+
+	default:
+		return fmt.Errorf("compiler: unsupported statement %T", stmt)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileExpression(node ast.Expression) error {
+	switch node := node.(type) {
+	case nil:
+		c.emit(code.OpNil)
+
+	case *ast.Identifier:
+		c.emitGet(node)
+
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+
+	case *ast.BigIntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.BigInteger{Value: node.Value}))
+
+	case *ast.RealLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Real{Value: node.Value}))
+
+	case *ast.DecimalLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Decimal{Coefficient: node.Coefficient, Exponent: node.Exponent}))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.Null:
+		c.emit(code.OpNull)
+
+	case *ast.PrefixExpression:
+		if err := c.compileExpression(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			c.emit(code.OpPrefix, c.addName(node.Operator))
+		}
+
+	case *ast.InfixExpression:
+		if node.Operator == "=" {
+			return c.compileAssignment(node)
+		}
+		if node.Operator == "??" {
+			return c.compileCoalesce(node)
+		}
+		if err := c.compileExpression(node.Left); err != nil {
+			return err
+		}
+		if err := c.compileExpression(node.Right); err != nil {
+			return err
+		}
+		c.emitInfix(node.Operator)
+
+	case *ast.MatchExpression:
+		return c.compileMatch(node)
+
+	case *ast.ConditionalExpression:
+		if err := c.compileExpression(node.Condition); err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+		if err := c.compileExpression(node.Consequence); err != nil {
+			return err
+		}
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		if err := c.compileExpression(node.Alternative); err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	case *ast.IfExpression:
+		return c.compileConditions([]ast.Expression{node.Condition},
+			[]*ast.BlockStatement{node.Consequence}, node.Alternative)
+
+	case *ast.ElseIfExpression:
+		conditions := []ast.Expression{}
+		consequences := []*ast.BlockStatement{}
+		for _, conditionAndBlockstatement := range node.ConditionAndBlockstatementList {
+			conditions = append(conditions, conditionAndBlockstatement.Condition)
+			consequences = append(consequences, conditionAndBlockstatement.Consequence)
+		}
+		return c.compileConditions(conditions, consequences, node.Alternative)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, node.IsPublic)
+
+	case *ast.CallExpression:
+		return c.compileCall(node, code.OpCall)
+
+	case *ast.SpawnExpression:
+		return c.compileCall(node.Call, code.OpSpawn)
+
+	case *ast.AwaitExpression:
+		if err := c.compileExpression(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpAwait)
+
+	case *ast.NamedArgument:
+		return c.compileExpression(node.Value)
+
+	case *ast.SpreadExpression:
+		return c.compileExpression(node.Value)
+
+	case *ast.ArrayLiteral:
+		if err := c.compileExpressions(node.Elements); err != nil {
+			return err
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.SetLiteral:
+		if err := c.compileExpressions(node.Elements); err != nil {
+			return err
+		}
+		c.emit(code.OpSet, len(node.Elements))
+
+	case *ast.IndexExpression:
+		if err := c.compileExpression(node.Left); err != nil {
+			return err
+		}
+		jumpNullPos := -1
+		if node.Optional {
+			jumpNullPos = c.emit(code.OpJumpNull, 9999)
+		}
+		if err := c.compileExpression(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+		if node.Optional {
+			c.changeOperand(jumpNullPos, len(c.currentInstructions()))
+		}
+
+	case *ast.HashLiteral:
+		for _, key := range node.Keys {
+			if err := c.compileExpression(key); err != nil {
+				return err
+			}
+			if err := c.compileExpression(node.Pairs[key]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs))
+
+	case *ast.IncrementForloopExpression:
+		if err := c.compileExpression(node.From); err != nil {
+			return err
+		}
+		c.emit(code.OpRangeFrom)
+		if err := c.compileExpression(node.To); err != nil {
+			return err
+		}
+		c.emit(code.OpRangeTo)
+		return c.compileLoop(node.LocalVar, node.Body, node.Locals, node.Reuse)
+
+	case *ast.ArrayForloopExpression:
+		if err := c.compileExpression(node.ArrayName); err != nil {
+			return err
+		}
+		c.emit(code.OpIterStart)
+		return c.compileLoop(node.LocalVar, node.Body, node.Locals, node.Reuse)
+
+	case *ast.ComprehensionExpression:
+		return c.compileComprehension(node)
+
+	case *ast.ObjectInitialization:
+		resolved := 0
+		if node.Name.Resolved {
+			resolved = 1
+		}
+		c.emit(code.OpLoadClass, node.Name.Depth, node.Name.Slot, c.addName(node.Name.Value), resolved)
+		numArgs, err := c.compileArguments(node.Arguments)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpNew, numArgs, c.addName(node.Name.Value))
+
+	case *ast.CallObjectFunction:
+		c.emitGet(node.ObjectName)
+		jumpNullPos := -1
+		if node.Optional {
+			jumpNullPos = c.emit(code.OpJumpNull, 9999)
+		}
+		c.emit(code.OpGetMethod, c.addName(node.FunctionName.Value), c.addName(node.ObjectName.Value))
+		numArgs, err := c.compileArguments(node.Arguments)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpCall, numArgs)
+		if node.Optional {
+			c.changeOperand(jumpNullPos, len(c.currentInstructions()))
+		}
+
+	case *ast.MemberExpression:
+		c.emitGet(node.Object)
+		jumpNullPos := -1
+		if node.Optional {
+			jumpNullPos = c.emit(code.OpJumpNull, 9999)
+		}
+		c.emit(code.OpGetMember, c.addName(node.Member.Value), c.addName(node.Object.Value))
+		if node.Optional {
+			c.changeOperand(jumpNullPos, len(c.currentInstructions()))
+		}
+
+	case *ast.Increment:
+		return c.compileIncrement(code.OpIncrement, &node.Name)
+
+	case *ast.Decrement:
+		return c.compileIncrement(code.OpDecrement, &node.Name)
+
+	default:
+		return fmt.Errorf("compiler: unsupported expression %T", node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileExpressions(exps []ast.Expression) error {
+	for _, e := range exps {
+		if err := c.compileExpression(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileArguments compiles the arguments of a call and returns how many
+// values they leave on the stack. Spread and named arguments are packed into
+// one value, which the call takes apart
+func (c *Compiler) compileArguments(args []ast.Expression) (int, error) {
+	if err := c.compileExpressions(args); err != nil {
+		return 0, err
+	}
+
+	for _, arg := range args {
+		switch arg.(type) {
+		case *ast.SpreadExpression, *ast.NamedArgument:
+			c.emit(code.OpArguments, c.addConstant(&CallArguments{Arguments: args}))
+			return 1, nil
+		}
+	}
+	return len(args), nil
+}
+
+// compileDefaults compiles every default value of the parameters into a
+// function that computes it in the env of a call that leaves its argument out
+func (c *Compiler) compileDefaults(defaults []ast.Expression) ([]*object.CompiledFunction, error) {
+	defaultFns := make([]*object.CompiledFunction, len(defaults))
+
+	for i, def := range defaults {
+		if def == nil {
+			continue
+		}
+		c.enterScope()
+		if err := c.compileExpression(def); err != nil {
+			return nil, err
+		}
+		c.emit(code.OpReturnValue)
+		defaultFns[i] = &object.CompiledFunction{Instructions: c.leaveScope()}
+	}
+
+	return defaultFns, nil
+}
+
+func (c *Compiler) emitInfix(operator string) {
+	switch operator {
+	case "+":
+		c.emit(code.OpAdd)
+	case "-":
+		c.emit(code.OpSub)
+	case "*":
+		c.emit(code.OpMul)
+	case "/":
+		c.emit(code.OpDiv)
+	case "%":
+		c.emit(code.OpMod)
+	case "==":
+		c.emit(code.OpEqual)
+	case "!=":
+		c.emit(code.OpNotEqual)
+	case ">":
+		c.emit(code.OpGreaterThan)
+	case "<":
+		c.emit(code.OpLessThan)
+	default:
+		c.emit(code.OpInfix, c.addName(operator))
+	}
+}
+
+// compileMatch keeps the value that is matched on the stack until an arm matches
+func (c *Compiler) compileMatch(node *ast.MatchExpression) error {
+	if err := c.compileExpression(node.Subject); err != nil {
+		return err
+	}
+	jumpsToEnd := []int{}
+
+	for _, arm := range node.Arms {
+		c.emit(code.OpMatch, c.addConstant(&Patterns{Patterns: arm.Patterns}))
+		jumpsToNextArm := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+
+		if arm.Guard != nil {
+			if err := c.compileExpression(arm.Guard); err != nil {
+				return err
+			}
+			jumpsToNextArm = append(jumpsToNextArm, c.emit(code.OpJumpNotTruthy, 9999))
+		}
+
+		c.emit(code.OpPop)
+		if err := c.compileStatements(arm.Body.Statements); err != nil {
+			return err
+		}
+		jumpsToEnd = append(jumpsToEnd, c.emit(code.OpJump, 9999))
+
+		for _, pos := range jumpsToNextArm {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
+	}
+	c.emit(code.OpNoMatch)
+
+	for _, pos := range jumpsToEnd {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileCoalesce compiles a ?? b. The right side only runs when the left side is null
+func (c *Compiler) compileCoalesce(node *ast.InfixExpression) error {
+	if err := c.compileExpression(node.Left); err != nil {
+		return err
+	}
+	jumpNullPos := c.emit(code.OpJumpNull, 9999)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNullPos, len(c.currentInstructions()))
+	c.emit(code.OpPop)
+	if err := c.compileExpression(node.Right); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+func (c *Compiler) compileAssignment(node *ast.InfixExpression) error {
+	ident, ok := node.Left.(*ast.Identifier)
+	if !ok {
+		// The evaluator reports this when the assignment runs, so the vm does too
+		err := &object.Error{Message: fmt.Sprintf(
+			"leftside of assignment is not an identifier. got=%T (%+v)", node.Left, node.Left)}
+		c.emit(code.OpConstant, c.addConstant(err))
+		c.emit(code.OpRaise)
+		return nil
+	}
+
+	if err := c.compileExpression(node.Right); err != nil {
+		return err
+	}
+
+	if ident.Resolved {
+		c.emit(code.OpSetVar, ident.Depth, ident.Slot, c.addName(ident.Value), thisFlag(ident))
+	} else {
+		c.emit(code.OpSetName, c.addName(ident.Value), thisFlag(ident))
+	}
+	return nil
+}
+
+func (c *Compiler) compileIncrement(op code.Opcode, ident *ast.Identifier) error {
+	if !ident.Resolved {
+		return fmt.Errorf("compiler: %s is not resolved", ident.Value)
+	}
+	c.emit(op, ident.Depth, ident.Slot, c.addName(ident.Value))
+	return nil
+}
+
+// compileConditions compiles an if with any number of elifs.
+// Without an else the expression is null when no condition is true
+func (c *Compiler) compileConditions(conditions []ast.Expression,
+	consequences []*ast.BlockStatement, alternative *ast.BlockStatement) error {
+	jumpsToEnd := []int{}
+
+	for i, condition := range conditions {
+		if err := c.compileExpression(condition); err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileStatements(consequences[i].Statements); err != nil {
+			return err
+		}
+		jumpsToEnd = append(jumpsToEnd, c.emit(code.OpJump, 9999))
+
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	}
+
+	if alternative != nil {
+		if err := c.compileStatements(alternative.Statements); err != nil {
+			return err
+		}
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	for _, pos := range jumpsToEnd {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	return nil
+}
+
+// compileLoop compiles the body of a forloop. The iterator is on the stack
+func (c *Compiler) compileLoop(localVar ast.Expression, body *ast.BlockStatement, locals []string, reuse bool) error {
+	ident, ok := localVar.(*ast.Identifier)
+	if !ok {
+		return fmt.Errorf("compiler: forloop variable is not an identifier. got=%T", localVar)
+	}
+	slot := UnresolvedSlot
+	if ident.Resolved {
+		slot = ident.Slot
+	}
+
+	c.emit(code.OpLoopBegin, c.addConstant(&Locals{Names: locals, Reuse: reuse}))
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, []int{})
+
+	loopStart := len(c.currentInstructions())
+	loopNextPos := c.emit(code.OpLoopNext, 9999, slot, c.addName(ident.Value))
+	c.emit(code.OpPop) // the result of the previous iteration
+	if err := c.compileStatements(body.Statements); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, loopStart)
+
+	loopEnd := len(c.currentInstructions())
+	c.emit(code.OpLoopEnd)
+
+	scope = &c.scopes[c.scopeIndex]
+	breaks := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	c.changeOperand(loopNextPos, loopEnd, slot, c.addName(ident.Value))
+	for _, pos := range breaks {
+		c.changeOperand(pos, loopEnd)
+	}
+
+	return nil
+}
+
+// compileComprehension compiles a comprehension as a loop whose result is
+// the array or hash that it builds
+func (c *Compiler) compileComprehension(node *ast.ComprehensionExpression) error {
+	if err := c.compileExpression(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIterRows, len(node.Variables))
+	c.emit(code.OpLoopBegin, c.addConstant(&Locals{Names: node.Locals}))
+	c.emit(code.OpPop)
+	if node.Key == nil {
+		c.emit(code.OpArray, 0)
+	} else {
+		c.emit(code.OpHash, 0)
+	}
+
+	loopStart := len(c.currentInstructions())
+	loopValuePos := c.emit(code.OpLoopValue, 9999)
+	c.emit(code.OpDestructure, c.addConstant(&Patterns{Patterns: []ast.Pattern{node.Binding}}))
+	if node.Condition != nil {
+		if err := c.compileExpression(node.Condition); err != nil {
+			return err
+		}
+		c.emit(code.OpJumpNotTruthy, loopStart)
+	}
+
+	collected := 1
+	if node.Key != nil {
+		if err := c.compileExpression(node.Key); err != nil {
+			return err
+		}
+		collected = 2
+	}
+	if err := c.compileExpression(node.Value); err != nil {
+		return err
+	}
+	c.emit(code.OpCollect, collected)
+	c.emit(code.OpJump, loopStart)
+
+	loopEnd := len(c.currentInstructions())
+	c.emit(code.OpLoopEnd)
+	c.changeOperand(loopValuePos, loopEnd)
+
+	return nil
+}
+
+// emitReturn returns from the function, or ends the innermost forloop,
+// since a forloop catches the return values of its body
+func (c *Compiler) emitReturn() {
+	scope := &c.scopes[c.scopeIndex]
+	if len(scope.loops) == 0 {
+		c.emit(code.OpReturnValue)
+		return
+	}
+
+	pos := c.emit(code.OpLoopBreak, 9999)
+	innermost := len(scope.loops) - 1
+	scope.loops[innermost] = append(scope.loops[innermost], pos)
+}
+
+// compileCall compiles a call that op makes
+func (c *Compiler) compileCall(call *ast.CallExpression, op code.Opcode) error {
+	if err := c.compileExpression(call.Function); err != nil {
+		return err
+	}
+	numArgs, err := c.compileArguments(call.Arguments)
+	if err != nil {
+		return err
+	}
+	c.emit(op, numArgs)
+	return nil
+}
+
+func (c *Compiler) compileFunction(function *ast.FunctionLiteral, isPublic bool) error {
+	defaultFns, err := c.compileDefaults(function.Defaults)
+	if err != nil {
+		return err
+	}
+
+	c.enterScope()
+
+	if err := c.compileStatements(function.Body.Statements); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	instructions := c.leaveScope()
+
+	compiledFn := &object.CompiledFunction{
+		Instructions: instructions,
+		Parameters:   function.Parameters,
+		Defaults:     function.Defaults,
+		DefaultFns:   defaultFns,
+		Variadic:     function.Variadic,
+		Locals:       function.Locals,
+		Body:         function.Body,
+		IsPublic:     isPublic,
+		Async:        function.Async,
+	}
+	c.emit(code.OpClosure, c.addConstant(compiledFn))
+	return nil
+}
+
+// compileClass compiles the body of a class into a function that runs in
+// the class env and returns the class
+func (c *Compiler) compileClass(class *ast.ClassStatement) error {
+	c.enterScope()
+
+	for _, field := range class.Fields {
+		if err := c.compileExpression(field.Value); err != nil {
+			return err
+		}
+		if field.IsConstant() {
+			c.emitDefineConstant(field.Name)
+		} else {
+			c.emitDefine(field.Name)
+		}
+	}
+
+	for _, function := range class.Functions {
+		if err := c.compileFunction(&function.Function, function.IsPublic); err != nil {
+			return err
+		}
+		c.emitDefine(function.Name)
+	}
+
+	if class.InitBody != nil {
+		if err := c.compileInit(class); err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpMakeClass, c.addName(class.Name.Value))
+	c.emit(code.OpReturnValue)
+
+	instructions := c.leaveScope()
+
+	builder := &object.CompiledFunction{Instructions: instructions, Locals: class.Locals}
+	c.emit(code.OpClass, c.addConstant(builder))
+	return nil
+}
+
+func (c *Compiler) compileInit(class *ast.ClassStatement) error {
+	c.enterScope()
+
+	if err := c.compileStatements(class.InitBody.Statements); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	instructions := c.leaveScope()
+
+	params := []*ast.Identifier{}
+	defaults := []ast.Expression{}
+	thisParams := []bool{}
+	for _, param := range class.InitParams {
+		params = append(params, param.Parameter)
+		defaults = append(defaults, param.Default)
+		thisParams = append(thisParams, param.IsThisParam)
+	}
+	defaultFns, err := c.compileDefaults(defaults)
+	if err != nil {
+		return err
+	}
+
+	initFn := &object.CompiledFunction{
+		Instructions: instructions,
+		Parameters:   params,
+		Defaults:     defaults,
+		DefaultFns:   defaultFns,
+		ThisParams:   thisParams,
+		Locals:       class.InitLocals,
+		Body:         class.InitBody,
+	}
+	c.emit(code.OpClosure, c.addConstant(initFn))
+
+	name := &ast.Identifier{Value: "Init"}
+	for slot, local := range class.Locals {
+		if local == "Init" {
+			name.Resolved = true
+			name.Slot = slot
+		}
+	}
+	c.emitDefine(name)
+	return nil
+}
+
+func (c *Compiler) emitGet(ident *ast.Identifier) {
+	if ident.Resolved {
+		c.emit(code.OpGetVar, ident.Depth, ident.Slot, c.addName(ident.Value), thisFlag(ident))
+	} else {
+		c.emit(code.OpGetName, c.addName(ident.Value), thisFlag(ident))
+	}
+}
+
+func (c *Compiler) emitDefine(ident *ast.Identifier) {
+	if ident.Resolved {
+		c.emit(code.OpDefine, ident.Slot, c.addName(ident.Value))
+	} else {
+		c.emit(code.OpDefineName, c.addName(ident.Value))
+	}
+}
+
+func (c *Compiler) emitDefineConstant(ident *ast.Identifier) {
+	if ident.Resolved {
+		c.emit(code.OpDefineConstant, ident.Slot, c.addName(ident.Value))
+	} else {
+		c.emit(code.OpDefineConstantName, c.addName(ident.Value))
+	}
+}
+
+func thisFlag(ident *ast.Identifier) int {
+	if ident.HasThisPrefix {
+		return 1
+	}
+	return 0
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// addName adds a name or operator to the constants once and returns its index
+func (c *Compiler) addName(name string) int {
+	if idx, ok := c.names[name]; ok {
+		return idx
+	}
+	idx := c.addConstant(&object.String{Value: name})
+	c.names[name] = idx
+	return idx
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// emit adds an instruction and returns its position
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return pos
+}
+
+func (c *Compiler) changeOperand(opPos int, operands ...int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operands...)
+
+	copy(c.scopes[c.scopeIndex].instructions[opPos:], newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	return instructions
+}
@@ -0,0 +1,224 @@
+package compiler
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/code"
+	"Pron-Lang/lexer"
+	"Pron-Lang/object"
+	"Pron-Lang/parser"
+	"Pron-Lang/resolver"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestCompiler(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "1 < 2; 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "var a = 1; a",
+			expectedConstants: []interface{}{1, "a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpDefine, 0, 1),
+				code.Make(code.OpNil),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetVar, 0, 0, 1, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "if (true) { 10 }",
+			expectedConstants: []interface{}{10},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "1 ?? 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJumpNull, 9),
+				code.Make(code.OpJump, 13),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "true ? 1 : 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 13),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             "[1]?[0]",
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpJumpNull, 13),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             `len("ab")`,
+			expectedConstants: []interface{}{"len", "ab"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetName, 0, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			input:             `len(...["ab"])`,
+			expectedConstants: []interface{}{"len", "ab", nil},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetName, 0, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpArguments, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+		testInstructions(t, tt.input, tt.expectedInstructions, bytecode.Instructions)
+		testConstants(t, tt.input, tt.expectedConstants, bytecode.Constants)
+	}
+}
+
+func TestReturnInsideForloopBreaksTheLoop(t *testing.T) {
+	program := parse(t, "for (i from 0 to 3) { return i }")
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	instructions := compiler.Bytecode().Instructions
+
+	loopBreaks := 0
+	for ip := 0; ip < len(instructions); {
+		def, err := code.Lookup(instructions[ip])
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if code.Opcode(instructions[ip]) == code.OpLoopBreak {
+			loopBreaks++
+		}
+		_, read := code.ReadOperands(def, instructions[ip+1:])
+		ip += 1 + read
+	}
+
+	if loopBreaks != 1 {
+		t.Errorf("expected 1 OpLoopBreak. got=%d\n%s", loopBreaks, instructions)
+	}
+}
+
+func TestUnresolvedIncrement(t *testing.T) {
+	l := lexer.New("x++")
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	err := New().Compile(program)
+	if err == nil {
+		t.Fatalf("expected an error for an unresolved increment")
+	}
+	if err.Error() != "compiler: x is not resolved" {
+		t.Errorf("wrong error message. got=%q", err)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if errors := resolver.Resolve(program, object.NewEnvironment()); len(errors) != 0 {
+		t.Fatalf("resolver has errors: %v", errors)
+	}
+	return program
+}
+
+func testInstructions(t *testing.T, input string, expected []code.Instructions, actual code.Instructions) {
+	concatted := code.Instructions{}
+	for _, ins := range expected {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != actual.String() {
+		t.Errorf("wrong instructions for %q.\nexpected=\n%s\ngot=\n%s", input, concatted, actual)
+	}
+}
+
+func testConstants(t *testing.T, input string, expected []interface{}, actual []object.Object) {
+	if len(expected) != len(actual) {
+		t.Errorf("wrong number of constants for %q. expected=%d, got=%d", input, len(expected), len(actual))
+		return
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				t.Errorf("constant %d is not %d. got=%s", i, constant, actual[i].Inspect())
+			}
+		case string:
+			str, ok := actual[i].(*object.String)
+			if !ok || str.Value != constant {
+				t.Errorf("constant %d is not %q. got=%s", i, constant, actual[i].Inspect())
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package evaluator
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/object"
+)
+
+func evalComprehension(node *ast.ComprehensionExpression, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	rows, err := object.ComprehensionRows(iterable, len(node.Variables))
+	if err != nil {
+		return err
+	}
+
+	elements := []object.Object{}
+	hash := object.NewHash()
+
+	for _, row := range rows {
+		// the variables live in their own env for every row,
+		// so they don't leak out and closures keep their own values
+		newEnv := object.NewEnclosedFrame(env, node.Locals)
+		if err := object.Destructure(node.Binding, row, newEnv, applier(env.Task())); err != nil {
+			return err
+		}
+
+		if node.Condition != nil {
+			condition := Eval(node.Condition, newEnv)
+			if isError(condition) {
+				return condition
+			}
+			if !object.IsTruthy(condition) {
+				continue
+			}
+		}
+
+		if node.Key == nil {
+			value := Eval(node.Value, newEnv)
+			if isError(value) {
+				return value
+			}
+			elements = append(elements, value)
+			continue
+		}
+
+		key := Eval(node.Key, newEnv)
+		if isError(key) {
+			return key
+		}
+		hashKey, err := object.AsKey(key, applier(env.Task()))
+		if err != nil {
+			return err
+		}
+		value := Eval(node.Value, newEnv)
+		if isError(value) {
+			return value
+		}
+		hash, err = hash.Set(hashKey, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	if node.Key == nil {
+		return object.NewArray(elements)
+	}
+	return hash
+}
@@ -0,0 +1,26 @@
+package evaluator
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/object"
+)
+
+func evalSpawnExpression(node *ast.SpawnExpression, env *object.Environment) object.Object {
+	function := Eval(node.Call.Function, env)
+	if isError(function) {
+		return function
+	}
+	args, err := evalArguments(node.Call.Arguments, env)
+	if err != nil {
+		return err
+	}
+	if err := object.CheckSpawn(function); err != nil {
+		return err
+	}
+
+	task := env.Task().Spawn()
+	go func() {
+		task.Finish(callFunction(function, args, task))
+	}()
+	return task
+}
@@ -0,0 +1,96 @@
+package evaluator_test
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/compiler"
+	"Pron-Lang/evaluator"
+	"Pron-Lang/lexer"
+	"Pron-Lang/object"
+	"Pron-Lang/optimizer"
+	"Pron-Lang/parser"
+	"Pron-Lang/resolver"
+	"Pron-Lang/vm"
+	"fmt"
+)
+
+// Every evaluator test runs on the vm as well, and optimized on both, and
+// fails if a result differs from the evaluator's
+func init() {
+	evalInput := evaluator.EvalInput
+
+	evaluator.EvalInput = func(input string) object.Object {
+		evaluated := evalInput(input)
+
+		runs := []struct {
+			name     string
+			optimize bool
+			run      func(program *ast.Program, env *object.Environment) (object.Object, bool)
+		}{
+			{"vm", false, runVM},
+			{"optimized evaluator", true, runEvaluator},
+			{"optimized vm", true, runVM},
+		}
+
+		for _, run := range runs {
+			program, env, ok := prepare(input, run.optimize)
+			if !ok {
+				return evaluated
+			}
+			result, ok := run.run(program, env)
+			if !ok {
+				// The program uses something the compiler doesn't support
+				continue
+			}
+
+			if describe(evaluated) != describe(result) {
+				return &object.Error{Message: fmt.Sprintf("%s differs from evaluator for %q. evaluator=%s, %s=%s",
+					run.name, input, describe(evaluated), run.name, describe(result))}
+			}
+		}
+		return evaluated
+	}
+}
+
+// prepare parses the input, expands its macros and resolves it, the way
+// EvalInput does, and optimizes it when optimize is set
+func prepare(input string, optimize bool) (*ast.Program, *object.Environment, bool) {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	if errors := evaluator.ExpandMacros(program, object.NewEnvironment()); len(errors) != 0 {
+		return nil, nil, false
+	}
+	if errors := resolver.Resolve(program, env); len(errors) != 0 {
+		return nil, nil, false
+	}
+	if optimize {
+		optimizer.Optimize(program)
+	}
+	return program, env, true
+}
+
+func runEvaluator(program *ast.Program, env *object.Environment) (object.Object, bool) {
+	return evaluator.Run(program, env), true
+}
+
+// runVM compiles the program and runs it on the vm. It reports false when
+// the compiler doesn't support the program
+func runVM(program *ast.Program, env *object.Environment) (object.Object, bool) {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, false
+	}
+
+	machine := vm.New(comp.Bytecode(), env)
+	return machine.Run(), true
+}
+
+// describe gives the type and output of a result
+func describe(obj object.Object) string {
+	if obj == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("%s(%s)", obj.Type(), obj.Inspect())
+}
@@ -0,0 +1,28 @@
+package evaluator
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/object"
+)
+
+func evalEnumStatement(node *ast.EnumStatement, env *object.Environment) object.Object {
+	names := []string{}
+	for _, member := range node.Members {
+		names = append(names, member.Value)
+	}
+
+	enum := object.NewEnum(node.Name.Value, names)
+	env.DeclareConstant(node.Name, enum)
+	return enum
+}
+
+func evalMemberExpression(node *ast.MemberExpression, env *object.Environment) object.Object {
+	obj := evalIdentifier(node.Object, env)
+	if isError(obj) {
+		return obj
+	}
+	if node.Optional && obj == object.NULL {
+		return object.NULL
+	}
+	return object.GetMember(obj, node.Object.Value, node.Member.Value)
+}
@@ -2,22 +2,9 @@ package evaluator
 
 import (
 	"Pron-Lang/ast"
-	"Pron-Lang/lexer"
+	"Pron-Lang/loader"
 	"Pron-Lang/object"
-	"Pron-Lang/parser"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"math"
-	"os"
-	"path/filepath"
-	"strconv"
-)
-
-var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
@@ -29,18 +16,45 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		params := node.Parameters
 		body := node.Body
 		isPublic := node.IsPublic
-		return &object.Function{Parameters: params, Body: body, Env: env, IsPublic: isPublic}
+		locals := node.Locals
+		return &object.Function{Parameters: params, Defaults: node.Defaults, Variadic: node.Variadic,
+			Body: body, Env: env, IsPublic: isPublic, Async: node.Async, Locals: locals}
 
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		args, err := evalArguments(node.Arguments, env)
+		if err != nil {
+			return err
+		}
+		return callFunction(function, args, env.Task())
+
+	case *ast.SpawnExpression:
+		return evalSpawnExpression(node, env)
+
+	case *ast.AwaitExpression:
+		return evalAwaitExpression(node, env)
+
+	case *ast.MacroLiteral:
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
 		}
-		return applyFunction(function, args)
+		return &object.Macro{Function: function.(*object.Function)}
+
+	case *ast.QuoteExpression:
+		return evalQuote(node.Node, env)
+
+	case *ast.UnquoteExpression:
+		return newError("unquote is only allowed in quote")
+
+	case *ast.NamedArgument:
+		return Eval(node.Value, env)
+
+	case *ast.SpreadExpression:
+		return Eval(node.Value, env)
 
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
@@ -50,18 +64,28 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return object.NewArray(elements)
+
+	case *ast.SetLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return object.BuildSet(elements, applier(env.Task()))
 
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
+		if node.Optional && left == object.NULL {
+			return object.NULL
+		}
 		index := Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return object.Index(left, index, applier(env.Task()))
 
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
@@ -77,6 +101,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalBlockStatement(node, env)
 
 	case *ast.ReturnStatement:
+		if node.Tail {
+			return evalTailCall(node.ReturnValue.(*ast.CallExpression), env)
+		}
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
@@ -89,7 +116,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if node.Pattern != nil {
+			if err := object.Destructure(node.Pattern, val, env, applier(env.Task())); err != nil {
+				return err
+			}
+			break
+		}
+		if node.IsConstant() {
+			env.DeclareConstant(node.Name, val)
+			break
+		}
+		env.Declare(node.Name, val)
 
 	case *ast.DirectFunctionStatement:
 		// Make a node.Function a ast.Node
@@ -100,30 +137,39 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return val
 		}
 		// Set in the env
-		env.Set(node.Name.Value, val)
+		env.Declare(node.Name, val)
 
 	case *ast.ClassStatement:
 		return evalClassStatement(node, env)
 
+	case *ast.EnumStatement:
+		return evalEnumStatement(node, env)
+
 	// Expressions
 	case *ast.Null:
-		return &object.Null{}
+		return object.NULL
 
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return object.NewInteger(node.Value)
+
+	case *ast.BigIntegerLiteral:
+		return object.NewBigInteger(node.Value, env.Arithmetic(), "%s doesn't fit in 64 bits", node.Value)
 
 	case *ast.RealLiteral:
 		return &object.Real{Value: node.Value}
 
+	case *ast.DecimalLiteral:
+		return &object.Decimal{Coefficient: node.Coefficient, Exponent: node.Exponent}
+
 	case *ast.Boolean:
-		return nativeBoolToBooleanObject(node.Value)
+		return object.NewBoolean(node.Value)
 
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return object.Prefix(node.Operator, right, env.Arithmetic())
 
 	case *ast.InfixExpression:
 		if node.Operator == "=" {
@@ -134,11 +180,31 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(left) {
 			return left
 		}
+		if node.Operator == "??" {
+			// The right side is only evaluated when the left side is null
+			if left != object.NULL {
+				return left
+			}
+			return Eval(node.Right, env)
+		}
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right, env)
+		return object.Infix(node.Operator, left, right, applier(env.Task()), env.Arithmetic())
+
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
+	case *ast.ConditionalExpression:
+		condition := Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if object.IsTruthy(condition) {
+			return Eval(node.Consequence, env)
+		}
+		return Eval(node.Alternative, env)
 
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
@@ -152,12 +218,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.ArrayForloopExpression:
 		return evalArrayForloopExpression(node, env)
 
+	case *ast.ComprehensionExpression:
+		return evalComprehension(node, env)
+
 	case *ast.ObjectInitialization:
 		return evalObjectInitialization(node, env)
 
 	case *ast.CallObjectFunction:
 		return evalCallObejctFunction(node, env)
 
+	case *ast.MemberExpression:
+		return evalMemberExpression(node, env)
+
 	case *ast.Increment:
 		return evalIncrement(node, env)
 
@@ -194,115 +266,165 @@ func evalDecrement(node *ast.Decrement, env *object.Environment) object.Object {
 }
 
 func incrementOrDecrementInteger(name ast.Identifier, env *object.Environment, factor int64) object.Object {
-	integerObj, ok := env.Get(name.Value)
+	integerObj, ok := env.GetIdentifier(&name)
 	if !ok {
 		return newError("%s is not defined", name.Value)
 	}
 
-	integer := integerObj.(*object.Integer)
-	integer.Value = integer.Value + factor
-	env.Update(name.Value, integer)
+	// Integers are shared, so a new one is bound instead of changing the old one
+	integer, ok := object.AddToInteger(integerObj, factor, env.Arithmetic())
+	if !ok {
+		return newError("%s is not an integer. got=%s", name.Value, integerObj.Type())
+	}
+	if isError(integer) {
+		return integer
+	}
+	if err := assign(env, &name, integer); err != nil {
+		return err
+	}
 	return integer
 }
 
 func evalCallObejctFunction(node *ast.CallObjectFunction, env *object.Environment) object.Object {
-	objObject, ok := env.Get(node.ObjectName.Value)
+	objObject := evalIdentifier(node.ObjectName, env)
+	if isError(objObject) {
+		return objObject
+	}
+	if node.Optional && objObject == object.NULL {
+		return object.NULL
+	}
 
-	if !ok {
-		return newError("%s is not defined", node.ObjectName.Value)
+	if method, ok := object.EnumMethod(objObject, node.FunctionName.Value); ok {
+		if isError(method) {
+			return method
+		}
+		arguments, err := evalArguments(node.Arguments, env)
+		if err != nil {
+			return err
+		}
+		return callFunction(method, arguments, env.Task())
 	}
 
 	obj, ok := objObject.(*object.ClassInstance)
 	if !ok {
-		return newError("%s is not an object. It's a %T", obj.Name, objObject)
+		return newError("%s is not an object. It's a %T", node.ObjectName.Value, objObject)
 	}
 
 	functionObject, ok := obj.Env.Get(node.FunctionName.Value)
 	if !ok {
 		return newError("%s is not a defined method", node.FunctionName.Value)
 	}
-	function := functionObject.(*object.Function)
+	function, ok := functionObject.(*object.Function)
+	if !ok {
+		return newError("%s is not a defined method", node.FunctionName.Value)
+	}
 
 	if !function.IsPublic {
 		return newError("%s is not a public function in %s", node.FunctionName.Value, node.ObjectName)
 	}
 
-	//evalExpressions returns []object.Object
-	arguments := evalExpressions(node.Arguments, obj.Env)
-	// update the function Environment
-	function.Env = obj.Env
-	return applyFunction(function, arguments)
+	arguments, err := evalArguments(node.Arguments, env)
+	if err != nil {
+		return err
+	}
+	// the methods of an instance are already bound to its env
+	return callFunction(function, arguments, env.Task())
 }
 
 func evalObjectInitialization(node *ast.ObjectInitialization, env *object.Environment) object.Object {
-	classInstanceObject, ok := env.Get(node.Name.Value)
+	classInstanceObject, ok := env.GetIdentifier(node.Name)
 
 	if !ok {
 		// Check if class is defined in external file
-		absPath, _ := filepath.Abs(node.Name.Value + ".pron")
-		input, err := ioutil.ReadFile(absPath)
-
+		program, err := loader.Class(node.Name.Value, env)
 		if err != nil {
-			// There wasn't any other file with the class
-			return newError("There is no Class called: " + node.Name.Value)
-		}
-
-		// Lex the new file
-		l := lexer.New(string(input))
-		// Parse the lexer
-		p := parser.New(l)
-		program := p.ParseProgram()
-
-		if len(p.Errors()) != 0 {
-			PrintParserErrors(p.Errors())
+			return err
 		}
 
 		// Eval the program
 		classInstanceObject = Eval(program, env)
 	}
 
-	classInstance := classInstanceObject.(*object.ClassInstance)
+	if isError(classInstanceObject) {
+		return classInstanceObject
+	}
+
+	classInstance, ok := classInstanceObject.(*object.ClassInstance)
+	if !ok {
+		return newError("%s is not a class. got=%s", node.Name.Value, classInstanceObject.Type())
+	}
+
+	args, argsErr := evalArguments(node.Arguments, env)
+	if argsErr != nil {
+		return argsErr
+	}
 
 	// Creating copy of classInstance, because classInstance is a pointer
 	// we don't want to change values on
-	var classInstanceCopy object.ClassInstance
-	classInstanceCopy.Name = classInstance.Name
-	classInstanceCopy.Env = classInstance.Env.GetCopyOfEnvWithOuterEnvNil()
+	classInstanceCopy := classInstance.Instantiate()
 
 	initFunctionObject, ok := classInstanceCopy.Env.Get("Init")
 	if !ok {
 
 		// Check number of arguments is 0
-		if len(node.Arguments) != 0 {
-			return newError("Number of arguments in " + node.Name.Value +
-				" should be 0. got " + strconv.Itoa(len(node.Arguments)))
+		if len(args.Positional)+len(args.Named) != 0 {
+			return newError("Number of arguments in %s should be 0. got %d",
+				node.Name.Value, len(args.Positional)+len(args.Named))
 		}
 
-		return &classInstanceCopy
+		return classInstanceCopy
 	}
 	initFunction := initFunctionObject.(*object.InitFunction)
 
-	args := node.Arguments
+	params := []*ast.Identifier{}
+	defaults := []ast.Expression{}
+	for _, param := range initFunction.Parameters {
+		params = append(params, param.Parameter)
+		defaults = append(defaults, param.Default)
+	}
+	values, bindErr := object.BindArguments(params, defaults, false, args)
+	if bindErr != nil {
+		return bindErr
+	}
 
-	// Create env with all arguments that isn't a 'this.' argument
-	newEnv := object.NewEnclosedEnvironment(classInstanceCopy.Env) //initFunction.Env
-	for paramIdx, param := range initFunction.Parameters {
+	// Create env with all arguments that isn't a 'this.' argument. Default
+	// values are computed in it after the arguments are bound
+	newEnv := object.NewEnclosedFrame(classInstanceCopy.Env, initFunction.Locals)
+	newEnv.SetTask(env.Task())
+	bindInitParam := func(param *ast.InitParam, val object.Object) {
 		if param.IsThisParam {
-			val := Eval(args[paramIdx], classInstanceCopy.Env)
 			classInstanceCopy.Env.Update(param.Parameter.Value, val)
 		} else {
-			val := Eval(args[paramIdx], newEnv)
-			newEnv.Set(param.Parameter.Value, val)
+			newEnv.Declare(param.Parameter, val)
+		}
+	}
+	for paramIdx, param := range initFunction.Parameters {
+		if values[paramIdx] != nil {
+			bindInitParam(param, values[paramIdx])
+		}
+	}
+	for paramIdx, param := range initFunction.Parameters {
+		if values[paramIdx] == nil {
+			val := Eval(param.Default, newEnv)
+			if isError(val) {
+				return val
+			}
+			bindInitParam(param, val)
 		}
 	}
 
-	Eval(initFunction.Body, newEnv)
-	return &classInstanceCopy
+	result := Eval(initFunction.Body, newEnv)
+	if isError(result) {
+		return result
+	}
+	return classInstanceCopy
 }
 
 func evalClassStatement(node *ast.ClassStatement, env *object.Environment) object.Object {
 	// Create local env
-	classEnv := object.NewEnvironment()
+	classEnv := object.NewEnclosedFrame(nil, node.Locals)
+	classEnv.SetArithmetic(env.Arithmetic())
+	classEnv.SetTask(env.Task())
 
 	// Eval fields
 	for _, field := range node.Fields {
@@ -310,7 +432,11 @@ func evalClassStatement(node *ast.ClassStatement, env *object.Environment) objec
 		if isError(val) {
 			return val
 		}
-		classEnv.Set(field.Name.Value, val)
+		if field.IsConstant() {
+			classEnv.DeclareConstant(field.Name, val)
+		} else {
+			classEnv.Declare(field.Name, val)
+		}
 	}
 
 	// Eval functions
@@ -324,20 +450,21 @@ func evalClassStatement(node *ast.ClassStatement, env *object.Environment) objec
 		// Set isPublic
 		valFn := val.(*object.Function)
 		valFn.IsPublic = function.IsPublic
-		classEnv.Set(function.Name.Value, valFn)
+		classEnv.Declare(function.Name, valFn)
 	}
 
 	var initFunction object.Object
 
 	// Eval init
 	if node.InitBody != nil {
-		initFunction = &object.InitFunction{Parameters: node.InitParams, Body: node.InitBody, Env: classEnv}
+		initFunction = &object.InitFunction{Parameters: node.InitParams, Body: node.InitBody,
+			Env: classEnv, Locals: node.InitLocals}
 		classEnv.Set("Init", initFunction)
 	}
 
 	// Put class into global env
 	result := &object.ClassInstance{Name: node.Name.Value, Env: classEnv}
-	env.Set(result.Name, result)
+	env.Declare(node.Name, result)
 	return result
 }
 
@@ -358,150 +485,18 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func nativeBoolToBooleanObject(input bool) *object.Boolean {
-	if input {
-		return TRUE
-	}
-	return FALSE
-}
-
-func evalPrefixExpression(operator string, right object.Object) object.Object {
-	switch operator {
-	case "!":
-		return evalBangOperatorExpression(right)
-	case "-":
-		return evalMinusPrefixOperatorExpression(right)
-	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
-	}
-}
-
-func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
-	default:
-		return FALSE
-	}
-}
-
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() == object.INTEGER_OBJ {
-		value := right.(*object.Integer).Value
-		return &object.Integer{Value: -value}
-	} else if right.Type() == object.REAL_OBJ {
-		value := right.(*object.Real).Value
-		return &object.Real{Value: -value}
-	} else {
-		return newError("unknown operator: -%s", right.Type())
-	}
-}
-
-func evalInfixExpression(operator string, left, right object.Object, env *object.Environment) object.Object {
-	switch {
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
-	case left.Type() == object.REAL_OBJ && right.Type() == object.REAL_OBJ ||
-		left.Type() == object.INTEGER_OBJ && right.Type() == object.REAL_OBJ ||
-		left.Type() == object.REAL_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalRealInfixExpression(operator, left, right)
-	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
-	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
-	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-}
-
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
-
-	switch operator {
-	case "+":
-		return &object.Integer{Value: leftValue + rightValue}
-	case "-":
-		return &object.Integer{Value: leftValue - rightValue}
-	case "*":
-		return &object.Integer{Value: leftValue * rightValue}
-	case "/":
-		return &object.Integer{Value: leftValue / rightValue}
-	case "%":
-		return &object.Integer{Value: leftValue % rightValue}
-	case "<":
-		return nativeBoolToBooleanObject(leftValue < rightValue)
-	case ">":
-		return nativeBoolToBooleanObject(leftValue > rightValue)
-	case "==":
-		return nativeBoolToBooleanObject(leftValue == rightValue)
-	case "!=":
-		return nativeBoolToBooleanObject(leftValue != rightValue)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-}
-
-func evalRealInfixExpression(operator string, left, right object.Object) object.Object {
-	var leftValue float64
-	var rightValue float64
-
-	if left.Type() == "INTEGER" {
-		leftValue = float64(left.(*object.Integer).Value)
-	} else {
-		leftValue = left.(*object.Real).Value
-	}
-
-	if right.Type() == "INTEGER" {
-		rightValue = float64(right.(*object.Integer).Value)
-	} else {
-		rightValue = right.(*object.Real).Value
-	}
-
-	switch operator {
-	case "+":
-		return &object.Real{Value: leftValue + rightValue}
-	case "-":
-		return &object.Real{Value: leftValue - rightValue}
-	case "*":
-		return &object.Real{Value: leftValue * rightValue}
-	case "/":
-		return &object.Real{Value: leftValue / rightValue}
-	case "%":
-		return &object.Real{Value: math.Mod(leftValue, rightValue)}
-	case "<":
-		return nativeBoolToBooleanObject(leftValue < rightValue)
-	case ">":
-		return nativeBoolToBooleanObject(leftValue > rightValue)
-	case "==":
-		return nativeBoolToBooleanObject(leftValue == rightValue)
-	case "!=":
-		return nativeBoolToBooleanObject(leftValue != rightValue)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-}
-
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
-	if isTruthy(condition) {
+	if object.IsTruthy(condition) {
 		return Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
 		return Eval(ie.Alternative, env)
 	} else {
-		return NULL
+		return object.NULL
 	}
 }
 
@@ -512,7 +507,7 @@ func evalElseIfExpression(ei *ast.ElseIfExpression, env *object.Environment) obj
 			return condition
 		}
 
-		if isTruthy(condition) {
+		if object.IsTruthy(condition) {
 			return Eval(conditionAndBlockstatement.Consequence, env)
 		}
 	}
@@ -520,33 +515,46 @@ func evalElseIfExpression(ei *ast.ElseIfExpression, env *object.Environment) obj
 	if ei.Alternative != nil {
 		return Eval(ei.Alternative, env)
 	} else {
-		return NULL
+		return object.NULL
 	}
 
 }
 
 func evalIncrementForloopExpression(incForloopExp *ast.IncrementForloopExpression, env *object.Environment) object.Object {
 	from := Eval(incForloopExp.From, env)
+	if isError(from) {
+		return from
+	}
 	if from.Type() != object.INTEGER_OBJ {
 		return newError("'from' expression in forloop was not integer. got=%T", from)
 	}
 
 	to := Eval(incForloopExp.To, env)
+	if isError(to) {
+		return to
+	}
 	if to.Type() != object.INTEGER_OBJ {
 		return newError("'to' expression in forloop was not integer. got=%T", to)
 	}
 
-	// create new extended env with local var
-	newEnv := object.NewEnclosedEnvironment(env)
-	newEnv.Set(incForloopExp.LocalVar.String(), NULL)
+	localVar := incForloopExp.LocalVar.(*ast.Identifier)
 
-	var result object.Object = NULL
+	var result object.Object = object.NULL
 	fromValue := from.(*object.Integer).Value
 	toValue := to.(*object.Integer).Value
 
+	var newEnv *object.Environment
+	if incForloopExp.Reuse {
+		newEnv = object.NewEnclosedFrame(env, incForloopExp.Locals)
+	}
+
 	if fromValue < toValue {
 		for i := fromValue; i < toValue; i++ {
-			newEnv.Update(incForloopExp.LocalVar.String(), &object.Integer{Value: i})
+			// every iteration gets its own env, so closures keep their own i
+			if !incForloopExp.Reuse {
+				newEnv = object.NewEnclosedFrame(env, incForloopExp.Locals)
+			}
+			newEnv.Declare(localVar, object.NewInteger(i))
 			result = evalBlockStatement(incForloopExp.Body, newEnv)
 
 			switch result := result.(type) {
@@ -558,7 +566,10 @@ func evalIncrementForloopExpression(incForloopExp *ast.IncrementForloopExpressio
 		}
 	} else {
 		for i := fromValue; i > toValue; i-- {
-			newEnv.Update(incForloopExp.LocalVar.String(), &object.Integer{Value: i})
+			if !incForloopExp.Reuse {
+				newEnv = object.NewEnclosedFrame(env, incForloopExp.Locals)
+			}
+			newEnv.Declare(localVar, object.NewInteger(i))
 			result = evalBlockStatement(incForloopExp.Body, newEnv)
 
 			switch result := result.(type) {
@@ -573,20 +584,30 @@ func evalIncrementForloopExpression(incForloopExp *ast.IncrementForloopExpressio
 }
 
 func evalArrayForloopExpression(arrayForloopExp *ast.ArrayForloopExpression, env *object.Environment) object.Object {
-	array, ok := env.Get(arrayForloopExp.ArrayName.String())
+	array := Eval(arrayForloopExp.ArrayName, env)
+	if isError(array) {
+		return array
+	}
+	elements, ok := object.LoopElements(array)
 	if !ok {
-		return newError("%s is not defined", arrayForloopExp.ArrayName.String())
+		return newError("'in' expression in forloop was not array, hash or set. got=%T", array)
 	}
-	arrayObject := array.(*object.Array)
 
-	// create new extended env with local var
-	newEnv := object.NewEnclosedEnvironment(env)
-	newEnv.Set(arrayForloopExp.LocalVar.String(), NULL)
+	localVar := arrayForloopExp.LocalVar.(*ast.Identifier)
 
-	var result object.Object = NULL
+	var result object.Object = object.NULL
+
+	var newEnv *object.Environment
+	if arrayForloopExp.Reuse {
+		newEnv = object.NewEnclosedFrame(env, arrayForloopExp.Locals)
+	}
 
-	for _, elem := range arrayObject.Elements {
-		newEnv.Update(arrayForloopExp.LocalVar.String(), elem)
+	for _, elem := range elements {
+		// every iteration gets its own env, so closures keep their own element
+		if !arrayForloopExp.Reuse {
+			newEnv = object.NewEnclosedFrame(env, arrayForloopExp.Locals)
+		}
+		newEnv.Declare(localVar, elem)
 		result = evalBlockStatement(arrayForloopExp.Body, newEnv)
 
 		switch result := result.(type) {
@@ -600,19 +621,6 @@ func evalArrayForloopExpression(arrayForloopExp *ast.ArrayForloopExpression, env
 	return result
 }
 
-func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NULL:
-		return false
-	case TRUE:
-		return true
-	case FALSE:
-		return false
-	default:
-		return true
-	}
-}
-
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -625,23 +633,57 @@ func isError(obj object.Object) bool {
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	if node.HasThisPrefix {
-		if val, ok := env.GetOuterMost(node.Value); ok {
-			return val
-		} else {
-			return newError("identifier not found: '" + node.Value + "'. Try to remove 'this.'")
-		}
+	if val, ok := env.GetIdentifier(node); ok {
+		return val
 	}
 
-	if val, ok := env.Get(node.Value); ok {
-		return val
+	if node.HasThisPrefix {
+		return newError("identifier not found: '%s'. Try to remove 'this.'", node.Value)
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := object.GetBuiltin(node.Value); ok {
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError("identifier not found: %s", node.Value)
+}
+
+// assign changes the value of an existing variable. Returns an error if it
+// isn't defined or can't be assigned
+func assign(env *object.Environment, ident *ast.Identifier, val object.Object) *object.Error {
+	var mutability object.Mutability
+	switch {
+	case ident.Resolved:
+		mutability = env.MutabilityAt(ident.Depth, ident.Slot)
+	case ident.HasThisPrefix:
+		mutability = env.MutabilityOuterMost(ident.Value)
+	default:
+		mutability = env.Mutability(ident.Value)
+	}
+	if err := object.ReadOnlyError(ident.Value, mutability); err != nil {
+		return err
+	}
+	if ident.Resolved && env.Task().Concurrent() && env.RaceAt(ident.Depth, ident.Slot, env.Task()) {
+		return object.RaceError(ident.Value)
+	}
+
+	var ok bool
+	switch {
+	case ident.Resolved:
+		ok = env.Assign(ident.Depth, ident.Slot, val)
+	case ident.HasThisPrefix:
+		ok = env.UpdateOuterMost(ident.Value, val)
+	default:
+		ok = env.Update(ident.Value, val)
+	}
+	if !ok {
+		// check if it is an 'this.' variable or just normal scope variable
+		if ident.HasThisPrefix {
+			return newError("%s is not defined. Try to remove 'this.'", ident.Value)
+		}
+		return newError("%s is not defined", ident.Value)
+	}
+	return nil
 }
 
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
@@ -658,28 +700,108 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func evalArguments(exps []ast.Expression, env *object.Environment) (*object.Arguments, *object.Error) {
+	values := evalExpressions(exps, env)
+	if len(values) == 1 {
+		if err, ok := values[0].(*object.Error); ok {
+			return nil, err
+		}
+	}
+	return object.CollectArguments(exps, values)
+}
+
+// applier returns the Applier that calls functions in task. It's made once
+// for every task, and is small enough to inline since every operator uses it
+func applier(task *object.Task) object.Applier {
+	if task.Apply != nil {
+		return task.Apply
+	}
+	return newApplier(task)
+}
+
+func newApplier(task *object.Task) object.Applier {
+	task.Apply = func(fn object.Object, args []object.Object) object.Object {
+		return callFunction(fn, &object.Arguments{Positional: args}, task)
+	}
+	return task.Apply
+}
+
+// callFunction calls fn in task, the task of the code that calls it
+func callFunction(fn object.Object, args *object.Arguments, task *object.Task) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendedFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		if fn.Async {
+			return callAsync(fn, args, task)
+		}
+		return runFunction(fn, args, task)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if len(args.Names) != 0 {
+			return newError("builtin functions take no named arguments")
+		}
+		return fn.Call(task, applier(task), args.Positional...)
 	default:
 		return newError("not a function %s", fn.Type())
 	}
 }
 
-func extendedFunctionEnv(function *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(function.Env)
+// runFunction runs the body of fn, and the functions it calls in a return
+func runFunction(fn *object.Function, args *object.Arguments, task *object.Task) object.Object {
+	if task.Depth >= object.MaxDepth {
+		return object.RecursionError()
+	}
+	task.Depth++
+	defer func() { task.Depth-- }()
 
-	for paramIdx, param := range function.Parameters {
-		env.Set(param.Value, args[paramIdx])
+	for {
+		extendedEnv, err := extendedFunctionEnv(fn, args, task)
+		if err != nil {
+			return err
+		}
+		evaluated := unwrapReturnValue(Eval(fn.Body, extendedEnv))
+
+		call, ok := evaluated.(*tailCall)
+		if !ok {
+			return evaluated
+		}
+		// An async function returns a promise instead of running in place
+		if call.fn.Async {
+			return callAsync(call.fn, call.args, task)
+		}
+		fn, args = call.fn, call.args
 	}
+}
 
-	return env
+// extendedFunctionEnv binds the arguments in a new env for the function.
+// Parameters without an argument get their default value, which is computed
+// in that env after the arguments are bound
+func extendedFunctionEnv(function *object.Function, args *object.Arguments, task *object.Task) (*object.Environment, object.Object) {
+	values, err := object.BindArguments(function.Parameters, function.Defaults, function.Variadic, args)
+	if err != nil {
+		return nil, err
+	}
+
+	env := object.NewEnclosedFrame(function.Env, function.Locals)
+	// With one task every frame is made in it already
+	if task.Concurrent() {
+		env.SetTask(task)
+	}
+
+	for paramIdx, param := range function.Parameters {
+		if values[paramIdx] != nil {
+			env.Declare(param, values[paramIdx])
+		}
+	}
+	for paramIdx, param := range function.Parameters {
+		if values[paramIdx] == nil {
+			val := Eval(function.Defaults[paramIdx], env)
+			if isError(val) {
+				return nil, val
+			}
+			env.Declare(param, val)
+		}
+	}
 
+	return env, nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -697,77 +819,31 @@ func evalAssignValueToExistingVariable(left, right ast.Expression, env *object.E
 	}
 
 	val := Eval(right, env)
-
-	// check if it is an 'this.' variable or just normal scope variable
-	if leftIdentifier.HasThisPrefix {
-		// check existens of variables and assign value if it exists
-		if !env.UpdateOuterMost(leftIdentifier.Value, val) {
-			return newError("%s is not defined. Try to remove 'this.'", leftIdentifier.Value)
-		}
-	} else {
-		// check existens of variables and assign value if it exists
-		if !env.Update(leftIdentifier.Value, val) {
-			return newError("%s is not defined", leftIdentifier.Value)
-		}
-	}
-
-	return val
-}
-
-func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	switch operator {
-	case "+":
-		leftVal := left.(*object.String).Value
-		rightVal := right.(*object.String).Value
-		return &object.String{Value: leftVal + rightVal}
-	case "==":
-		leftVal := left.(*object.String).Value
-		rightVal := right.(*object.String).Value
-		return &object.Boolean{Value: leftVal == rightVal}
-	case "!=":
-		leftVal := left.(*object.String).Value
-		rightVal := right.(*object.String).Value
-		return &object.Boolean{Value: leftVal != rightVal}
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	if isError(val) {
+		return val
 	}
-}
 
-func evalIndexExpression(left, index object.Object) object.Object {
-	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return evalArrayIndexExpression(left, index)
-	case left.Type() == object.HASH_OBJ:
-		return evalHashIndexExpression(left, index)
-	default:
-		return newError("index operator not supported: %s", left.Type())
+	// check existens of variables and assign value if it exists
+	if err := assign(env, leftIdentifier, val); err != nil {
+		return err
 	}
-}
-
-func evalArrayIndexExpression(array, index object.Object) object.Object {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
 
-	if idx < 0 || idx > max {
-		return NULL
-	}
-
-	return arrayObject.Elements[idx]
+	return val
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
+		valueNode := node.Pairs[keyNode]
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+		hashKey, err := object.AsKey(key, applier(env.Task()))
+		if err != nil {
+			return err
 		}
 
 		value := Eval(valueNode, env)
@@ -775,33 +851,11 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
-	}
-
-	return &object.Hash{Pairs: pairs}
-}
-
-func evalHashIndexExpression(hash, index object.Object) object.Object {
-	hashObject := hash.(*object.Hash)
-
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
-	}
-
-	pair, ok := hashObject.Pairs[key.HashKey()]
-	if !ok {
-		return NULL
+		hash, err = hash.Set(hashKey, value)
+		if err != nil {
+			return err
+		}
 	}
 
-	return pair.Value
-}
-
-func PrintParserErrors(errors []string) {
-	out := os.Stdout
-	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+"- "+msg+"\n")
-	}
+	return hash
 }
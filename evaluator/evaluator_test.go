@@ -1,9 +1,12 @@
 package evaluator
 
 import (
+	"Pron-Lang/ast"
 	"Pron-Lang/lexer"
 	"Pron-Lang/object"
 	"Pron-Lang/parser"
+	"Pron-Lang/resolver"
+	"Pron-Lang/token"
 	"strconv"
 	"testing"
 )
@@ -38,6 +41,269 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"var min = -9223372036854775807 - 1; min / -1", "9223372036854775808"},
+		{"var min = -9223372036854775807 - 1; -min", "9223372036854775808"},
+		{"var max = 9223372036854775807; max++; max", "9223372036854775808"},
+		{"var big = 9223372036854775808; big--; big", "9223372036854775807"},
+		{"100000000000000000000", "100000000000000000000"},
+		{"100000000000000000000 - 99999999999999999999", "1"},
+		{"100000000000000000000 / 3", "33333333333333333333"},
+		{"-100000000000000000000 % 7", "-2"},
+		{"100000000000000000000 + 1.5", "100000000000000000000.0"},
+		{"100000000000000000000 > 9223372036854775807", "true"},
+		{"1 < 100000000000000000000", "true"},
+		{"100000000000000000000 == 100000000000000000000", "true"},
+		{"100000000000000000000 == 1", "false"},
+		{"100000000000000000000 == 100000000000000000000.0", "true"},
+		{"[100000000000000000000] == [100000000000000000000]", "true"},
+		{`{100000000000000000000: "a"}[100000000000000000000]`, "a"},
+		{`{9223372036854775808: "a"}[9223372036854775808.0]`, "a"},
+		{`{9223372036854775808.0: "a"}[9223372036854775808]`, "a"},
+		{`len(#{100000000000000000000, 100000000000000000000})`, "1"},
+		{"100000000000000000000 / 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{`100000000000000000000 + "a"`, "type mismatch: BIG_INTEGER + STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBitwiseAndPowerOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"6 & 3", "2"},
+		{"6 | 3", "7"},
+		{"6 ^ 3", "5"},
+		{"~5", "-6"},
+		{"1 << 4", "16"},
+		{"-16 >> 2", "-4"},
+		{"5 >> 100", "0"},
+		{"-5 >> 100", "-1"},
+		{"1 << 64", "18446744073709551616"},
+		{"18446744073709551616 >> 60", "16"},
+		{"18446744073709551616 & 18446744073709551615", "0"},
+		{"~9223372036854775808", "-9223372036854775809"},
+		{"2 ** 10", "1024"},
+		{"2 ** 3 ** 2", "512"},
+		{"-2 ** 2", "-4"},
+		{"(-2) ** 3", "-8"},
+		{"2 ** 64", "18446744073709551616"},
+		{"3 ** 0", "1"},
+		{"2 ** -1", "0.5"},
+		{"2.0 ** 0.5", "1.4142135623730951"},
+		{"4 ** 0.5", "2.0"},
+		{"1.5d ** 2", "2.25"},
+		{"2d ** -2", "0.25"},
+		{"rational(2, 3) ** -2", "9/4"},
+		{"7 // 2", "3"},
+		{"-7 // 2", "-4"},
+		{"7 // -2", "-4"},
+		{"-100000000000000000000 // 3", "-33333333333333333334"},
+		{"7.5 // 2", "3.0"},
+		{"-7.5d // 2", "-4"},
+		{"rational(7, 2) // rational(1, 3)", "10"},
+		{"1 // 0", "division by zero"},
+		{"0 ** -1", "division by zero"},
+		{"1 << -1", "negative shift count: -1"},
+		{"2 ** 100000000", "integer too large: 2 ** 100000000"},
+		{"1.5 & 1", "unknown operator: REAL & INTEGER"},
+		{`"a" ** 2`, "type mismatch: STRING ** INTEGER"},
+		{`"a" ** "b"`, "unknown operator: STRING ** STRING"},
+		{"true ** true", "unknown operator: BOOLEAN ** BOOLEAN"},
+		{"~1.5", "unknown operator: ~REAL"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestOverflowErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"var a = 4294967296; a * a", "integer overflow: 4294967296 * 4294967296"},
+		{"var min = -9223372036854775807 - 1; -min", "integer overflow: -(-9223372036854775808)"},
+		{"var max = 9223372036854775807; max++", "integer overflow: 9223372036854775807 + 1"},
+		{"100000000000000000000", "integer overflow: 100000000000000000000 doesn't fit in 64 bits"},
+		{"var a = 2; a ** 64", "integer overflow: 2 ** 64"},
+		{"var a = 1; a << 63", "integer overflow: 1 << 63"},
+		{"func f() { return 9223372036854775807 + 1 } f()", "integer overflow: 9223372036854775807 + 1"},
+		{"class C { func Big() { return 9223372036854775807 + 1 } } var c = new C(); c.Big()", "integer overflow: 9223372036854775807 + 1"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		env := object.NewEnvironment()
+		env.SetArithmetic(object.Arithmetic{Overflow: object.ErrorOnOverflow})
+		resolver.Resolve(program, env)
+
+		errObj, ok := Eval(program, env).(*object.Error)
+		if !ok {
+			t.Errorf("no error for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestDecimals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0.1d + 0.2d", "0.3"},
+		{"1.10d", "1.10"},
+		{"5d", "5"},
+		{"1.10d + 2", "3.10"},
+		{"1.10d == 1.1d", "true"},
+		{"1.5d * 1.5d", "2.25"},
+		{"1d / 3", "0.3333333333333333333333333333"},
+		{"2d / 3", "0.6666666666666666666666666667"},
+		{"1.00d / 2", "0.50"},
+		{"1d / 4", "0.25"},
+		{"-7.5d % 2", "-1.5"},
+		{"-1.5d", "-1.5"},
+		{"0.1d < 0.2d", "true"},
+		{"0.1d + 0.5", "0.6"},
+		{"100000000000000000000000000000d + 1", "100000000000000000000000000000"},
+		{`decimal("19.99") * 3`, "59.97"},
+		{"decimal(0.1)", "0.1"},
+		{"decimal(9223372036854775808)", "9223372036854775808"},
+		{"round(2.675d, 2)", "2.68"},
+		{`round(2.665d, 2, "half-up")`, "2.67"},
+		{"round(2.5d)", "2"},
+		{"round(5d, 2)", "5.00"},
+		{"round(2.675, 2)", "2.68"},
+		{`{1.0d: "a"}[1]`, "a"},
+		{`{0.5d: "a"}[0.5]`, "a"},
+		{"1d / 0", "division by zero"},
+		{"1d % 0", "division by zero"},
+		{`decimal("abc")`, `could not parse "abc" as decimal`},
+		{`round(1.5d, 0, "sideways")`, "unknown rounding mode: sideways"},
+		{`1.5d + "a"`, "type mismatch: DECIMAL + STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDecimalPrecision(t *testing.T) {
+	tests := []struct {
+		arithmetic object.Arithmetic
+		expected   string
+	}{
+		{object.Arithmetic{Precision: 5}, "0.66667"},
+		{object.Arithmetic{Precision: 5, Rounding: object.RoundDown}, "0.66666"},
+		{object.Arithmetic{Precision: 2, Rounding: object.RoundUp}, "0.67"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New("func f() { return 2d / 3 } f()")).ParseProgram()
+		env := object.NewEnvironment()
+		env.SetArithmetic(tt.arithmetic)
+		resolver.Resolve(program, env)
+
+		if evaluated := Eval(program, env); evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result with %+v. expected=%s, got=%s", tt.arithmetic, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestRationals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"rational(1, 3)", "1/3"},
+		{"rational(2, 4)", "1/2"},
+		{"rational(4, 2)", "2"},
+		{"rational(1, 3) + rational(1, 6)", "1/2"},
+		{"rational(1, 3) * 3", "1"},
+		{"rational(1, 3) - 1", "-2/3"},
+		{"rational(1, 3) / rational(2, 3)", "1/2"},
+		{"rational(7, 2) % 2", "3/2"},
+		{"rational(-7, 2) % 2", "-3/2"},
+		{"rational(1, 3) + 0.5d", "5/6"},
+		{"rational(1, 2) + 0.25", "0.75"},
+		{"rational(1, 3) < rational(1, 2)", "true"},
+		{"rational(1, 2) == 0.5d", "true"},
+		{"-rational(1, 2)", "-1/2"},
+		{`rational("3/4")`, "3/4"},
+		{"rational(0.75)", "3/4"},
+		{"rational(1.25d)", "5/4"},
+		{"round(rational(2, 3), 4)", "0.6667"},
+		{"round(rational(1, 8), 2)", "0.12"},
+		{`{rational(1, 2): "a"}[0.5d]`, "a"},
+		{"len(#{1, 1.0d, rational(2, 2)})", "1"},
+		{"rational(1, 0)", "division by zero"},
+		{"rational(1, 3) / 0", "division by zero"},
+		{`rational("x")`, `could not parse "x" as rational`},
+		{"rational(1.5, 2)", "arguments to `rational` must be INTEGER, got REAL and INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestEvalRealExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -288,6 +554,8 @@ func TestFunctionApplication(t *testing.T) {
 		{"var double = func(x) { x * 2; }; double(5);", 10},
 		{"var add = func(x, y) { x + y; }; add(5, 5);", 10},
 		{"var add = func(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"var count = func(n) { if (n == 0) { return 0 } return 1 + count(n - 1) }; count(3)", 3},
+		{"var isEven = func(n) { if (n == 0) { return 1 } return isOdd(n - 1) }; var isOdd = func(n) { if (n == 0) { return 0 } return isEven(n - 1) }; isEven(4)", 1},
 	}
 	for _, tt := range tests {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
@@ -304,6 +572,8 @@ func TestDirectFunctionApplication(t *testing.T) {
 		{"func double(x) { x * 2; }; double(5);", 10},
 		{"func add(x, y) { x + y; }; add(5, 5);", 10},
 		{"func add(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"func g() { return y } var y = 5; g()", 5},
+		{"func outer() { func inner() { return y } var y = 7; return inner() } outer()", 7},
 	}
 	for _, tt := range tests {
 		testIntegerObject(t, testEval(tt.input), tt.expected)
@@ -338,6 +608,740 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestCollectionOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2] + [3]`, "[1, 2, 3]"},
+		{`var a = [1]; var b = a + a; a`, "[1]"},
+		{`{"a": 1, "b": 2} + {"b": 3, "c": 4}`, "{a: 1, b: 3, c: 4}"},
+		{`{[1]: "a"} + {[1]: "b"}`, "{[1]: b}"},
+		{`"ab" * 3`, "ababab"},
+		{`3 * "ab"`, "ababab"},
+		{`"ab" * 0`, ""},
+		{`[0] * 3`, "[0, 0, 0]"},
+		{`[1, 2] * 2`, "[1, 2, 1, 2]"},
+		{`2 in [1, 2]`, "true"},
+		{`2.0 in [1, 2]`, "true"},
+		{`[1] in [[1], [2]]`, "true"},
+		{`3 in [1, 2]`, "false"},
+		{`"a" in {"a": 1}`, "true"},
+		{`1 in {"a": 1}`, "false"},
+		{`"ell" in "hello"`, "true"},
+		{`"" in "hello"`, "true"},
+		{`"z" in "hello"`, "false"},
+		{`[1, 2] < [1, 3]`, "true"},
+		{`[1, 2] < [1, 2, 0]`, "true"},
+		{`[1, 2] > [1]`, "true"},
+		{`[2] < [1, 5]`, "false"},
+		{`[1, 2] < [1, 2]`, "false"},
+		{`[["a"]] < [["b"]]`, "true"},
+		{`[1, 2] == [1, 2]`, "true"},
+		{`[1, "a"] < [1, 2]`, "type mismatch: STRING < INTEGER"},
+		{`{"a": 1} < {"a": 2}`, "unknown operator: HASH < HASH"},
+		{`[1] - [1]`, "unknown operator: ARRAY - ARRAY"},
+		{`"ab" * -1`, "negative repetition count: -1"},
+		{`[0] * 100000000`, "repetition too large: 100000000 * 1 elements"},
+		{`"ab" * 1.5`, "type mismatch: STRING * REAL"},
+		{`1 in "abc"`, "unknown operator: INTEGER in STRING"},
+		{`{} in {}`, "unusable as hash key: HASH"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestConditionalAndNullSafeOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`true ? 1 : 2`, "1"},
+		{`0 ? 1 : 2`, "1"},
+		{`false ? 1 : 2`, "2"},
+		{`var n = -3; n > 0 ? "pos" : n < 0 ? "neg" : "zero"`, "neg"},
+		{`var x = 1 > 2 ? "a" : "b"; x`, "b"},
+		{`true ? 1 : 1 + true`, "1"},
+		{`var x; x ?? 5`, "5"},
+		{`false ?? 5`, "false"},
+		{`[1][3] ?? 0`, "0"},
+		{`1 ?? 1 + true`, "1"},
+		{`var x; var y; x ?? y ?? 3`, "3"},
+		{`var x; x?[0]`, "null"},
+		{`var x; x?[1 + true]`, "null"},
+		{`var a = [1, 2]; a?[1]`, "2"},
+		{`class C { func Get() { return 7 } } var c = new C(); c?.Get()`, "7"},
+		{`var c; c?.Get(1 + true)`, "null"},
+		{`var c; c?.Get() ?? "none"`, "none"},
+		{`var x; x[0]`, "index operator not supported: NULL"},
+		{`var c; c.Get()`, "c is not an object. It's a *object.Null"},
+		{`var x = 1; x?[0]`, "index operator not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestArrowFunctionsAndComposition(t *testing.T) {
+	functions := `
+	var double = x => x * 2
+	var add = (a, b) => a + b
+	func filter(arr, keep) { var out = []; for (e in arr) { if (keep(e)) { out = out + [e] } } return out }
+	func map(arr, f) { var out = []; for (e in arr) { out = out + [f(e)] } return out }
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`double(4)`, "8"},
+		{`add(1, 2)`, "3"},
+		{`(() => 42)()`, "42"},
+		{`var f = (x) => { var y = x + 1; return y * 10 }; f(1)`, "20"},
+		{`var f = (a, b = 5) => a + b; f(1)`, "6"},
+		{`var f = ([a, b]) => a * b; f([6, 7])`, "42"},
+		{`var adder = x => y => x + y; var add2 = adder(2); add2(3)`, "5"},
+		{`[1, 2, 3, 4, 5] |> filter(x => x % 2 == 1) |> map(double)`, "[2, 6, 10]"},
+		{`3 |> double`, "6"},
+		{`3 + 1 |> double == 8`, "true"},
+		{`"abc" |> len`, "3"},
+		{`compose(double, x => x + 1)(5)`, "12"},
+		{`compose(len, first)([[1, 2, 3]])`, "3"},
+		{`compose(double)(2)`, "4"},
+		{`compose(double, add)(1, 2)`, "6"},
+		{`partial(add, 10)(5)`, "15"},
+		{`partial(add, 1, 2)()`, "3"},
+		{`partial(len)("ab")`, "2"},
+		{`compose(double, x => x + true)(1)`, "type mismatch: INTEGER + BOOLEAN"},
+		{`compose(1)`, "argument to `compose` must be FUNCTION, got INTEGER"},
+		{`partial("f", 1)`, "argument to `partial` must be FUNCTION, got STRING"},
+		{`compose()`, "wrong number of arguments. got=0, want=1 or more"},
+		{`partial(add, 1)()`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(functions + tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestConstAndFreeze(t *testing.T) {
+	classes := `
+	class Counter {
+		var count = 0
+		const step = 1
+		Init(this.count) {}
+		func Add() { count = count + step; return count }
+		func Reset() { this.count = 0 }
+		func Faster() { step = 2 }
+	}
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`const MAX = 10; MAX * 2`, "20"},
+		{`const MAX = 10; MAX = 11`, "cannot assign to constant MAX"},
+		{`const MAX = 10; MAX++`, "cannot assign to constant MAX"},
+		{`const MAX = 10; MAX--`, "cannot assign to constant MAX"},
+		{`const MAX = 10; func f() { MAX = 1 } f()`, "cannot assign to constant MAX"},
+		{`const MAX = 10; func f() { var MAX = 1; MAX = 2; return MAX } f()`, "2"},
+		{`var c = new Counter(1); c.Add()`, "2"},
+		{`var c = new Counter(1); c.Faster()`, "cannot assign to constant step"},
+		{`var c = freeze(new Counter(1)); c.Add()`, "cannot assign to count of a frozen object"},
+		{`var c = freeze(new Counter(1)); c.Reset()`, "cannot assign to count of a frozen object"},
+		{`var c = new Counter(1); var all = freeze({"c": [c]}); c.Add()`, "cannot assign to count of a frozen object"},
+		{`var c = freeze(new Counter(1)); var d = copy(c); d.Add()`, "2"},
+		{`var c = new Counter(1); var d = deepcopy(c); d.Faster()`, "cannot assign to constant step"},
+		{`freeze([1, 2])`, "[1, 2]"},
+		{`freeze(1, 2)`, "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(classes + tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	enums := `
+	enum Status { Pending, Running, Done }
+	enum Color { Red }
+	func describe(s) {
+		return match (s) {
+			Status.Pending => "waiting",
+			Status other => other.Name(),
+			_ => "not a status"
+		}
+	}
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`Status.Done`, "Status.Done"},
+		{`Status`, "enum Status {Pending, Running, Done}"},
+		{`Status.Done == Status.Done`, "true"},
+		{`Status.Done != Status.Running`, "true"},
+		{`Status.Pending == Color.Red`, "false"},
+		{`var s = Status.Running; [s.Name(), s.Ordinal()]`, "[Running, 1]"},
+		{`var names = {Status.Pending: "p", Status.Done: "d"}; names[Status.Done]`, "d"},
+		{`#{Status.Done, Status.Done, Color.Red}`, "#{Status.Done, Color.Red}"},
+		{`describe(Status.Pending)`, "waiting"},
+		{`describe(Status.Done)`, "Done"},
+		{`describe(Color.Red)`, "not a status"},
+		{`var all = []; for (s in Status) { all = all + [s] } all`, "[Status.Pending, Status.Running, Status.Done]"},
+		{`Status.Values()`, "[Status.Pending, Status.Running, Status.Done]"},
+		{`[s.Ordinal() for s in Status]`, "[0, 1, 2]"},
+		{`Status.FromName("Running")`, "Status.Running"},
+		{`Status.FromOrdinal(2)`, "Status.Done"},
+		{`var n; n?.Done`, "null"},
+		{`Status.Unknown`, "Status has no member called Unknown"},
+		{`var x = 1; x.Done`, "x is not an enum. It's a INTEGER"},
+		{`Status.FromName("Paused")`, "Status has no member called Paused"},
+		{`Status.FromName(1)`, "argument to `FromName` must be STRING, got INTEGER"},
+		{`Status.FromOrdinal(3)`, "Status has no member with ordinal 3"},
+		{`Status.FromOrdinal(-1)`, "Status has no member with ordinal -1"},
+		{`Status.Values(1)`, "wrong number of arguments. got=1, want=0"},
+		{`Status.Next()`, "Next is not a defined method"},
+		{`Status = 1`, "cannot assign to constant Status"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(enums + tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`var nums = [1, 2, 3, 4]; [x * x for x in nums if x % 2 == 0]`, "[4, 16]"},
+		{`[x + 1 for x in [1, 2, 3]]`, "[2, 3, 4]"},
+		{`[x for x in [] if x]`, "[]"},
+		{`{k: v * 2 for k, v in {"a": 1, "b": 2}}`, "{a: 2, b: 4}"},
+		{`{v: k for k, v in {"a": 1, "b": 2} if v > 1}`, "{2: b}"},
+		{`[i * x for i, x in [5, 6, 7]]`, "[0, 6, 14]"},
+		{`[a + b for [a, b] in [[1, 2], [3, 4]]]`, "[3, 7]"},
+		{`[k for k in {"a": 1}]`, "[a]"},
+		{`[v for v in set([1])]`, "[1]"},
+		{`var x = 10; var ys = [x for x in [1, 2]]; x`, "10"},
+		{`var n = 2; [x * n for x in [1, 2]]`, "[2, 4]"},
+		{`[x for x in 5]`, "'in' expression in comprehension was not array, hash or set. got=INTEGER"},
+		{`[x for k, x in 5]`, "a comprehension with two variables needs an array or a hash. got=INTEGER"},
+		{`[x for [x, y] in [1]]`, "cannot destructure 1 with [x, y]"},
+		{`[x + true for x in [1]]`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBlockScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`var a = 1; if (true) { var a = 2 } a`, "1"},
+		{`var a = 1; if (true) { var a = 2; a }`, "2"},
+		{`var a = 1; if (false) { 0 } else { var a = 3; a = 4 } a`, "1"},
+		{`func f() { var a = 1; if (true) { var a = 2; return a } } f()`, "2"},
+		{`var fs = []; for (i from 0 to 3) { fs = fs + [func() { return i }] }; [f() for f in fs]`, "[0, 1, 2]"},
+		{`var fs = []; var xs = [4, 5]; for (x in xs) { var y = x * 2; fs = fs + [func() { return y }] }; [f() for f in fs]`, "[8, 10]"},
+		{`var fs = [func() { return x } for x in [1, 2]]; [f() for f in fs]`, "[1, 2]"},
+		{`var fs = []; for (i from 0 to 2) { for (j from 0 to 2) { fs = fs + [func() { return [i, j] }] } }; [f() for f in fs]`, "[[0, 0], [0, 1], [1, 0], [1, 1]]"},
+		{`var ys = []; for (i from 0 to 3) { var y = i * 2; ys = ys + [y] }; ys`, "[0, 2, 4]"},
+		{`var ys = []; var xs = [3, 2, 1]; for (x in xs) { const y = x; ys = ys + [y] }; ys`, "[3, 2, 1]"},
+		{`var n = 1; match (5) { n => n }`, "5"},
+		{`var n = 1; match (5) { n => n } n`, "1"},
+		{`func g() { return y } var y = 5; if (true) { var y = 6 } g()`, "5"},
+		{`func g() { return y } var x = g(); var y = 5`, "ERROR: identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`func count(n, acc) { if (n == 0) { return acc } return count(n - 1, acc + 1) } count(100000, 0)`, "100000"},
+		{`func even(n) { if (n == 0) { return true } return odd(n - 1) } func odd(n) { if (n == 0) { return false } return even(n - 1) } even(100001)`, "false"},
+		{`func down(n) { match (n) { 0 => { return "done" }, _ => { return down(n - 1) } } } down(50000)`, "done"},
+		{`func f(n) { return len([n]) } f(1)`, "1"},
+		{`func f(n) { for (i from 0 to 2) { return g(i) } return 9 } func g(i) { return i } f(5)`, "9"},
+		{`func sum(n) { if (n == 0) { return 0 } return n + sum(n - 1) } sum(100)`, "5050"},
+		{`func sum(n) { if (n == 0) { return 0 } return n + sum(n - 1) } sum(100000)`, "maximum recursion depth of 10000 exceeded"},
+		{`func f(n) { return f(n, 1) } f(1)`, "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`func square(x) { return x * x } wait(spawn square(7))`, "49"},
+		{`func square(x) { return x * x } wait([spawn square(1), spawn square(2), spawn len("abc")])`, "[1, 4, 3]"},
+		{`var c = channel(); func produce(n) { for (i from 0 to n) { send(c, i) } close(c) } spawn produce(2); [receive(c), receive(c), receive(c)]`, "[0, 1, null]"},
+		{`var c = channel(2); send(c, "a"); send(c, "b"); [receive(c), receive(c)]`, "[a, b]"},
+		{`var a = channel(); var b = channel(1); send(b, 5); select([a, b])`, "[1, 5]"},
+		{`var a = channel(); close(a); select([a])`, "[0, null]"},
+		{`var total = 0; func add(n) { total = total + n } wait([spawn add(1), spawn add(2)])`, "data race on total: tasks that don't wait for each other assign it"},
+		{`var total = 0; func add(n) { total++ } wait([spawn add(1), spawn add(2)])`, "data race on total: tasks that don't wait for each other assign it"},
+		{`var total = 0; func add(n) { total = total + n } wait(spawn add(1)); wait(spawn add(2)); total = total + 10; total`, "13"},
+		{`var total = 0; var done = channel(); func add(n) { total = total + n; send(done, true) } spawn add(1); receive(done); spawn add(2); receive(done); total`, "3"},
+		{`func f() { return 1 / 0 } wait(spawn f())`, "division by zero"},
+		{`var c = channel(); close(c); send(c, 1)`, "send on closed channel"},
+		{`var c = channel(); close(c); close(c)`, "close of closed channel"},
+		{`channel(-1)`, "a channel can't have a negative size. got=-1"},
+		{`select([])`, "select needs at least one channel"},
+		{`receive(1)`, "argument to `receive` must be CHANNEL, got INTEGER"},
+		{`wait(1)`, "argument to `wait` must be TASK or ARRAY of TASK, got INTEGER"},
+		{`var x = 1; spawn x()`, "not a function INTEGER"},
+		{`var ping = channel(); var pong = channel(); func serve(n) { for (i from 0 to n) { send(ping, i); receive(pong) } } spawn serve(100); var sum = 0; for (i from 0 to 100) { sum = sum + receive(ping); send(pong, 0) } sum`, "4950"},
+		{`receive(channel())`, "deadlock: every task is waiting for another"},
+		{`var c = channel(); send(c, 1)`, "deadlock: every task is waiting for another"},
+		{`var c = channel(1); send(c, 1); send(c, 2)`, "deadlock: every task is waiting for another"},
+		{`select([channel(), channel()])`, "deadlock: every task is waiting for another"},
+		{`var a = channel(); var b = channel(); func relay() { send(b, receive(a)) } spawn relay(); receive(b)`, "deadlock: every task is waiting for another"},
+		{`var c = channel(); func f() { return receive(c) } wait(spawn f())`, "deadlock: every task is waiting for another"},
+		{`var c = channel(); func f() { return receive(c) } await spawn f()`, "deadlock: every task is waiting for another"},
+		{`async func f() { return receive(channel()) } await f()`, "deadlock: every task is waiting for another"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestConcurrencyEndsWithItsProgram(t *testing.T) {
+	run := func(input string) *object.Environment {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		env := object.NewEnvironment()
+		if errors := resolver.Resolve(program, env); len(errors) != 0 {
+			t.Fatalf("resolver errors: %v", errors)
+		}
+		Run(program, env)
+		return env
+	}
+
+	spawned := run(`func f() { return 1 } wait(spawn f())`)
+	if !spawned.Task().Concurrent() {
+		t.Fatalf("a program that spawns a task isn't concurrent")
+	}
+
+	// The program after it runs in one task again
+	single := run(`var x = 1; x = 2`)
+	if single.Task().Concurrent() {
+		t.Fatalf("a program with one task is concurrent after a program that spawned one")
+	}
+}
+
+func TestEventLoop(t *testing.T) {
+	notes := `var log = []; func note(x) { log = log + [x] } `
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{notes + `setTimeout(note, 30, "c"); setTimeout(note, 10, "a"); setTimeout(note, 10, "b"); await sleep(100); log`, "[a, b, c]"},
+		{`await sleep(250); now()`, "250"},
+		{`var n = 0; var id = 0; id = setInterval(func() { n++; if (n == 3) { clearInterval(id) } }, 10); await sleep(100); [n, now()]`, "[3, 100]"},
+		{`var fired = false; var id = setTimeout(func() { fired = true }, 10); clearTimeout(id); await sleep(20); fired`, "false"},
+		{`var x = 0; setTimeout(func() { x = 1 }, 5); 7`, "7"},
+		{notes + `async func f() { note(1); await g(); note(3) } async func g() { return 0 } f(); note(2); await sleep(0); log`, "[1, 2, 3]"},
+		{`async func fetch(x, ms) { await sleep(ms); return [x, now()] } var a = fetch("a", 30); var b = fetch("b", 10); [await a, await b]`, "[[a, 30], [b, 10]]"},
+		{`async func count(n) { if (n == 0) { return "done" } await sleep(1); return count(n - 1) } await count(3)`, "done"},
+		{`var f = async func(x) { return x * 2 }; await f(21)`, "42"},
+		{`async func f() { return 1 } f()`, "promise"},
+		{`await 5`, "5"},
+		{`func square(x) { return x * x } await spawn square(4)`, "16"},
+		{`async func fail() { await sleep(1); return 1 / 0 } async func f() { var x = await fail(); return x + 1 } await f()`, "division by zero"},
+		{`async func fail() { return 1 / 0 } fail(); 1`, "division by zero"},
+		{`async func fail() { return 1 / 0 } var p = fail(); async func f() { await p } 1`, "division by zero"},
+		{`setTimeout(func() { return 1 / 0 }, 5); 1`, "division by zero"},
+		{`var a = 0; async func f() { await sleep(1); return await a } a = f(); await a`, "await never ends: nothing is left that could settle the promise"},
+		{`var n = 0; var ch = channel(1); async func a() { await sleep(1); n++ } func s() { send(ch, a()); n++ } var t = spawn s(); await receive(ch); wait(t); n`, "data race on n: tasks that don't wait for each other assign it"},
+		{`var n = 0; async func a() { await sleep(1); n++ } func s() { var p = a(); n++; return p } await wait(spawn s()); n`, "2"},
+		{`setTimeout(1, 10)`, "argument to `setTimeout` must be FUNCTION, got INTEGER"},
+		{`sleep("a")`, "delay of `sleep` must be INTEGER, got STRING"},
+		{`func f() { await sleep(1) }`, "await is only allowed in async functions and at the top level"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testRunWithClock(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMacros(t *testing.T) {
+	unless := `var unless = macro(cond, then, otherwise) { quote(if (!(unquote(cond))) { unquote(then) } else { unquote(otherwise) }) } `
+	square := `var square = macro(x) { quote(unquote(x) * unquote(x)) } `
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{unless + `unless(10 > 5, "not greater", "greater")`, "greater"},
+		{unless + `var calls = []; func f(x) { calls = calls + [x]; return x } unless(false, f(1), f(2)); calls`, "[1]"},
+		{square + `square(3 + 1)`, "16"},
+		{square + `func f(x) { return square(x) } f(5)`, "25"},
+		{square + `var twice = macro(x) { quote(unquote(x) + unquote(x)) } twice(square(2))`, "8"},
+		{square + `var cube = macro(x) { quote(square(unquote(x)) * unquote(x)) } cube(3)`, "27"},
+		{`var six = macro() { quote(unquote(1 + 2) * 2) } six()`, "6"},
+		{`var m = macro() { quote(unquote([1, "a", true, 1.5, if (false) { 1 }])) } m()`, "[1, a, true, 1.5, null]"},
+		{`var m = macro(x) { var code = quote(unquote(x) + 1); quote(unquote(code) * 2) } m(2)`, "6"},
+		{`var m = macro() { quote(1) } m`, "identifier not found: m"},
+		{`var m = macro() { 1 } m()`, "macro m must return a QUOTE, got INTEGER"},
+		{`var m = macro() { 1 / 0 } m()`, "macro m: division by zero"},
+		{`var m = macro() { quote(unquote(func() { 1 })) } m()`, "macro m: unquote can't turn FUNCTION into code"},
+		{`var m = macro(x) { quote(m(unquote(x))) } m(1)`, "maximum macro expansion depth of 100 exceeded in m"},
+		{`var m = macro(x) { x } m(...[1])`, "macro m takes no named or spread arguments"},
+		{`func f() { var m = macro(x) { x } }`, "a macro can only be defined by a var at the top level"},
+		{`var m = macro(x) { var inc = func(code) { quote(unquote(code) + 1) }; inc(inc(x)) } m(1)`, "3"},
+		{`var m = macro() { var x = 1 } m()`, "macro m must return a QUOTE, got NULL"},
+		{square + `func f(square) { return square(2) } f(func(z) { return z + 100 })`, "102"},
+		{square + `func f() { var square = func(z) { return z * 10 }; return square(3) } f()`, "30"},
+		{square + `func f(square) { return square(2) } f(func(z) { return z }) + square(3)`, "11"},
+		{square + `var h = {"a": 1, "b": square(2)}; h`, "{a: 1, b: 4}"},
+		{square + `var pair = macro(k, v) { quote({unquote(k): unquote(v), "n": square(unquote(v))}) } pair("a", 3)`, "{a: 3, n: 9}"},
+		{`var keys = macro(h) { quote(unquote(h)["b"]) } keys({"a": 1, "b": 2})`, "2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMacroExpansionKeepsPositions(t *testing.T) {
+	input := `var square = macro(x) {
+	quote(unquote(x) * unquote(x))
+}
+
+var y = square(a + 1)`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	if errors := ExpandMacros(program, object.NewEnvironment()); len(errors) != 0 {
+		t.Fatalf("macro errors: %v", errors)
+	}
+	if program.String() != "var y = ((a + 1) * (a + 1));" {
+		t.Fatalf("wrong expansion. got=%q", program.String())
+	}
+
+	product := program.Statements[0].(*ast.VarStatement).Value.(*ast.InfixExpression)
+	sum := product.Left.(*ast.InfixExpression)
+	tests := []struct {
+		node     string
+		pos      token.Position
+		expected token.Position
+	}{
+		{"the code of the macro", product.Token.Pos, token.Position{Line: 5, Column: 9}},
+		{"the argument", sum.Token.Pos, token.Position{Line: 5, Column: 18}},
+		{"a in the argument", sum.Left.(*ast.Identifier).Token.Pos, token.Position{Line: 5, Column: 16}},
+	}
+
+	for _, tt := range tests {
+		if tt.pos != tt.expected {
+			t.Errorf("wrong position of %s. expected=%s, got=%s", tt.node, tt.expected, tt.pos)
+		}
+	}
+}
+
+// testRunWithClock runs the input on a manual clock, so timers run at once and in order
+func testRunWithClock(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+	env.SetClock(object.NewManualClock())
+
+	if errors := resolver.Resolve(program, env); len(errors) != 0 {
+		return &object.Error{Message: errors[0]}
+	}
+	return Run(program, env)
+}
+
+func TestFunctionArguments(t *testing.T) {
+	functions := `
+	func connect(host, port = 80, secure = port == 443) { return [host, port, secure] }
+	func sum(...nums) { var total = 0; for (n in nums) { total = total + n } return total }
+	func head(first, ...others) { return [first, others] }
+	class Server {
+		var host = ""
+		var port = 0
+		Init(this.host, this.port = 80) {}
+		func Describe() { return [host, port] }
+	}
+	class Empty { var a = 1 }
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`connect("x")`, "[x, 80, false]"},
+		{`connect("x", 443)`, "[x, 443, true]"},
+		{`connect(host: "y", port: 8080)`, "[y, 8080, false]"},
+		{`connect("z", secure: true)`, "[z, 80, true]"},
+		{`connect(...["w", 1])`, "[w, 1, false]"},
+		{`sum()`, "0"},
+		{`sum(1, 2, 3)`, "6"},
+		{`var arr = [4, 5, 6]; sum(1, ...arr, 2)`, "18"},
+		{`head(1, 2, 3)`, "[1, [2, 3]]"},
+		{`head(1)`, "[1, []]"},
+		{`len(...[[1, 2]])`, "2"},
+		{`var s = new Server("a"); s.Describe()`, "[a, 80]"},
+		{`var s = new Server(port: 1, host: "b"); s.Describe()`, "[b, 1]"},
+		{`var f = func(a, b = a * 2) { return a + b }; f(1)`, "3"},
+		{`var f = func(a, b = a * 2) { return a + b }; f`, "func(a, b = (a * 2)) {\nreturn (a + b);\n}"},
+		{`var n = 0; func count(step = n + 1) { n = step; return n } count(); count(); count(10)`, "10"},
+		{`connect()`, "wrong number of arguments. got=0, want=1 to 3"},
+		{`connect(1, 2, 3, 4)`, "wrong number of arguments. got=4, want=1 to 3"},
+		{`head()`, "wrong number of arguments. got=0, want=1 or more"},
+		{`func two(a, b) { a } two(1)`, "wrong number of arguments. got=1, want=2"},
+		{`func two(a, b) { a } two(1, 2, 3)`, "wrong number of arguments. got=3, want=2"},
+		{`connect("x", hots: "y")`, "unknown argument hots"},
+		{`connect("x", host: "y")`, "argument host is given more than once"},
+		{`connect(port: 1)`, "missing argument host"},
+		{`head(first: 1, others: [])`, "unknown argument others"},
+		{`sum(...5)`, "cannot spread INTEGER, only an array"},
+		{`len(x: [])`, "builtin functions take no named arguments"},
+		{`new Server()`, "wrong number of arguments. got=0, want=1 to 2"},
+		{`new Server(1, 2, 3)`, "wrong number of arguments. got=3, want=1 to 2"},
+		{`new Empty(1)`, "Number of arguments in Empty should be 0. got 1"},
+		{`func f(a = 1 + true) { a } f()`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(functions + tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`func divmod(a, b) { return [a // b, a % b] } var [q, r] = divmod(7, 2); q * 10 + r`, "31"},
+		{`var person = {"name": "Ann", "age": 30}; var {"name": n, "age": a} = person; [n, a]`, "[Ann, 30]"},
+		{`var [head, ...tail] = [1, 2, 3]; [head, tail]`, "[1, [2, 3]]"},
+		{`var [head, ...tail] = [1]; tail`, "[]"},
+		{`var [first, ...middle, last] = [1, 2, 3, 4]; [first, middle, last]`, "[1, [2, 3], 4]"},
+		{`var [a, ..._, b] = [1, 2]; a + b`, "3"},
+		{`var [[a, b], {"c": c}] = [[1, 2], {"c": 3}]; a + b + c`, "6"},
+		{`var [a, _] = [1, 2]; var [b, _] = [3, 4]; a + b`, "4"},
+		{`func sum([a, b], {"k": c}) { return a + b + c } sum([1, 2], {"k": 3})`, "6"},
+		{`var add = func(x, [a, ...rest]) { return x + a + len(rest) }; add(1, [2, 3, 4])`, "5"},
+		{`var total = 0; var pairs = [[1, 2], [3, 4]]; for ([a, b] in pairs) { total = total + a * b } total`, "14"},
+		{`match ([1, 2, 3]) { [] => "empty", [x, ...xs] => xs }`, "[2, 3]"},
+		{`match ([]) { [x, ...xs] => xs, _ => "empty" }`, "empty"},
+		{`var [a, b] = [1]`, "cannot destructure [1] with [a, b]"},
+		{`var [a, ...b, c] = [1]`, "cannot destructure [1] with [a, ...b, c]"},
+		{`var {"x": x} = {"y": 1}`, "cannot destructure {y: 1} with {x: x}"},
+		{`var [a] = 5`, "cannot destructure 5 with [a]"},
+		{`func f([a]) { a } f(1)`, "cannot destructure 1 with [a]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	describe := `
+	class Point { var x = 0
+		Init(this.x) {} }
+	func describe(v) {
+		return match (v) {
+			1, 2 => "small",
+			"x" => "ex",
+			-1 => "minus one",
+			1.5 => "one and a half",
+			true => "yes",
+			[[a], _] => a,
+			[a, b] => a + b,
+			{"type": t} => t,
+			Point p => "point",
+			int n if n > 100 => "big",
+			string s => "string " + s,
+			_ => "other"
+		}
+	}
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`describe(1)`, "small"},
+		{`describe(2)`, "small"},
+		{`describe(2.0)`, "small"},
+		{`describe("x")`, "ex"},
+		{`describe(-1)`, "minus one"},
+		{`describe(1.5)`, "one and a half"},
+		{`describe(true)`, "yes"},
+		{`describe([3, 4])`, "7"},
+		{`describe([3, 4, 5])`, "other"},
+		{`describe([[9], 0])`, "9"},
+		{`describe({"type": "cat", "age": 3})`, "cat"},
+		{`describe({"age": 3})`, "other"},
+		{`describe(new Point(1))`, "point"},
+		{`describe(500)`, "big"},
+		{`describe(50)`, "other"},
+		{`describe("y")`, "string y"},
+		{`describe(#{1})`, "other"},
+		{`match (3) { n if n > 5 => "gt", n => n * 2 }`, "6"},
+		{`match (3) { n => { var doubled = n * 2; doubled + 1 } }`, "7"},
+		{`match ([1, 2]) { [a, 1], [1, a] => a }`, "2"},
+		{`func f() { match (1) { 1 => { return "early" } } return "late" } f()`, "early"},
+		{`match (1) { [a, b] => a, 1 => 2 }`, "2"},
+		{`match (7) { 1 => 1 }`, "no pattern matched 7"},
+		{`match (1) { n if n + true => 1 }`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(describe + tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestStringComparison(t *testing.T) {
 	input := []struct {
 		input    string
@@ -347,6 +1351,10 @@ func TestStringComparison(t *testing.T) {
 		{`"hello" == "hey"`, false},
 		{`"hello" != "hello"`, false},
 		{`"hello" != "hey"`, true},
+		{`if ("hello" == "hey") { true } else { false }`, false},
+		{`"apple" < "banana"`, true},
+		{`"apple" > "app"`, true},
+		{`"B" < "a"`, true},
 	}
 
 	for _, tt := range input {
@@ -426,7 +1434,7 @@ func TestBuiltinFunctions(t *testing.T) {
 				t.Fatalf("evaluated is not object.Array. got=%+v", evaluated)
 			}
 
-			for i, elem := range arr.Elements {
+			for i, elem := range arr.Elements.Values() {
 				testIntegerObject(t, elem, expected[i])
 			}
 		case []string:
@@ -437,10 +1445,10 @@ func TestBuiltinFunctions(t *testing.T) {
 
 			for _, elem := range expected {
 				i, _ := strconv.Atoi(elem)
-				key := object.HashKey{Type: object.INTEGER_OBJ, Value: uint64(i)}
-				if hash.Pairs[key].Value.Inspect() != elem {
-					t.Errorf("hash.Pairs[key].Value.Inspect() is not %s. got=%s",
-						elem, hash.Pairs[key].Value.Inspect())
+				pair, _ := hash.Pairs.Get(&object.Integer{Value: int64(i)})
+				if pair.Value.Inspect() != elem {
+					t.Errorf("pair.Value.Inspect() is not %s. got=%s",
+						elem, pair.Value.Inspect())
 				}
 			}
 		}
@@ -456,14 +1464,14 @@ func TestArrayLiterals(t *testing.T) {
 		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	if len(result.Elements) != 3 {
+	if result.Elements.Len() != 3 {
 		t.Fatalf("array has wrong num of elements. got=%d",
-			len(result.Elements))
+			result.Elements.Len())
 	}
 
-	testIntegerObject(t, result.Elements[0], 1)
-	testIntegerObject(t, result.Elements[1], 4)
-	testIntegerObject(t, result.Elements[2], 6)
+	testIntegerObject(t, result.Elements.Get(0), 1)
+	testIntegerObject(t, result.Elements.Get(1), 4)
+	testIntegerObject(t, result.Elements.Get(2), 6)
 }
 
 func TestArrayIndexExpressions(t *testing.T) {
@@ -540,27 +1548,188 @@ func TestHashLiterals(t *testing.T) {
 		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():      4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{object.TRUE, 5},
+		{object.FALSE, 6},
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Pairs.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Pairs.Len())
 	}
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+	for _, tt := range expected {
+		pair, ok := result.Pairs.Get(tt.key)
 
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 		}
 
-		testIntegerObject(t, pair.Value, expectedValue)
+		testIntegerObject(t, pair.Value, tt.value)
+	}
+
+	// The pairs keep the order of the literal
+	for i, pair := range result.Pairs.Pairs() {
+		testIntegerObject(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{3: "c", 1: "a", 2: "b"}`, `{3: c, 1: a, 2: b}`},
+		{`add({"z": 1, "a": 2}, "m", 3)`, `{z: 1, a: 2, m: 3}`},
+		{`add({"z": 1, "a": 2}, "z", 3)`, `{z: 3, a: 2}`},
+		{`remove({"z": 1, "a": 2, "m": 3}, "a")`, `{z: 1, m: 3}`},
+		{`add(remove({"z": 1, "a": 2}, "z"), "z", 1)`, `{a: 2, z: 1}`},
+		{`var s = 0; var h = {3: "c", 1: "a", 2: "b"}; for (k in h) { s = s * 10 + k }; s`, `312`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong order for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHashKeys(t *testing.T) {
+	classes := `
+	class Point {
+		var x
+		var y
+		Init(this.x, this.y) {}
+		func GetX() { return x }
+		func GetY() { return y }
+		func Hash() { return [x, y] }
+		func Equals(other) { return [x, y] == [other.GetX(), other.GetY()] }
+	}
+	class Named {
+		var name
+		Init(this.name) {}
+		func Hash() { return len(name) }
+	}
+	class Broken {
+		var v
+		Init(this.v) {}
+		func Hash() { return 1 }
+		func Equals(other) { return 1 / 0 }
+	}
+	class Plain {}
+	`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{1.5: "a"}[1.5]`, "a"},
+		{`{1: "a"}[1.0]`, "a"},
+		{`{1.0: "a"}[1]`, "a"},
+		{`{1: "a", 1.0: "b"}`, "{1: b}"},
+		{`{0.5: "a"}[0]`, "null"},
+		{`{[1, 2]: "a"}[[1, 2]]`, "a"},
+		{`{[1, [2, 3]]: "a"}[[1, [2, 3.0]]]`, "a"},
+		{`{[1, 2]: "a"}[[2, 1]]`, "null"},
+		{`{[]: "a"}[[]]`, "a"},
+		{`var p = new Point(1, 2); {p: "a"}[new Point(1, 2)]`, "a"},
+		{`{new Point(1, 2): "a"}[new Point(2, 1)]`, "null"},
+		{`{[new Point(1, 2)]: "a"}[[new Point(1, 2)]]`, "a"},
+		{`len(add({new Point(1, 2): "a"}, new Point(1, 2), "b"))`, "1"},
+		{`remove({new Point(1, 2): "a", 3: "b"}, new Point(1, 2))`, "{3: b}"},
+		{`var h = {new Named("ab"): 1, new Named("cd"): 2}; len(h)`, "2"},
+		{`var h = {new Named("ab"): 1}; h[new Named("ab")]`, "1"},
+		{`var h = {new Named("ab"): 1}; h[new Named("cd")]`, "null"},
+		{`{new Point(1, 2): 1} == {new Point(1, 2): 1}`, "true"},
+		{`{new Plain(): 1}`, "unusable as hash key: CLASS Plain has no Hash method"},
+		{`{[1, func() {}]: 1}`, "unusable as hash key: FUNCTION"},
+		{`{1: 2}[[1, {}]]`, "unusable as hash key: HASH"},
+		{`var hp = {new Broken(1): "a"}; hp[new Broken(1)]`, "division by zero"},
+		{`{new Broken(1): 1, new Broken(2): 2}`, "division by zero"},
+		{`new Broken(1) in {new Broken(2): 1}`, "division by zero"},
+		{`add({new Broken(1): 1}, new Broken(2), 2)`, "division by zero"},
+		{`remove({new Broken(1): 1}, new Broken(2))`, "division by zero"},
+		{`{new Broken(1): 1} + {new Broken(2): 2}`, "division by zero"},
+		{`{[new Broken(1)]: 1} == {[new Broken(2)]: 1}`, "division by zero"},
+		{`#{new Broken(1), new Broken(2)}`, "division by zero"},
+		{`new Broken(1) in #{new Broken(2)}`, "division by zero"},
+		{`remove(#{new Broken(1)}, new Broken(2))`, "division by zero"},
+		{`union(#{new Broken(1)}, #{new Broken(2)})`, "division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(classes + tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`#{1, 2, 3}`, "#{1, 2, 3}"},
+		{`#{}`, "#{}"},
+		{`#{3, 1, 3, 2, 1}`, "#{3, 1, 2}"},
+		{`#{1, 1.0}`, "#{1}"},
+		{`#{[1, 2], [1, 2]}`, "#{[1, 2]}"},
+		{`len(#{1, 2, 2})`, "2"},
+		{`2 in #{1, 2}`, "true"},
+		{`2.0 in #{1, 2}`, "true"},
+		{`3 in #{1, 2}`, "false"},
+		{`[1] in #{[1], [2]}`, "true"},
+		{`var s = #{1, 2, 3}; var total = 0; for (x in s) { total = total * 10 + x }; total`, "123"},
+		{`set()`, "#{}"},
+		{`set([1, 2, 1])`, "#{1, 2}"},
+		{`set({"a": 1, "b": 2})`, "#{a, b}"},
+		{`add(#{1}, 2)`, "#{1, 2}"},
+		{`add(#{1}, 1)`, "#{1}"},
+		{`remove(#{1, 2}, 1)`, "#{2}"},
+		{`union(#{1, 2}, #{2, 3})`, "#{1, 2, 3}"},
+		{`intersection(#{1, 2}, #{2, 3})`, "#{2}"},
+		{`difference(#{1, 2}, #{2, 3})`, "#{1}"},
+		{`subset(#{1}, #{1, 2})`, "true"},
+		{`subset(#{1, 3}, #{1, 2})`, "false"},
+		{`#{1, 2} == #{2, 1}`, "true"},
+		{`#{1, 2} == #{1, 3}`, "false"},
+		{`#{1, 2} != #{1}`, "true"},
+		{`{#{1, 2}: "a"}[#{2, 1}]`, "a"},
+		{`#{#{1}, #{1}}`, "#{#{1}}"},
+		{`#{{}}`, "unusable as hash key: HASH"},
+		{`1 in 1`, "unknown operator: INTEGER in INTEGER"},
+		{`remove(#{1}, 2)`, "element not found in set"},
+		{`union(#{1}, [1])`, "argument to `union` must be SET, got ARRAY"},
+		{`set(1)`, "argument to `set` must be ARRAY, MAP or SET, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
 	}
 }
 
@@ -998,7 +2167,7 @@ func TestMultipleObjectInitializations(t *testing.T) {
 	names := []string{"Hans", "Ole", "Jens"}
 	ages := []int{10, 15, 20}
 
-	for i, elem := range result.Elements {
+	for i, elem := range result.Elements.Values() {
 		person := elem.(*object.ClassInstance)
 
 		name, _ := person.Env.Get("name")
@@ -1105,27 +2274,27 @@ func TestThisPrefixedIdentifier(t *testing.T) {
 		t.Fatalf("evaluated is not *object.Array. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	str, ok := arr.Elements[0].(*object.String)
+	str, ok := arr.Elements.Get(0).(*object.String)
 	if !ok {
-		t.Errorf("arr.Elements[0] is not *object.String. got=%T", arr.Elements[0])
+		t.Errorf("arr.Elements.Get(0) is not *object.String. got=%T", arr.Elements.Get(0))
 	}
 
 	if str.Value != "Hans" {
 		t.Errorf("str.Value is not 'Hans'. got=%s", str.Value)
 	}
 
-	str2, ok := arr.Elements[1].(*object.String)
+	str2, ok := arr.Elements.Get(1).(*object.String)
 	if !ok {
-		t.Errorf("arr.Elements[1] is not *object.String. got=%T", arr.Elements[1])
+		t.Errorf("arr.Elements.Get(1) is not *object.String. got=%T", arr.Elements.Get(1))
 	}
 
 	if str2.Value != "Jens" {
 		t.Errorf("str2.Value is not 'Jens'. got=%s", str2.Value)
 	}
 
-	str3, ok := arr.Elements[2].(*object.String)
+	str3, ok := arr.Elements.Get(2).(*object.String)
 	if !ok {
-		t.Errorf("arr.Elements[2] is not *object.String. got=%T", arr.Elements[2])
+		t.Errorf("arr.Elements.Get(2) is not *object.String. got=%T", arr.Elements.Get(2))
 	}
 
 	if str3.Value != "Ole" {
@@ -1206,7 +2375,7 @@ func TestPrivateFunction(t *testing.T) {
 
 	error, ok := evaluated.(*object.Error)
 	if !ok {
-		t.Fatalf("arr.Elements[1] is not *object.Error. got=%T", evaluated)
+		t.Fatalf("arr.Elements.Get(1) is not *object.Error. got=%T", evaluated)
 	}
 
 	if error.Message != "privateFunction is not a public function in p" {
@@ -1242,17 +2411,176 @@ func TestPrivateFunctionsInsideClass(t *testing.T) {
 	}
 }
 
+func TestStructuralEquality(t *testing.T) {
+	classes := `
+	class Node {
+		var value
+		var next
+		Init(this.value) {}
+		func SetNext(n) { next = n }
+		func GetNext() { return next }
+		func GetValue() { return value }
+	}
+	class Point {
+		var x
+		var y
+		Init(this.x, this.y) {}
+		func GetX() { return x }
+		func Equals(other) { return x == other.GetX() }
+	}
+	`
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`[1, 2] == [1, 2]`, true},
+		{`[1, 2] != [1, 2]`, false},
+		{`[1, 2] == [1, 2, 3]`, false},
+		{`[1, [2, 3]] == [1, [2, 3]]`, true},
+		{`[1, [2, 3]] == [1, [2, 4]]`, false},
+		{`[1, 2] == [1, 2.0]`, true},
+		{`[1, "1"] == [1, 1]`, false},
+		{`[] == []`, true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`new Node(1) == new Node(1)`, true},
+		{`new Node(1) != new Node(2)`, true},
+		{`var a = new Node(1); a.SetNext(a); var b = new Node(1); b.SetNext(b); a == b`, true},
+		{`var a = new Node(1); a.SetNext(a); var b = new Node(2); b.SetNext(b); a == b`, false},
+		{`var a = new Node(1); var b = new Node(1); a.SetNext(b); b.SetNext(a); a == b`, true},
+		{`new Point(1, 2) == new Point(1, 3)`, true},
+		{`new Point(1, 2) == new Point(2, 2)`, false},
+		{`[new Point(1, 2)] == [new Point(1, 5)]`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(classes + tt.input)
+		if !testBooleanObject(t, evaluated, tt.expected) {
+			t.Errorf("wrong result for %q", tt.input)
+		}
+	}
+}
+
+func TestCopyBuiltins(t *testing.T) {
+	classes := `
+	class Node {
+		var value
+		var next
+		Init(this.value) {}
+		func SetNext(n) { next = n }
+		func GetNext() { return next }
+		func GetValue() { return value }
+	}
+	`
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`copy([1, [2]])`, "[1, [2]]"},
+		{`deepcopy({"a": [1, 2]})`, "{a: [1, 2]}"},
+		{`var a = new Node(1); var b = copy(a); b.SetNext(2); a.GetNext()`, nil},
+		{`var a = new Node(1); a.SetNext(new Node(2)); var b = copy(a); var n = b.GetNext(); n.SetNext(3); var m = a.GetNext(); m.GetNext()`, int64(3)},
+		{`var a = new Node(1); a.SetNext(new Node(2)); var b = deepcopy(a); var n = b.GetNext(); n.SetNext(3); var m = a.GetNext(); m.GetNext()`, nil},
+		{`var a = new Node(1); a.SetNext(a); var b = deepcopy(a); var n = b.GetNext(); n.SetNext(5); b.GetNext()`, int64(5)},
+		{`var a = new Node(1); a.SetNext(a); var b = deepcopy(a); b.SetNext(5); var n = a.GetNext(); n.GetValue()`, int64(1)},
+		{`var a = new Node(1); deepcopy([a, a]) == [a, a]`, true},
+		{`copy(1, 2)`, "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(classes + tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+				}
+			} else if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%s, got=%s", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestDeepCopyKeepsCycles(t *testing.T) {
+	input := `
+	class Node {
+		var value
+		var next
+		Init(this.value) {}
+		func SetNext(n) { next = n }
+		func GetNext() { return next }
+		func GetValue() { return value }
+	}
+	var a = new Node(1)
+	a.SetNext(a)
+	deepcopy(a)
+	`
+
+	evaluated := testEval(input)
+	copied, ok := evaluated.(*object.ClassInstance)
+	if !ok {
+		t.Fatalf("evaluated is not *object.ClassInstance. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	next, _ := copied.Env.Get("next")
+	if next != copied {
+		t.Errorf("the copy doesn't point to itself. got=%p, want=%p", next, copied)
+	}
+}
+
 //////////////////////////////
 ////// Helper functions //////
 //////////////////////////////
 
+func TestForloopVariablesAreNotShared(t *testing.T) {
+	input := `
+	var i = 300
+	var j = i
+	i++
+	var sum = 0
+	for (k from 0 to 3) { sum = sum + k }
+	return [j, i, sum]`
+
+	arr, ok := testEval(input).(*object.Array)
+	if !ok {
+		t.Fatalf("evaluated is not *object.Array")
+	}
+
+	testIntegerObject(t, arr.Elements.Get(0), 300)
+	testIntegerObject(t, arr.Elements.Get(1), 301)
+	testIntegerObject(t, arr.Elements.Get(2), 3)
+}
+
 func testEval(input string) object.Object {
+	return EvalInput(input)
+}
+
+// EvalInput runs the input of a test. The differential test wraps it to run the vm too
+var EvalInput = func(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
 	env := object.NewEnvironment()
 
-	return Eval(program, env)
+	if errors := ExpandMacros(program, object.NewEnvironment()); len(errors) != 0 {
+		return &object.Error{Message: errors[0]}
+	}
+	if errors := resolver.Resolve(program, env); len(errors) != 0 {
+		return &object.Error{Message: errors[0]}
+	}
+
+	return Run(program, env)
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -1296,7 +2624,7 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 }
 
 func testNullObject(t *testing.T, obj object.Object) bool {
-	if obj != NULL {
+	if obj != object.NULL {
 		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
 		return false
 	}
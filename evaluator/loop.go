@@ -0,0 +1,39 @@
+package evaluator
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/object"
+)
+
+// Run runs a program in env, and then its event loop until no timer or
+// async function is left. It returns the result of the program, or the
+// error that stopped it or a timer
+func Run(program *ast.Program, env *object.Environment) object.Object {
+	result := Eval(program, env)
+	if isError(result) {
+		return result
+	}
+	if err := env.Task().Loop.Run(env.Task(), applier(env.Task())); err != nil {
+		return err
+	}
+	return result
+}
+
+func evalAwaitExpression(node *ast.AwaitExpression, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	result, ok := env.Task().Await(val, applier(env.Task()))
+	if !ok {
+		return object.AwaitError()
+	}
+	return result
+}
+
+// callAsync calls fn until it awaits, and returns the promise of its result
+func callAsync(fn *object.Function, args *object.Arguments, task *object.Task) object.Object {
+	return task.Async(func(task *object.Task) object.Object {
+		return runFunction(fn, args, task)
+	})
+}
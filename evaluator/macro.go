@@ -0,0 +1,311 @@
+package evaluator
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/object"
+	"Pron-Lang/resolver"
+	"Pron-Lang/token"
+	"fmt"
+	"strconv"
+)
+
+// maxExpansionDepth is how deep macros can expand into calls of macros
+const maxExpansionDepth = 100
+
+// ExpandMacros takes the macros that the top level of the program defines
+// with var out of it, and defines them in env. Then it replaces every call of
+// a macro with the code the macro returns for the code of the arguments. That
+// code gets the position of the call, and the arguments keep theirs.
+// Returns the errors of the definitions and calls.
+func ExpandMacros(program *ast.Program, env *object.Environment) []string {
+	if errors := defineMacros(program, env); len(errors) != 0 {
+		return errors
+	}
+	if !hasMacros(env) {
+		return nil
+	}
+
+	e := &expander{env: env, bound: map[string]int{}}
+	expanded := e.expand(program).(*ast.Program)
+	program.Statements = expanded.Statements
+	return e.errors
+}
+
+func defineMacros(program *ast.Program, env *object.Environment) []string {
+	definitions := &ast.Program{}
+	statements := []ast.Statement{}
+	for _, stmt := range program.Statements {
+		if isMacroDefinition(stmt) {
+			definitions.Statements = append(definitions.Statements, stmt)
+		} else {
+			statements = append(statements, stmt)
+		}
+	}
+	if len(definitions.Statements) == 0 {
+		return nil
+	}
+	program.Statements = statements
+
+	if errors := resolver.ResolveMacros(definitions, env); len(errors) != 0 {
+		return errors
+	}
+	if err, ok := Eval(definitions, env).(*object.Error); ok {
+		return []string{err.Message}
+	}
+	return nil
+}
+
+func isMacroDefinition(stmt ast.Statement) bool {
+	varStmt, ok := stmt.(*ast.VarStatement)
+	if !ok || varStmt.Pattern != nil {
+		return false
+	}
+	_, ok = varStmt.Value.(*ast.MacroLiteral)
+	return ok
+}
+
+func hasMacros(env *object.Environment) bool {
+	for _, val := range env.Values() {
+		if _, ok := val.(*object.Macro); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type expander struct {
+	env    *object.Environment
+	depth  int
+	bound  map[string]int // how many of the nodes around the one being expanded bind each name
+	errors []string
+}
+
+func (e *expander) expand(node ast.Node) ast.Node {
+	return ast.ModifyScoped(node, e.enter, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+		name, ok := call.Function.(*ast.Identifier)
+		if !ok {
+			return node
+		}
+		// A parameter or a local with the name of a macro hides the macro
+		if e.bound[name.Value] > 0 {
+			return node
+		}
+		if macro, ok := e.env.Get(name.Value); ok {
+			if macro, ok := macro.(*object.Macro); ok {
+				return e.expandCall(call, name, macro)
+			}
+		}
+		return node
+	})
+}
+
+// enter counts the names node binds for the nodes in it, until the
+// function it returns is called
+func (e *expander) enter(node ast.Node) func() {
+	names := boundNames(node)
+	for _, name := range names {
+		e.bound[name]++
+	}
+	return func() {
+		for _, name := range names {
+			e.bound[name]--
+		}
+	}
+}
+
+// boundNames returns the names node binds for the nodes in it: the
+// parameters of a function, the variable of a forloop, the variables of the
+// patterns of a comprehension or a match arm, and what a block declares
+func boundNames(node ast.Node) []string {
+	names := []string{}
+	switch node := node.(type) {
+	case *ast.Program:
+		names = declaredNames(node.Statements)
+	case *ast.BlockStatement:
+		names = declaredNames(node.Statements)
+	case *ast.FunctionLiteral:
+		for _, param := range node.Parameters {
+			names = append(names, param.Value)
+		}
+	case *ast.DirectFunctionStatement:
+		for _, param := range node.Function.Parameters {
+			names = append(names, param.Value)
+		}
+	case *ast.ClassStatement:
+		for _, field := range node.Fields {
+			names = append(names, declaredNames([]ast.Statement{field})...)
+		}
+		for _, function := range node.Functions {
+			names = append(names, declaredNames([]ast.Statement{function})...)
+		}
+		for _, param := range node.InitParams {
+			names = append(names, param.Parameter.Value)
+		}
+	case *ast.IncrementForloopExpression:
+		names = patternNames(node.LocalVar, names)
+	case *ast.ArrayForloopExpression:
+		names = patternNames(node.LocalVar, names)
+	case *ast.ComprehensionExpression:
+		names = patternNames(node.Binding, names)
+	case *ast.MatchArm:
+		for _, pattern := range node.Patterns {
+			names = patternNames(pattern, names)
+		}
+	}
+	return names
+}
+
+// declaredNames returns the names the statements of a block declare
+func declaredNames(stmts []ast.Statement) []string {
+	names := []string{}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.VarStatement:
+			if stmt.Pattern != nil {
+				names = patternNames(stmt.Pattern, names)
+			} else {
+				names = append(names, stmt.Name.Value)
+			}
+		case *ast.DirectFunctionStatement:
+			if stmt.Name != nil {
+				names = append(names, stmt.Name.Value)
+			}
+		case *ast.ClassStatement:
+			names = append(names, stmt.Name.Value)
+		case *ast.EnumStatement:
+			names = append(names, stmt.Name.Value)
+		}
+	}
+	return names
+}
+
+// patternNames adds the names of the variables pattern binds to names
+func patternNames(pattern ast.Node, names []string) []string {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		return append(names, pattern.Value)
+	case *ast.ArrayPattern:
+		for _, elem := range pattern.Elements {
+			names = patternNames(elem, names)
+		}
+	case *ast.RestPattern:
+		return append(names, pattern.Name.Value)
+	case *ast.HashPattern:
+		for _, value := range pattern.Values {
+			names = patternNames(value, names)
+		}
+	case *ast.TypePattern:
+		return append(names, pattern.Name.Value)
+	}
+	return names
+}
+
+func (e *expander) expandCall(call *ast.CallExpression, name *ast.Identifier, macro *object.Macro) ast.Node {
+	args := []object.Object{}
+	for _, arg := range call.Arguments {
+		switch arg.(type) {
+		case *ast.NamedArgument, *ast.SpreadExpression:
+			e.errors = append(e.errors, fmt.Sprintf("macro %s takes no named or spread arguments", name.Value))
+			return call
+		}
+		args = append(args, &object.Quote{Node: arg})
+	}
+	if e.depth >= maxExpansionDepth {
+		e.errors = append(e.errors, fmt.Sprintf("maximum macro expansion depth of %d exceeded in %s", maxExpansionDepth, name.Value))
+		return call
+	}
+
+	result := callFunction(macro.Function, &object.Arguments{Positional: args}, e.env.Task())
+	if err, ok := result.(*object.Error); ok {
+		e.errors = append(e.errors, fmt.Sprintf("macro %s: %s", name.Value, err.Message))
+		return call
+	}
+	if result == nil {
+		result = object.NULL
+	}
+	quote, ok := result.(*object.Quote)
+	if !ok {
+		e.errors = append(e.errors, fmt.Sprintf("macro %s must return a QUOTE, got %s", name.Value, result.Type()))
+		return call
+	}
+
+	ast.SetPosition(quote.Node, name.Token.Pos, func(node ast.Node) bool {
+		for _, arg := range call.Arguments {
+			if node == arg {
+				return true
+			}
+		}
+		return false
+	})
+
+	// The code can call macros too
+	e.depth++
+	defer func() { e.depth-- }()
+	return e.expand(quote.Node)
+}
+
+// evalQuote returns the code of node, with the values of what is unquoted in it
+func evalQuote(node ast.Node, env *object.Environment) object.Object {
+	var err *object.Error
+	quoted := ast.Modify(node, func(node ast.Node) ast.Node {
+		unquote, ok := node.(*ast.UnquoteExpression)
+		if !ok || err != nil {
+			return node
+		}
+		val := Eval(unquote.Value, env)
+		if isError(val) {
+			err = val.(*object.Error)
+			return node
+		}
+		code, ok := codeOf(val)
+		if !ok {
+			err = newError("unquote can't turn %s into code", val.Type())
+			return node
+		}
+		return code
+	})
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: quoted}
+}
+
+// codeOf returns an expression that evaluates to val
+func codeOf(val object.Object) (ast.Expression, bool) {
+	switch val := val.(type) {
+	case *object.Quote:
+		code, ok := val.Node.(ast.Expression)
+		return code, ok
+	case *object.Integer:
+		literal := strconv.FormatInt(val.Value, 10)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal}, Value: val.Value}, true
+	case *object.Real:
+		literal := strconv.FormatFloat(val.Value, 'g', -1, 64)
+		return &ast.RealLiteral{Token: token.Token{Type: token.REAL, Literal: literal}, Value: val.Value}, true
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: val.Value}, Value: val.Value}, true
+	case *object.Boolean:
+		if val.Value {
+			return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}, true
+		}
+		return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false}, true
+	case *object.Array:
+		elements := []ast.Expression{}
+		for _, elem := range val.Elements.Values() {
+			code, ok := codeOf(elem)
+			if !ok {
+				return nil, false
+			}
+			elements = append(elements, code)
+		}
+		return &ast.ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Elements: elements}, true
+	}
+	if val == object.NULL {
+		return &ast.Null{}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,36 @@
+package evaluator
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/object"
+)
+
+func evalMatchExpression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		matched, err := object.MatchPatterns(arm.Patterns, subject, env, applier(env.Task()))
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, env)
+			if isError(guard) {
+				return guard
+			}
+			if !object.IsTruthy(guard) {
+				continue
+			}
+		}
+		return Eval(arm.Body, env)
+	}
+
+	return object.NoMatchError(subject)
+}
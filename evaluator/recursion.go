@@ -0,0 +1,38 @@
+package evaluator
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/object"
+)
+
+// tailCall is a call a function ends with. The function returns it instead of
+// making the call, and callFunction makes it in its place, so a function that
+// calls itself in a return doesn't grow the Go stack
+type tailCall struct {
+	fn   *object.Function
+	args *object.Arguments
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+func evalTailCall(call *ast.CallExpression, env *object.Environment) object.Object {
+	function := Eval(call.Function, env)
+	if isError(function) {
+		return function
+	}
+	args, err := evalArguments(call.Arguments, env)
+	if err != nil {
+		return err
+	}
+
+	fn, ok := function.(*object.Function)
+	if !ok {
+		result := callFunction(function, args, env.Task())
+		if isError(result) {
+			return result
+		}
+		return &object.ReturnValue{Value: result}
+	}
+	return &object.ReturnValue{Value: &tailCall{fn: fn, args: args}}
+}
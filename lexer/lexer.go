@@ -7,11 +7,13 @@ type Lexer struct {
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
 	ch           byte // current char under examination
+	line         int  // line of the current char
+	lineStart    int  // position of the first char of the line
 }
 
 // New initiates a new Lexer and returns it
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar() // Initializes position, readPosition and ch in the lexer
 	return l
 }
@@ -19,6 +21,10 @@ func New(input string) *Lexer {
 // readChar move to the next char.
 // if it reaches beyond the last char: l.ch = 0
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // ASCII code for NUL
 	} else {
@@ -29,11 +35,18 @@ func (l *Lexer) readChar() {
 }
 
 // NextToken reads Lexer.ch and convert it to a token.
-// Calls readChar and returns the token.
+// Calls readChar and returns the token, with the position it starts at.
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
 	l.skipWhitespace()
+	pos := token.Position{Line: l.line, Column: l.position - l.lineStart + 1}
+
+	tok := l.nextToken()
+	tok.Pos = pos
+	return tok
+}
+
+func (l *Lexer) nextToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
@@ -42,6 +55,11 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.EQ, Literal: literal}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.ARROW, Literal: literal}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -79,6 +97,11 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.STARTBLOCKCOMMENT, Literal: literal}
+		} else if l.peekChar() == '/' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.FLOOR_DIV, Literal: literal}
 		} else {
 			tok = newToken(token.SLASH, l.ch)
 		}
@@ -88,15 +111,67 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.ENDBLOCKCOMMENT, Literal: literal}
+		} else if l.peekChar() == '*' && l.peekSecondChar() != '/' {
+			// In **/ the second * belongs to the end of a block comment
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.POWER, Literal: literal}
 		} else {
 			tok = newToken(token.ASTERISK, l.ch)
 		}
 	case '%':
 		tok = newToken(token.MODULO, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '<' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.LSHIFT, Literal: literal}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.RSHIFT, Literal: literal}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '?':
+		if l.peekChar() == '?' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.COALESCE, Literal: literal}
+		} else if l.peekChar() == '.' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.OPTIONAL_DOT, Literal: literal}
+		} else if l.peekChar() == '[' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.OPTIONAL_LBRACKET, Literal: literal}
+		} else {
+			tok = newToken(token.QUESTION, l.ch)
+		}
+	case '&':
+		tok = newToken(token.BIT_AND, l.ch)
+	case '|':
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.PIPELINE, Literal: "|>"}
+		} else {
+			tok = newToken(token.BIT_OR, l.ch)
+		}
+	case '^':
+		tok = newToken(token.BIT_XOR, l.ch)
+	case '~':
+		tok = newToken(token.BIT_NOT, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case ';':
@@ -105,6 +180,15 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
+	case '#':
+		if l.peekChar() == '{' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.HASHBRACE, Literal: literal}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
@@ -122,7 +206,13 @@ func (l *Lexer) NextToken() token.Token {
 	case ':':
 		tok = newToken(token.COLON, l.ch)
 	case '.':
-		tok = newToken(token.DOT, l.ch)
+		if l.peekChar() == '.' && l.peekSecondChar() == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
@@ -140,6 +230,12 @@ func (l *Lexer) NextToken() token.Token {
 				tok.Type = token.INT
 			}
 
+			if l.ch == 'd' && !isLetter(l.peekChar()) && !isDigit(l.peekChar()) {
+				l.readChar()
+				tok.Literal += "d"
+				tok.Type = token.DECIMAL
+			}
+
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -196,13 +292,21 @@ func (l *Lexer) readNumber() string {
 
 // Returns the char at readPosition
 func (l *Lexer) peekChar() byte {
-	if l.readPosition > len(l.input) {
+	if l.readPosition >= len(l.input) {
 		return 0
 	} else {
 		return l.input[l.readPosition]
 	}
 }
 
+func (l *Lexer) peekSecondChar() byte {
+	if l.readPosition+1 >= len(l.input) {
+		return 0
+	} else {
+		return l.input[l.readPosition+1]
+	}
+}
+
 func (l *Lexer) readString() string {
 	position := l.position + 1
 
@@ -51,6 +51,17 @@ func TestNextToken(t *testing.T) {
 		var real = 10.4
 		/**/
 		/* */
+		2 ** 3 // 4 & 5 | 6 ^ ~7 << 1 >> 2
+		/** doc **/
+		a ? b : c ?? d?.e?[f]
+		match (g) { h => i }
+		[...j]
+		k |> l
+		const m
+		enum
+		spawn f(n)
+		async await
+		macro quote unquote
 		`
 
 	tests := []struct {
@@ -225,6 +236,68 @@ func TestNextToken(t *testing.T) {
 		{token.ENDBLOCKCOMMENT, "*/"},
 		{token.STARTBLOCKCOMMENT, "/*"},
 		{token.ENDBLOCKCOMMENT, "*/"},
+		{token.INT, "2"},
+		{token.POWER, "**"},
+		{token.INT, "3"},
+		{token.FLOOR_DIV, "//"},
+		{token.INT, "4"},
+		{token.BIT_AND, "&"},
+		{token.INT, "5"},
+		{token.BIT_OR, "|"},
+		{token.INT, "6"},
+		{token.BIT_XOR, "^"},
+		{token.BIT_NOT, "~"},
+		{token.INT, "7"},
+		{token.LSHIFT, "<<"},
+		{token.INT, "1"},
+		{token.RSHIFT, ">>"},
+		{token.INT, "2"},
+		{token.STARTBLOCKCOMMENT, "/*"},
+		{token.ASTERISK, "*"},
+		{token.IDENT, "doc"},
+		{token.ASTERISK, "*"},
+		{token.ENDBLOCKCOMMENT, "*/"},
+		{token.IDENT, "a"},
+		{token.QUESTION, "?"},
+		{token.IDENT, "b"},
+		{token.COLON, ":"},
+		{token.IDENT, "c"},
+		{token.COALESCE, "??"},
+		{token.IDENT, "d"},
+		{token.OPTIONAL_DOT, "?."},
+		{token.IDENT, "e"},
+		{token.OPTIONAL_LBRACKET, "?["},
+		{token.IDENT, "f"},
+		{token.RBRACKET, "]"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "g"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "h"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "i"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "j"},
+		{token.RBRACKET, "]"},
+		{token.IDENT, "k"},
+		{token.PIPELINE, "|>"},
+		{token.IDENT, "l"},
+		{token.CONST, "const"},
+		{token.IDENT, "m"},
+		{token.ENUM, "enum"},
+		{token.SPAWN, "spawn"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.IDENT, "n"},
+		{token.RPAREN, ")"},
+		{token.ASYNC, "async"},
+		{token.AWAIT, "await"},
+		{token.MACRO, "macro"},
+		{token.QUOTE, "quote"},
+		{token.UNQUOTE, "unquote"},
 		{token.EOF, ""},
 	}
 
@@ -245,3 +318,38 @@ func TestNextToken(t *testing.T) {
 
 	}
 }
+
+func TestPositions(t *testing.T) {
+	input := "var x = 5;\n  x +\n\t\"y\""
+
+	tests := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{"var", token.Position{Line: 1, Column: 1}},
+		{"x", token.Position{Line: 1, Column: 5}},
+		{"=", token.Position{Line: 1, Column: 7}},
+		{"5", token.Position{Line: 1, Column: 9}},
+		{";", token.Position{Line: 1, Column: 10}},
+		{"x", token.Position{Line: 2, Column: 3}},
+		{"+", token.Position{Line: 2, Column: 5}},
+		{"y", token.Position{Line: 3, Column: 2}},
+		{"", token.Position{Line: 3, Column: 5}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position of %q wrong. expected=%s, got=%s",
+				i, tok.Literal, tt.expectedPos, tok.Pos)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Package loader loads the classes a program uses without declaring them
+// from their own files, for the evaluator and the vm alike
+package loader
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/lexer"
+	"Pron-Lang/object"
+	"Pron-Lang/parser"
+	"Pron-Lang/resolver"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Class parses the file of the class called name, which is name.pron, and
+// resolves it against env, the frame it runs in. The result of running the
+// program is the class
+func Class(name string, env *object.Environment) (*ast.Program, *object.Error) {
+	absPath, _ := filepath.Abs(name + ".pron")
+	input, err := ioutil.ReadFile(absPath)
+	if err != nil {
+		// There wasn't any other file with the class
+		return nil, &object.Error{Message: fmt.Sprintf("There is no Class called: %s", name)}
+	}
+
+	l := lexer.New(string(input))
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(p.Errors())
+	}
+
+	if errors := resolver.Resolve(program, env); len(errors) != 0 {
+		return nil, &object.Error{Message: errors[0]}
+	}
+	return program, nil
+}
+
+func printParserErrors(errors []string) {
+	out := os.Stdout
+	io.WriteString(out, " parser errors:\n")
+	for _, msg := range errors {
+		io.WriteString(out, "\t"+"- "+msg+"\n")
+	}
+}
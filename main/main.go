@@ -1,11 +1,16 @@
 package main
 
 import (
+	"Pron-Lang/compiler"
 	"Pron-Lang/evaluator"
 	"Pron-Lang/lexer"
 	"Pron-Lang/object"
+	"Pron-Lang/optimizer"
 	"Pron-Lang/parser"
 	"Pron-Lang/repl"
+	"Pron-Lang/resolver"
+	"Pron-Lang/vm"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -21,57 +26,145 @@ func check(e error) {
 }
 
 func main() {
-	out := os.Stdout
-
 	if len(os.Args) > 1 {
 		filename := os.Args[1]
+		useVM := false
+		dumpAST := false
+		arithmetic := object.Arithmetic{}
+
+		// pron run [--vm] [--dump-ast] [--overflow promote|error] [--precision digits] [--rounding mode] [--max-depth calls] filename.pron
+		if filename == "run" {
+			runCmd := flag.NewFlagSet("run", flag.ExitOnError)
+			vmFlag := runCmd.Bool("vm", false, "compile the program to bytecode and run it on the vm")
+			dumpFlag := runCmd.Bool("dump-ast", false, "print the optimized program instead of running it")
+			overflowFlag := runCmd.String("overflow", "promote", "what integer overflow does: promote to a big integer or error")
+			precisionFlag := runCmd.Int("precision", object.DefaultPrecision, "the significant digits of decimal results")
+			roundingFlag := runCmd.String("rounding", "half-even", "how decimal results are rounded: half-even, half-up, half-down, up, down, ceiling or floor")
+			maxDepthFlag := runCmd.Int("max-depth", object.DefaultMaxDepth, "how deep calls can be nested before the program stops")
+			runCmd.Parse(os.Args[2:])
+
+			if runCmd.NArg() != 1 {
+				fmt.Print("ERROR: Usage: pron run [--vm] [--dump-ast] [--overflow promote|error] [--precision digits] [--rounding mode] [--max-depth calls] filename.pron\n")
+				os.Exit(0)
+			}
+			filename = runCmd.Arg(0)
+			useVM = *vmFlag
+			dumpAST = *dumpFlag
+
+			switch *overflowFlag {
+			case "promote":
+			case "error":
+				arithmetic.Overflow = object.ErrorOnOverflow
+			default:
+				fmt.Printf("ERROR: --overflow should be promote or error. got %s\n", *overflowFlag)
+				os.Exit(0)
+			}
+
+			if *precisionFlag < 1 {
+				fmt.Printf("ERROR: --precision should be at least 1. got %d\n", *precisionFlag)
+				os.Exit(0)
+			}
+			arithmetic.Precision = *precisionFlag
+
+			rounding, ok := object.ParseRoundingMode(*roundingFlag)
+			if !ok {
+				fmt.Printf("ERROR: unknown rounding mode: %s\n", *roundingFlag)
+				os.Exit(0)
+			}
+			arithmetic.Rounding = rounding
+
+			if *maxDepthFlag < 1 || *maxDepthFlag > object.MaxDepthLimit {
+				fmt.Printf("ERROR: --max-depth should be between 1 and %d. got %d\n", object.MaxDepthLimit, *maxDepthFlag)
+				os.Exit(0)
+			}
+			object.SetMaxDepth(*maxDepthFlag)
+		}
 
-		docIndex := strings.Index(filename, ".")
+		runFile(filename, useVM, dumpAST, arithmetic)
 
-		// Check for missing fileformat
-		if docIndex == -1 {
-			fmt.Print("ERROR: Missing file type, should be .pron\n")
-			os.Exit(0)
+	} else {
+		// Start REPL
+		user, err := user.Current()
+		if err != nil {
+			panic(err)
 		}
+		fmt.Printf("Hello %s! Welcome to Pron-Lang \n", user.Username)
+		repl.Start(os.Stdin, os.Stdout)
+	}
 
-		fileType := string(filename[docIndex:])
+}
 
-		// Check if fileformat is .pron
-		if fileType != ".pron" {
-			fmt.Print("ERROR: Filetype is not .pron\n")
-			os.Exit(0)
-		}
+func runFile(filename string, useVM, dumpAST bool, arithmetic object.Arithmetic) {
+	out := os.Stdout
 
-		// Run Program
-		input, err := ioutil.ReadFile(filename)
-		check(err)
+	docIndex := strings.Index(filename, ".")
 
-		env := object.NewEnvironment()
+	// Check for missing fileformat
+	if docIndex == -1 {
+		fmt.Print("ERROR: Missing file type, should be .pron\n")
+		os.Exit(0)
+	}
 
-		l := lexer.New(string(input))
-		p := parser.New(l)
+	fileType := string(filename[docIndex:])
 
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			PrintParserErrors(out, p.Errors())
-		}
+	// Check if fileformat is .pron
+	if fileType != ".pron" {
+		fmt.Print("ERROR: Filetype is not .pron\n")
+		os.Exit(0)
+	}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil && evaluated.Inspect() != "null" {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+	// Run Program
+	input, err := ioutil.ReadFile(filename)
+	check(err)
+
+	env := object.NewEnvironment()
+	env.SetArithmetic(arithmetic)
+
+	l := lexer.New(string(input))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		PrintParserErrors(out, p.Errors())
+	}
+
+	// Macros are expanded before anything else looks at the program
+	if errors := evaluator.ExpandMacros(program, object.NewEnvironment()); len(errors) != 0 {
+		PrintMacroErrors(out, errors)
+		os.Exit(0)
+	}
+
+	// Undefined and duplicate variables are reported before anything runs
+	if errors := resolver.Resolve(program, env); len(errors) != 0 {
+		PrintResolverErrors(out, errors)
+		os.Exit(0)
+	}
+
+	optimizer.Optimize(program)
+	if dumpAST {
+		for _, stmt := range program.Statements {
+			io.WriteString(out, stmt.String()+"\n")
 		}
+		return
+	}
 
-	} else {
-		// Start REPL
-		user, err := user.Current()
-		if err != nil {
-			panic(err)
+	var evaluated object.Object
+	if useVM {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			fmt.Fprintf(out, "ERROR: %s\n", err)
+			os.Exit(0)
 		}
-		fmt.Printf("Hello %s! Welcome to Pron-Lang \n", user.Username)
-		repl.Start(os.Stdin, os.Stdout)
+		machine := vm.New(comp.Bytecode(), env)
+		evaluated = machine.Run()
+	} else {
+		evaluated = evaluator.Run(program, env)
 	}
 
+	if evaluated != nil && evaluated.Inspect() != "null" {
+		io.WriteString(out, evaluated.Inspect())
+		io.WriteString(out, "\n")
+	}
 }
 
 func PrintParserErrors(out io.Writer, errors []string) {
@@ -80,3 +173,17 @@ func PrintParserErrors(out io.Writer, errors []string) {
 		io.WriteString(out, "\t"+"- "+msg+"\n")
 	}
 }
+
+func PrintResolverErrors(out io.Writer, errors []string) {
+	io.WriteString(out, " resolver errors:\n")
+	for _, msg := range errors {
+		io.WriteString(out, "\t"+"- "+msg+"\n")
+	}
+}
+
+func PrintMacroErrors(out io.Writer, errors []string) {
+	io.WriteString(out, " macro errors:\n")
+	for _, msg := range errors {
+		io.WriteString(out, "\t"+"- "+msg+"\n")
+	}
+}
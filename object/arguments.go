@@ -0,0 +1,123 @@
+package object
+
+import (
+	"Pron-Lang/ast"
+	"fmt"
+	"strings"
+)
+
+// Arguments are the arguments of a call, with spread arrays taken apart.
+// The vm keeps them on the stack while it calls a function
+type Arguments struct {
+	Positional []Object
+	Names      []string // the names of the named arguments
+	Named      []Object
+}
+
+func (a *Arguments) Type() ObjectType { return "ARGUMENTS" }
+func (a *Arguments) Inspect() string {
+	args := []string{}
+	for _, arg := range a.Positional {
+		args = append(args, arg.Inspect())
+	}
+	for i, name := range a.Names {
+		args = append(args, name+": "+a.Named[i].Inspect())
+	}
+	return "(" + strings.Join(args, ", ") + ")"
+}
+
+// CollectArguments sorts the values of the argument expressions of a call
+// into positional and named arguments, and takes spread arrays apart
+func CollectArguments(exps []ast.Expression, values []Object) (*Arguments, *Error) {
+	args := &Arguments{}
+
+	for i, exp := range exps {
+		switch exp := exp.(type) {
+		case *ast.SpreadExpression:
+			array, ok := values[i].(*Array)
+			if !ok {
+				return nil, newError("cannot spread %s, only an array", values[i].Type())
+			}
+			args.Positional = append(args.Positional, array.Elements.Values()...)
+		case *ast.NamedArgument:
+			args.Names = append(args.Names, exp.Name.Value)
+			args.Named = append(args.Named, values[i])
+		default:
+			args.Positional = append(args.Positional, values[i])
+		}
+	}
+
+	return args, nil
+}
+
+// BindArguments gives every parameter its argument. A parameter that has no
+// argument is left nil to get its default value. The last parameter of a
+// variadic function gets the positional arguments that are left as an array
+func BindArguments(params []*ast.Identifier, defaults []ast.Expression, variadic bool, args *Arguments) ([]Object, *Error) {
+	values := make([]Object, len(params))
+
+	fixed := len(params)
+	positional := args.Positional
+	if variadic {
+		fixed--
+		rest := []Object{}
+		if len(positional) > fixed {
+			rest = positional[fixed:]
+			positional = positional[:fixed]
+		}
+		values[fixed] = NewArray(rest)
+	}
+	if len(positional) > fixed {
+		return nil, arityError(defaults, fixed, variadic, len(positional)+len(args.Named))
+	}
+	copy(values, positional)
+
+	for i, name := range args.Names {
+		index := -1
+		for j, param := range params[:fixed] {
+			if param.Value == name {
+				index = j
+			}
+		}
+		if index == -1 {
+			return nil, newError("unknown argument %s", name)
+		}
+		if values[index] != nil {
+			return nil, newError("argument %s is given more than once", name)
+		}
+		values[index] = args.Named[i]
+	}
+
+	for i, param := range params[:fixed] {
+		if values[i] != nil || hasDefault(defaults, i) {
+			continue
+		}
+		if len(args.Names) != 0 {
+			return nil, newError("missing argument %s", param.Value)
+		}
+		return nil, arityError(defaults, fixed, variadic, len(args.Positional))
+	}
+
+	return values, nil
+}
+
+func hasDefault(defaults []ast.Expression, i int) bool {
+	return i < len(defaults) && defaults[i] != nil
+}
+
+func arityError(defaults []ast.Expression, fixed int, variadic bool, got int) *Error {
+	required := 0
+	for i := 0; i < fixed; i++ {
+		if !hasDefault(defaults, i) {
+			required++
+		}
+	}
+
+	want := fmt.Sprint(required)
+	if variadic {
+		want += " or more"
+	} else if required != fixed {
+		want += fmt.Sprintf(" to %d", fixed)
+	}
+	return newError("wrong number of arguments. got=%d, want=%s", got, want)
+}
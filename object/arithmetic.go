@@ -0,0 +1,302 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+)
+
+func isNumber(obj Object) bool {
+	_, ok := obj.(Number)
+	return ok
+}
+
+// realValue returns a number as a real
+func realValue(obj Object) float64 {
+	return obj.(Number).Float()
+}
+
+// ratValue returns an integer, decimal or rational as an exact fraction
+func ratValue(obj Object) *big.Rat {
+	switch obj := obj.(type) {
+	case *Decimal:
+		return obj.Rat()
+	case *Rational:
+		return obj.Value
+	default:
+		return new(big.Rat).SetInt(bigValue(obj))
+	}
+}
+
+// decimalValue returns an integer or decimal as a decimal
+func decimalValue(obj Object) *Decimal {
+	if decimal, ok := obj.(*Decimal); ok {
+		return decimal
+	}
+	return &Decimal{Coefficient: bigValue(obj), Exponent: 0}
+}
+
+// numberInfix works on numbers of different types. The result is
+// a real when one of them is a real, since a real isn't exact. Otherwise it is
+// a rational when one of them is a rational, and else a decimal.
+// A power is only exact when the exponent is an integer
+func numberInfix(operator string, left, right Object, arithmetic Arithmetic) Object {
+	switch {
+	case left.Type() == REAL_OBJ || right.Type() == REAL_OBJ:
+		return realInfix(operator, left, right)
+	case operator == "**" && !isInteger(right):
+		return realInfix(operator, left, right)
+	case left.Type() == RATIONAL_OBJ || right.Type() == RATIONAL_OBJ:
+		return rationalInfix(operator, left, right)
+	default:
+		return decimalInfix(operator, left, right, arithmetic)
+	}
+}
+
+func rationalInfix(operator string, left, right Object) Object {
+	leftValue := ratValue(left)
+	rightValue := ratValue(right)
+	result := new(big.Rat)
+
+	switch operator {
+	case "+":
+		result.Add(leftValue, rightValue)
+	case "-":
+		result.Sub(leftValue, rightValue)
+	case "*":
+		result.Mul(leftValue, rightValue)
+	case "/":
+		if rightValue.Sign() == 0 {
+			return newError("division by zero")
+		}
+		result.Quo(leftValue, rightValue)
+	case "%":
+		if rightValue.Sign() == 0 {
+			return newError("division by zero")
+		}
+		// Like for integers, the remainder has the sign of the left side
+		quotient := new(big.Rat).Quo(leftValue, rightValue)
+		truncated := new(big.Int).Quo(quotient.Num(), quotient.Denom())
+		result.Sub(leftValue, new(big.Rat).Mul(rightValue, new(big.Rat).SetInt(truncated)))
+	case "//":
+		if rightValue.Sign() == 0 {
+			return newError("division by zero")
+		}
+		quotient := new(big.Rat).Quo(leftValue, rightValue)
+		result.SetInt(floorDivBig(quotient.Num(), quotient.Denom()))
+	case "**":
+		exponent := bigValue(right)
+		if leftValue.Sign() == 0 && exponent.Sign() < 0 {
+			return newError("division by zero")
+		}
+		if powerTooLarge(leftValue.Num(), exponent) || powerTooLarge(leftValue.Denom(), exponent) {
+			return newError("rational too large: %s ** %s", left.Inspect(), right.Inspect())
+		}
+		magnitude := new(big.Int).Abs(exponent)
+		result.SetFrac(new(big.Int).Exp(leftValue.Num(), magnitude, nil), new(big.Int).Exp(leftValue.Denom(), magnitude, nil))
+		if exponent.Sign() < 0 {
+			result.Inv(result)
+		}
+	case "<":
+		return NewBoolean(leftValue.Cmp(rightValue) < 0)
+	case ">":
+		return NewBoolean(leftValue.Cmp(rightValue) > 0)
+	case "==":
+		return NewBoolean(leftValue.Cmp(rightValue) == 0)
+	case "!=":
+		return NewBoolean(leftValue.Cmp(rightValue) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	return &Rational{Value: result}
+}
+
+// decimalInfix rounds the results to the precision of arithmetic
+func decimalInfix(operator string, left, right Object, arithmetic Arithmetic) Object {
+	leftValue := decimalValue(left)
+	rightValue := decimalValue(right)
+	precision := arithmetic.DecimalPrecision()
+
+	switch operator {
+	case "+", "-", "%", "<", ">", "==", "!=":
+		leftCoefficient, rightCoefficient, exponent := alignDecimals(leftValue, rightValue)
+		result := new(big.Int)
+
+		switch operator {
+		case "+":
+			result.Add(leftCoefficient, rightCoefficient)
+		case "-":
+			result.Sub(leftCoefficient, rightCoefficient)
+		case "%":
+			if rightCoefficient.Sign() == 0 {
+				return newError("division by zero")
+			}
+			result.Rem(leftCoefficient, rightCoefficient)
+		case "<":
+			return NewBoolean(leftCoefficient.Cmp(rightCoefficient) < 0)
+		case ">":
+			return NewBoolean(leftCoefficient.Cmp(rightCoefficient) > 0)
+		case "==":
+			return NewBoolean(leftCoefficient.Cmp(rightCoefficient) == 0)
+		case "!=":
+			return NewBoolean(leftCoefficient.Cmp(rightCoefficient) != 0)
+		}
+		return NewDecimal(result, exponent, precision, arithmetic.Rounding)
+
+	case "*":
+		result := new(big.Int).Mul(leftValue.Coefficient, rightValue.Coefficient)
+		return NewDecimal(result, leftValue.Exponent+rightValue.Exponent, precision, arithmetic.Rounding)
+
+	case "/":
+		if rightValue.Coefficient.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return divideDecimals(leftValue, rightValue, arithmetic)
+
+	case "//":
+		if rightValue.Coefficient.Sign() == 0 {
+			return newError("division by zero")
+		}
+		leftCoefficient, rightCoefficient, _ := alignDecimals(leftValue, rightValue)
+		return NewDecimal(floorDivBig(leftCoefficient, rightCoefficient), 0, precision, arithmetic.Rounding)
+
+	case "**":
+		exponent := bigValue(right)
+		if leftValue.Coefficient.Sign() == 0 && exponent.Sign() < 0 {
+			return newError("division by zero")
+		}
+		if powerTooLarge(leftValue.Coefficient, exponent) || leftValue.Exponent != 0 && powerTooLarge(big.NewInt(int64(leftValue.Exponent)), exponent) {
+			return newError("decimal too large: %s ** %s", left.Inspect(), right.Inspect())
+		}
+		magnitude := new(big.Int).Abs(exponent)
+		power := &Decimal{
+			Coefficient: new(big.Int).Exp(leftValue.Coefficient, magnitude, nil),
+			Exponent:    leftValue.Exponent * int(magnitude.Int64()),
+		}
+		if exponent.Sign() < 0 {
+			return divideDecimals(&Decimal{Coefficient: big.NewInt(1), Exponent: 0}, power, arithmetic)
+		}
+		return NewDecimal(power.Coefficient, power.Exponent, precision, arithmetic.Rounding)
+
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// powerTooLarge reports whether base ** exponent would have more than maxIntegerBits bits
+func powerTooLarge(base, exponent *big.Int) bool {
+	if base.CmpAbs(big.NewInt(1)) <= 0 {
+		return false
+	}
+	return !exponent.IsInt64() || int64(base.BitLen()-1)*max(exponent.Int64(), -exponent.Int64()) > maxIntegerBits
+}
+
+// alignDecimals returns the coefficients of left and right for the smallest of their exponents
+func alignDecimals(left, right *Decimal) (*big.Int, *big.Int, int) {
+	exponent := min(left.Exponent, right.Exponent)
+	return shiftCoefficient(left, exponent), shiftCoefficient(right, exponent), exponent
+}
+
+func shiftCoefficient(d *Decimal, exponent int) *big.Int {
+	shift := big.NewInt(int64(d.Exponent - exponent))
+	return shift.Exp(big.NewInt(10), shift, nil).Mul(shift, d.Coefficient)
+}
+
+// divideDecimals gives an exact quotient the exponent left has minus the one of
+// right when it can, so 1.00 / 2 is 0.50. Other quotients are rounded to the precision
+func divideDecimals(left, right *Decimal, arithmetic Arithmetic) Object {
+	precision := arithmetic.DecimalPrecision()
+	ideal := left.Exponent - right.Exponent
+
+	// The quotient gets more digits than the precision, so it can be rounded
+	shift := max(precision+NumDigits(right.Coefficient)-NumDigits(left.Coefficient)+1, 0)
+	dividend := shiftCoefficient(left, left.Exponent-shift)
+	quotient, remainder := new(big.Int).QuoRem(dividend, right.Coefficient, new(big.Int))
+	exponent := ideal - shift
+
+	if remainder.Sign() != 0 {
+		// The digits after the quotient aren't all zero. A 1 after it is rounded the same way
+		sign := left.Coefficient.Sign() * right.Coefficient.Sign()
+		quotient.Mul(quotient, big.NewInt(10)).Add(quotient, big.NewInt(int64(sign)))
+		return NewDecimal(quotient, exponent-1, precision, arithmetic.Rounding)
+	}
+
+	ten := big.NewInt(10)
+	for exponent < ideal && new(big.Int).Rem(quotient, ten).Sign() == 0 {
+		quotient.Quo(quotient, ten)
+		exponent++
+	}
+	return NewDecimal(quotient, exponent, precision, arithmetic.Rounding)
+}
+
+// toDecimal returns a string, integer, real or decimal as a decimal.
+// A real becomes the decimal it is printed as
+func toDecimal(obj Object) (*Decimal, *Error) {
+	switch obj := obj.(type) {
+	case *Integer, *BigInteger, *Decimal:
+		return decimalValue(obj), nil
+	case *String:
+		if decimal, ok := ParseDecimal(obj.Value); ok {
+			return decimal, nil
+		}
+		return nil, newError("could not parse %q as decimal", obj.Value)
+	case *Real:
+		if math.IsInf(obj.Value, 0) || math.IsNaN(obj.Value) {
+			return nil, newError("%s can't be a decimal", obj.Inspect())
+		}
+		decimal, _ := ParseDecimal(strconv.FormatFloat(obj.Value, 'f', -1, 64))
+		return decimal, nil
+	default:
+		return nil, newError("argument to `decimal` must be STRING, INTEGER, REAL or DECIMAL, got %s", obj.Type())
+	}
+}
+
+// toRational returns a string, integer, real, decimal or rational as a rational.
+// A real becomes the fraction it is exactly
+func toRational(obj Object) (*big.Rat, *Error) {
+	switch obj := obj.(type) {
+	case *Integer, *BigInteger, *Decimal, *Rational:
+		return ratValue(obj), nil
+	case *String:
+		if value, ok := new(big.Rat).SetString(obj.Value); ok {
+			return value, nil
+		}
+		return nil, newError("could not parse %q as rational", obj.Value)
+	case *Real:
+		if math.IsInf(obj.Value, 0) || math.IsNaN(obj.Value) {
+			return nil, newError("%s can't be a rational", obj.Inspect())
+		}
+		return new(big.Rat).SetFloat64(obj.Value), nil
+	default:
+		return nil, newError("argument to `rational` must be STRING, INTEGER, REAL, DECIMAL or RATIONAL, got %s", obj.Type())
+	}
+}
+
+// roundNumber rounds a decimal, rational or real to places digits after the point.
+// A rational becomes a decimal
+func roundNumber(value Object, places int, mode RoundingMode) Object {
+	switch value := value.(type) {
+	case *Decimal:
+		return value.Round(places, mode)
+
+	case *Rational:
+		// The quotient gets a digit more than places. When the rest isn't
+		// zero, a 1 after that digit is rounded the same way as the rest
+		numerator := new(big.Int).Mul(value.Value.Num(), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places+1)), nil))
+		quotient, remainder := new(big.Int).QuoRem(numerator, value.Value.Denom(), new(big.Int))
+		quotient.Mul(quotient, big.NewInt(10)).Add(quotient, big.NewInt(int64(remainder.Sign())))
+		decimal := &Decimal{Coefficient: quotient, Exponent: -places - 2}
+		return decimal.Round(places, mode)
+
+	case *Real:
+		decimal, err := toDecimal(value)
+		if err != nil {
+			return value
+		}
+		return &Real{Value: decimal.Round(places, mode).Float()}
+
+	default:
+		return newError("argument to `round` must be DECIMAL, RATIONAL or REAL, got %s", value.Type())
+	}
+}
@@ -0,0 +1,488 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// GetBuiltin returns the builtin function called name
+func GetBuiltin(name string) (*Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+var builtins = map[string]*Builtin{
+	"len": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Array:
+				return &Integer{Value: int64(arg.Elements.Len())}
+			case *Hash:
+				return &Integer{Value: int64(arg.Pairs.Len())}
+			case *Set:
+				return &Integer{Value: int64(arg.Len())}
+			case *String:
+				return &Integer{Value: int64(len(arg.Value))}
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"first": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			if arr.Elements.Len() > 0 {
+				return arr.Elements.Get(0)
+			}
+
+			return NULL
+		},
+	},
+	"last": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := arr.Elements.Len()
+			if length > 0 {
+				return arr.Elements.Get(length - 1)
+			}
+
+			return NULL
+		},
+	},
+	"rest": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := arr.Elements.Len()
+			if length > 0 {
+				return &Array{Elements: arr.Elements.Slice(1, length)}
+			}
+
+			return NULL
+		},
+	},
+	"add": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if args[0].Type() == ARRAY_OBJ {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+
+				// The new array shares the elements of the old one, which is left untouched
+				arr := args[0].(*Array)
+				return &Array{Elements: arr.Elements.Push(args[1])}
+
+			} else if args[0].Type() == HASH_OBJ {
+				if len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=3", len(args))
+				}
+
+				hash := args[0].(*Hash)
+				key, err := AsKey(args[1], apply)
+				if err != nil {
+					return err
+				}
+
+				hash, err = hash.Set(key, args[2])
+				if err != nil {
+					return err
+				}
+				return hash
+
+			} else if args[0].Type() == SET_OBJ {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+
+				set := args[0].(*Set)
+				elem, err := AsKey(args[1], apply)
+				if err != nil {
+					return err
+				}
+
+				set, err = set.Add(elem)
+				if err != nil {
+					return err
+				}
+				return set
+
+			} else {
+				return newError("argument to `add` must be ARRAY, MAP or SET, got %s", args[0].Type())
+			}
+		},
+	},
+	"remove": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if args[0].Type() == ARRAY_OBJ {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+
+				arr := args[0].(*Array)
+
+				length := arr.Elements.Len()
+				if length == 0 {
+					return newError("length of array must be greater than 0")
+				}
+
+				removeIndex := args[1].(*Integer)
+				if removeIndex.Value < int64(0) || int64(length-1) < removeIndex.Value {
+					return newError("index parameter must be between 0 and length of arr - 1")
+				}
+
+				return &Array{Elements: arr.Elements.Remove(int(removeIndex.Value))}
+
+			} else if args[0].Type() == HASH_OBJ {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+
+				hash := args[0].(*Hash)
+
+				length := hash.Pairs.Len()
+				if length == 0 {
+					return newError("cannot remove from empty map")
+				}
+
+				removeKey, err := AsKey(args[1], apply)
+				if err != nil {
+					return err
+				}
+				_, ok, err := hash.Get(removeKey)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return newError("key not found in map")
+				}
+
+				hash, err = hash.Delete(removeKey)
+				if err != nil {
+					return err
+				}
+				return hash
+			} else if args[0].Type() == SET_OBJ {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=2", len(args))
+				}
+
+				set := args[0].(*Set)
+				elem, err := AsKey(args[1], apply)
+				if err != nil {
+					return err
+				}
+				ok, err := set.Contains(elem)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return newError("element not found in set")
+				}
+
+				set, err = set.Remove(elem)
+				if err != nil {
+					return err
+				}
+				return set
+			} else {
+				return newError("argument to `remove` must be ARRAY, MAP or SET, got %s", args[0].Type())
+			}
+
+		},
+	},
+	"set": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) == 0 {
+				return NewSet()
+			}
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *Array:
+				return BuildSet(arg.Elements.Values(), apply)
+			case *Hash:
+				return BuildSet(arg.Keys(), apply)
+			case *Set:
+				return arg
+			default:
+				return newError("argument to `set` must be ARRAY, MAP or SET, got %s", args[0].Type())
+			}
+		},
+	},
+	"union": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			return setOperation("union", args, apply, func(inLeft, inRight bool) bool {
+				return true
+			})
+		},
+	},
+	"intersection": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			return setOperation("intersection", args, apply, func(inLeft, inRight bool) bool {
+				return inLeft && inRight
+			})
+		},
+	},
+	"difference": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			return setOperation("difference", args, apply, func(inLeft, inRight bool) bool {
+				return inLeft && !inRight
+			})
+		},
+	},
+	"subset": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			left, leftOk := args[0].(*Set)
+			right, rightOk := args[1].(*Set)
+			if !leftOk || !rightOk {
+				return newError("arguments to `subset` must be SET, got %s and %s", args[0].Type(), args[1].Type())
+			}
+
+			subset, err := isSubset(left, right, apply)
+			if err != nil {
+				return err
+			}
+			return NewBoolean(subset)
+		},
+	},
+	"decimal": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			decimal, err := toDecimal(args[0])
+			if err != nil {
+				return err
+			}
+			return decimal
+		},
+	},
+	"rational": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			switch len(args) {
+			case 1:
+				value, err := toRational(args[0])
+				if err != nil {
+					return err
+				}
+				return &Rational{Value: value}
+			case 2:
+				if !isInteger(args[0]) || !isInteger(args[1]) {
+					return newError("arguments to `rational` must be INTEGER, got %s and %s", args[0].Type(), args[1].Type())
+				}
+				denominator := bigValue(args[1])
+				if denominator.Sign() == 0 {
+					return newError("division by zero")
+				}
+				return &Rational{Value: new(big.Rat).SetFrac(bigValue(args[0]), denominator)}
+			default:
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+		},
+	},
+	"round": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) < 1 || len(args) > 3 {
+				return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+			}
+
+			places := 0
+			if len(args) > 1 {
+				integer, ok := args[1].(*Integer)
+				if !ok {
+					return newError("places of `round` must be INTEGER, got %s", args[1].Type())
+				}
+				places = int(integer.Value)
+			}
+
+			mode := RoundHalfEven
+			if len(args) > 2 {
+				name, ok := args[2].(*String)
+				if !ok {
+					return newError("rounding mode of `round` must be STRING, got %s", args[2].Type())
+				}
+				if mode, ok = ParseRoundingMode(name.Value); !ok {
+					return newError("unknown rounding mode: %s", name.Value)
+				}
+			}
+
+			return roundNumber(args[0], places, mode)
+		},
+	},
+	"copy": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			return copyObject(args[0], false, map[Object]Object{})
+		},
+	},
+	"deepcopy": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			return copyObject(args[0], true, map[Object]Object{})
+		},
+	},
+	"freeze": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			freezeObject(args[0])
+			return args[0]
+		},
+	},
+	"compose": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) == 0 {
+				return newError("wrong number of arguments. got=0, want=1 or more")
+			}
+			if err := checkFunctions("compose", args); err != nil {
+				return err
+			}
+
+			functions := args
+			// compose(f, g)(x) is f(g(x))
+			return &Builtin{Fn: func(apply Applier, args ...Object) Object {
+				result := apply(functions[len(functions)-1], args)
+				for i := len(functions) - 2; i >= 0 && !isError(result); i-- {
+					result = apply(functions[i], []Object{result})
+				}
+				return result
+			}}
+		},
+	},
+	"partial": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			if len(args) == 0 {
+				return newError("wrong number of arguments. got=0, want=1 or more")
+			}
+			if err := checkFunctions("partial", args[:1]); err != nil {
+				return err
+			}
+
+			function := args[0]
+			bound := args[1:]
+			// partial(f, a)(b) is f(a, b)
+			return &Builtin{Fn: func(apply Applier, args ...Object) Object {
+				return apply(function, append(append([]Object{}, bound...), args...))
+			}}
+		},
+	},
+	"channel": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			return newChannel(args)
+		},
+	},
+	"send": &Builtin{
+		TaskFn: func(task *Task, apply Applier, args ...Object) Object {
+			return send(task, args)
+		},
+	},
+	"receive": &Builtin{
+		TaskFn: func(task *Task, apply Applier, args ...Object) Object {
+			return receive(task, args)
+		},
+	},
+	"close": &Builtin{
+		TaskFn: func(task *Task, apply Applier, args ...Object) Object {
+			return closeChannel(task, args)
+		},
+	},
+	"select": &Builtin{
+		TaskFn: func(task *Task, apply Applier, args ...Object) Object {
+			return selectChannel(task, args)
+		},
+	},
+	"wait": &Builtin{
+		TaskFn: func(task *Task, apply Applier, args ...Object) Object {
+			return wait(task, args)
+		},
+	},
+	"setTimeout": &Builtin{
+		TaskFn: func(task *Task, apply Applier, args ...Object) Object {
+			return setTimer("setTimeout", task, args)
+		},
+	},
+	"setInterval": &Builtin{
+		TaskFn: func(task *Task, apply Applier, args ...Object) Object {
+			return setTimer("setInterval", task, args)
+		},
+	},
+	"clearTimeout": &Builtin{
+		TaskFn: func(task *Task, apply Applier, args ...Object) Object {
+			return clearTimer("clearTimeout", task, args)
+		},
+	},
+	"clearInterval": &Builtin{
+		TaskFn: func(task *Task, apply Applier, args ...Object) Object {
+			return clearTimer("clearInterval", task, args)
+		},
+	},
+	"sleep": &Builtin{
+		TaskFn: func(task *Task, apply Applier, args ...Object) Object {
+			return sleep(task, args)
+		},
+	},
+	"now": &Builtin{
+		TaskFn: func(task *Task, apply Applier, args ...Object) Object {
+			return now(task, args)
+		},
+	},
+	"print": &Builtin{
+		Fn: func(apply Applier, args ...Object) Object {
+			for _, arg := range args {
+				fmt.Println(arg.Inspect())
+			}
+
+			return NULL
+		},
+	},
+}
+
+func checkFunctions(builtin string, args []Object) *Error {
+	for _, arg := range args {
+		if arg.Type() != FUNCTION_OBJ && arg.Type() != BUILTIN_OBJ {
+			return newError("argument to `%s` must be FUNCTION, got %s", builtin, arg.Type())
+		}
+	}
+	return nil
+}
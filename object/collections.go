@@ -0,0 +1,212 @@
+package object
+
+import (
+	"strings"
+)
+
+// maxRepeatedLength limits the strings and arrays * makes, so a typo like
+// [0] * 10000000000 is an error instead of using up all the memory
+const maxRepeatedLength = 1 << 26
+
+// contains looks for an element of an array or a set, a key of a hash,
+// or a substring of a string
+func contains(left, right Object, apply Applier) Object {
+	switch right := right.(type) {
+	case *Array:
+		c := newComparison(apply)
+		for _, elem := range right.Elements.Values() {
+			equal, err := c.equal(left, elem)
+			if err != nil {
+				return err
+			}
+			if equal {
+				return TRUE
+			}
+		}
+		return FALSE
+
+	case *Hash:
+		key, err := AsKey(left, apply)
+		if err != nil {
+			return err
+		}
+		_, ok, err := right.Get(key)
+		if err != nil {
+			return err
+		}
+		return NewBoolean(ok)
+
+	case *Set:
+		key, err := AsKey(left, apply)
+		if err != nil {
+			return err
+		}
+		ok, err := right.Contains(key)
+		if err != nil {
+			return err
+		}
+		return NewBoolean(ok)
+
+	case *String:
+		substring, ok := left.(*String)
+		if !ok {
+			return newError("unknown operator: %s in %s", left.Type(), right.Type())
+		}
+		return NewBoolean(strings.Contains(right.Value, substring.Value))
+
+	default:
+		return newError("unknown operator: %s in %s", left.Type(), right.Type())
+	}
+}
+
+// arrayInfix concatenates and compares arrays. Arrays are compared
+// element by element, and an array that runs out first is the smaller one
+func arrayInfix(operator string, left, right Object, apply Applier) Object {
+	leftArray := left.(*Array)
+	rightArray := right.(*Array)
+
+	switch operator {
+	case "+":
+		return &Array{Elements: leftArray.Elements.Concat(rightArray.Elements)}
+	case "<":
+		return compareArrays(leftArray, rightArray, apply)
+	case ">":
+		return compareArrays(rightArray, leftArray, apply)
+	case "==", "!=":
+		return equality(operator, left, right, apply)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// compareArrays returns whether left < right. The first elements that aren't
+// equal decide it, so they have to be comparable with <
+func compareArrays(left, right *Array, apply Applier) Object {
+	c := newComparison(apply)
+	leftElements := left.Elements.Values()
+	rightElements := right.Elements.Values()
+
+	for i := 0; i < len(leftElements) && i < len(rightElements); i++ {
+		equal, err := c.equal(leftElements[i], rightElements[i])
+		if err != nil {
+			return err
+		}
+		if !equal {
+			return Infix("<", leftElements[i], rightElements[i], apply, Arithmetic{})
+		}
+	}
+	return NewBoolean(len(leftElements) < len(rightElements))
+}
+
+// hashInfix merges hashes with +. When both have a key, the value of the right one is kept
+func hashInfix(operator string, left, right Object, apply Applier) Object {
+	switch operator {
+	case "+":
+		result := left.(*Hash)
+		for _, pair := range right.(*Hash).Pairs.Pairs() {
+			key, err := AsKey(pair.Key, apply)
+			if err != nil {
+				return err
+			}
+			result, err = result.Set(key, pair.Value)
+			if err != nil {
+				return err
+			}
+		}
+		return result
+	case "==", "!=":
+		return equality(operator, left, right, apply)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isRepeatable(obj Object) bool {
+	return obj.Type() == STRING_OBJ || obj.Type() == ARRAY_OBJ
+}
+
+// repetition repeats a string or an array, like "ab" * 3 or 3 * "ab"
+func repetition(left, right Object) Object {
+	sequence, count := left, right
+	if isInteger(left) {
+		sequence, count = right, left
+	}
+
+	integer, ok := count.(*Integer)
+	if !ok {
+		return newError("repetition too large: %s * %s", left.Inspect(), right.Inspect())
+	}
+	if integer.Value < 0 {
+		return newError("negative repetition count: %d", integer.Value)
+	}
+	times := int(integer.Value)
+
+	switch sequence := sequence.(type) {
+	case *String:
+		if len(sequence.Value) > 0 && times > maxRepeatedLength/len(sequence.Value) {
+			return newError("repetition too large: %d * %d characters", times, len(sequence.Value))
+		}
+		return &String{Value: strings.Repeat(sequence.Value, times)}
+
+	default:
+		elements := sequence.(*Array).Elements.Values()
+		if len(elements) > 0 && times > maxRepeatedLength/len(elements) {
+			return newError("repetition too large: %d * %d elements", times, len(elements))
+		}
+		repeated := make([]Object, 0, len(elements)*times)
+		for range times {
+			repeated = append(repeated, elements...)
+		}
+		return NewArray(repeated)
+	}
+}
+
+// LoopElements returns the elements a forloop goes through: the elements of
+// an array, or the keys of a hash in the order they were added
+func LoopElements(obj Object) ([]Object, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.Elements.Values(), true
+	case *Hash:
+		return obj.Keys(), true
+	case *Set:
+		return obj.Values(), true
+	case *Enum:
+		members := []Object{}
+		for _, member := range obj.Members {
+			members = append(members, member)
+		}
+		return members, true
+	default:
+		return nil, false
+	}
+}
+
+// ComprehensionRows are the values the variables of a comprehension take in
+// turn. One variable goes through the elements like a forloop does. Two
+// variables get the keys and values of a hash, or the indexes and elements
+// of an array, as [key, value] arrays
+func ComprehensionRows(iterable Object, variables int) ([]Object, *Error) {
+	if variables == 1 {
+		elements, ok := LoopElements(iterable)
+		if !ok {
+			return nil, newError("'in' expression in comprehension was not array, hash or set. got=%s", iterable.Type())
+		}
+		return elements, nil
+	}
+
+	rows := []Object{}
+	switch iterable := iterable.(type) {
+	case *Hash:
+		for _, pair := range iterable.Pairs.Pairs() {
+			rows = append(rows, NewArray([]Object{pair.Key, pair.Value}))
+		}
+	case *Array:
+		for i, elem := range iterable.Elements.Values() {
+			rows = append(rows, NewArray([]Object{&Integer{Value: int64(i)}, elem}))
+		}
+	default:
+		return nil, newError("a comprehension with two variables needs an array or a hash. got=%s", iterable.Type())
+	}
+	return rows, nil
+}
@@ -0,0 +1,81 @@
+package object
+
+// GetMember returns the member of the enum obj, which is called objectName
+func GetMember(obj Object, objectName, name string) Object {
+	enum, ok := obj.(*Enum)
+	if !ok {
+		return newError("%s is not an enum. It's a %s", objectName, obj.Type())
+	}
+	member, ok := enum.Member(name)
+	if !ok {
+		return newError("%s has no member called %s", enum.Name, name)
+	}
+	return member
+}
+
+// EnumMethod returns the method called name of an enum or an enum member,
+// or an error when it has no such method. ok is false when obj is neither
+func EnumMethod(obj Object, name string) (method Object, ok bool) {
+	switch obj := obj.(type) {
+	case *Enum:
+		switch name {
+		case "Values":
+			return enumBuiltin(0, func(args []Object) Object {
+				members := []Object{}
+				for _, member := range obj.Members {
+					members = append(members, member)
+				}
+				return NewArray(members)
+			}), true
+
+		case "FromName":
+			return enumBuiltin(1, func(args []Object) Object {
+				memberName, ok := args[0].(*String)
+				if !ok {
+					return newError("argument to `FromName` must be STRING, got %s", args[0].Type())
+				}
+				return GetMember(obj, obj.Name, memberName.Value)
+			}), true
+
+		case "FromOrdinal":
+			return enumBuiltin(1, func(args []Object) Object {
+				ordinal, ok := args[0].(*Integer)
+				if !ok {
+					return newError("argument to `FromOrdinal` must be INTEGER, got %s", args[0].Type())
+				}
+				if ordinal.Value < 0 || ordinal.Value >= int64(len(obj.Members)) {
+					return newError("%s has no member with ordinal %d", obj.Name, ordinal.Value)
+				}
+				return obj.Members[ordinal.Value]
+			}), true
+		}
+
+	case *EnumMember:
+		switch name {
+		case "Name":
+			return enumBuiltin(0, func(args []Object) Object {
+				return &String{Value: obj.Name}
+			}), true
+
+		case "Ordinal":
+			return enumBuiltin(0, func(args []Object) Object {
+				return &Integer{Value: int64(obj.Ordinal)}
+			}), true
+		}
+
+	default:
+		return nil, false
+	}
+
+	return newError("%s is not a defined method", name), true
+}
+
+// enumBuiltin makes a method of an enum that takes want arguments
+func enumBuiltin(want int, fn func(args []Object) Object) *Builtin {
+	return &Builtin{Fn: func(apply Applier, args ...Object) Object {
+		if len(args) != want {
+			return newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+		}
+		return fn(args)
+	}}
+}
@@ -1,76 +1,498 @@
 package object
 
+import (
+	"Pron-Lang/ast"
+	"sync"
+	"sync/atomic"
+)
+
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: []Object{}, names: []string{}, outer: nil, task: NewTask()}
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
+	return &Environment{store: []Object{}, names: []string{}, outer: outer,
+		arithmetic: outer.arithmetic, task: outer.task}
+}
+
+// NewEnclosedFrame creates an environment with a slot for every name in locals.
+// locals is shared with the resolved ast node and is never written to.
+func NewEnclosedFrame(outer *Environment, locals []string) *Environment {
+	store := make([]Object, len(locals))
+	env := &Environment{store: store, names: locals[:len(locals):len(locals)], outer: outer}
+	if outer != nil {
+		env.arithmetic = outer.arithmetic
+		env.task = outer.task
+	}
 	return env
 }
 
+// Environment is a frame of slots. The resolver gives every variable a
+// (depth, slot) pair, but the names are kept so unresolved code still works.
+// Once a second task runs, tasks can share frames, so every method locks
+// the frames it uses.
 type Environment struct {
-	store map[string]Object
+	store []Object
+	names []string // names[i] is the name of the value in store[i]
 	outer *Environment
+
+	constants []bool // constants[i] is true when store[i] is declared with const
+	frozen    bool   // no slot of a frozen environment can be assigned
+
+	// arithmetic is set on the environment of a program and shared with every
+	// environment made inside it, so each interpreter can have its own. Nil
+	// is the default arithmetic
+	arithmetic *Arithmetic
+
+	// task is the task the code of this frame runs in. A function call
+	// gets the task of its caller rather than of the env it was made in
+	task *Task
+
+	// shared is made when tasks first use the frame, so a program that runs
+	// in one task doesn't make it for every frame
+	shared atomic.Pointer[sharing]
+}
+
+// sharing is what tasks that share a frame need
+type sharing struct {
+	mu     sync.RWMutex
+	writes []epoch // writes[i] is when a task last assigned store[i]
+}
+
+func (e *Environment) sharing() *sharing {
+	if shared := e.shared.Load(); shared != nil {
+		return shared
+	}
+	e.shared.CompareAndSwap(nil, &sharing{})
+	return e.shared.Load()
+}
+
+// lock locks the frame for writing, if tasks run. Returns false if it didn't
+func (e *Environment) lock() bool {
+	if !e.concurrent() {
+		return false
+	}
+	e.sharing().mu.Lock()
+	return true
+}
+
+func (e *Environment) unlock() {
+	e.shared.Load().mu.Unlock()
+}
+
+// rlock locks the frame for reading, if tasks run. Returns false if it didn't
+func (e *Environment) rlock() bool {
+	if !e.concurrent() {
+		return false
+	}
+	e.sharing().mu.RLock()
+	return true
+}
+
+func (e *Environment) runlock() {
+	e.shared.Load().mu.RUnlock()
+}
+
+// concurrent tells whether the program of the frame runs more than one task
+func (e *Environment) concurrent() bool {
+	return e.task != nil && e.task.Concurrent()
+}
+
+// Task returns the task the code of this frame runs in
+func (e *Environment) Task() *Task {
+	return e.task
+}
+
+// SetTask decides the task the code of this frame and the frames made
+// inside it later run in
+func (e *Environment) SetTask(task *Task) {
+	e.task = task
+}
+
+// RaceAt records that task assigns the slot of the environment depth frames
+// out. Returns true when another task assigned it last without task having
+// waited for it, since the two assignments race
+func (e *Environment) RaceAt(depth, slot int, task *Task) bool {
+	if !e.concurrent() {
+		return false
+	}
+	shared := e.ancestor(depth).sharing()
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+
+	for slot >= len(shared.writes) {
+		shared.writes = append(shared.writes, epoch{})
+	}
+	last := shared.writes[slot]
+	shared.writes[slot] = task.now()
+	return last.task != 0 && !task.happenedBefore(last)
+}
+
+// Arithmetic returns how numbers are computed in this environment
+func (e *Environment) Arithmetic() Arithmetic {
+	if e.arithmetic == nil {
+		return Arithmetic{}
+	}
+	return *e.arithmetic
+}
+
+// SetArithmetic decides how numbers are computed in this environment
+// and the environments that are made inside it later
+func (e *Environment) SetArithmetic(arithmetic Arithmetic) {
+	e.arithmetic = &arithmetic
+}
+
+// SetClock decides the clock the timers of the program in this environment run on
+func (e *Environment) SetClock(clock Clock) {
+	e.task.Loop.SetClock(clock)
+}
+
+// The methods that every variable uses have a path without locks, which
+// stays small enough to inline, and one that locks once tasks run
+
+// GetAt returns the value in the given slot of the environment depth frames out
+func (e *Environment) GetAt(depth, slot int) (Object, bool) {
+	frame := e.ancestor(depth)
+	if frame.concurrent() {
+		return frame.getLocked(slot)
+	}
+	return frame.get(slot)
+}
+
+func (e *Environment) get(slot int) (Object, bool) {
+	if slot >= len(e.store) || e.store[slot] == nil {
+		return nil, false
+	}
+	return e.store[slot], true
+}
+
+func (e *Environment) getLocked(slot int) (Object, bool) {
+	e.rlock()
+	defer e.runlock()
+	return e.get(slot)
+}
+
+// Define binds val to the given slot in this frame, growing it when needed
+func (e *Environment) Define(slot int, name string, val Object) Object {
+	if e.concurrent() {
+		return e.defineLocked(slot, name, val)
+	}
+	return e.define(slot, name, val)
+}
+
+func (e *Environment) defineLocked(slot int, name string, val Object) Object {
+	e.lock()
+	defer e.unlock()
+	return e.define(slot, name, val)
+}
+
+func (e *Environment) define(slot int, name string, val Object) Object {
+	e.setConstant(slot, false)
+	if slot >= len(e.store) {
+		for slot > len(e.store) {
+			e.store = append(e.store, nil)
+			e.names = append(e.names, "")
+		}
+		e.store = append(e.store, val)
+		e.names = append(e.names, name)
+		return val
+	}
+	if e.names[slot] != name {
+		e.names = append([]string{}, e.names...)
+		e.names[slot] = name
+	}
+	e.store[slot] = val
+	return val
+}
+
+// DefineConstant binds val to the given slot like Define, and keeps it
+// from being assigned again
+func (e *Environment) DefineConstant(slot int, name string, val Object) Object {
+	if e.lock() {
+		defer e.unlock()
+	}
+	e.define(slot, name, val)
+	e.setConstant(slot, true)
+	return val
+}
+
+func (e *Environment) setConstant(slot int, constant bool) {
+	if !constant && slot >= len(e.constants) {
+		return
+	}
+	for slot >= len(e.constants) {
+		e.constants = append(e.constants, false)
+	}
+	e.constants[slot] = constant
+}
+
+// Mutability tells whether a variable can be assigned
+type Mutability int
+
+const (
+	Mutable  Mutability = iota
+	Constant            // declared with const
+	Frozen              // a field of a frozen instance
+)
+
+func (e *Environment) mutability(slot int) Mutability {
+	if e.concurrent() {
+		return e.mutabilityLocked(slot)
+	}
+	return e.mutabilityOf(slot)
+}
+
+func (e *Environment) mutabilityLocked(slot int) Mutability {
+	e.rlock()
+	defer e.runlock()
+	return e.mutabilityOf(slot)
+}
+
+func (e *Environment) mutabilityOf(slot int) Mutability {
+	if e.frozen {
+		return Frozen
+	}
+	if slot < len(e.constants) && e.constants[slot] {
+		return Constant
+	}
+	return Mutable
+}
+
+// MutabilityAt tells whether the slot of the environment depth frames
+// out can be assigned
+func (e *Environment) MutabilityAt(depth, slot int) Mutability {
+	return e.ancestor(depth).mutability(slot)
+}
+
+// Mutability tells whether the variable Update would assign can be assigned
+func (e *Environment) Mutability(name string) Mutability {
+	if slot := e.find(name); slot != -1 {
+		return e.mutability(slot)
+	}
+	if e.outer != nil {
+		return e.outer.Mutability(name)
+	}
+	return Mutable
+}
+
+// MutabilityOuterMost tells whether the variable UpdateOuterMost would
+// assign can be assigned
+func (e *Environment) MutabilityOuterMost(name string) Mutability {
+	if e.outer != nil {
+		return e.outer.MutabilityOuterMost(name)
+	}
+	if slot := e.find(name); slot != -1 {
+		return e.mutability(slot)
+	}
+	return Mutable
+}
+
+// Freeze keeps every slot of this frame from being assigned again
+func (e *Environment) Freeze() {
+	if e.lock() {
+		defer e.unlock()
+	}
+	e.frozen = true
+}
+
+func (e *Environment) Frozen() bool {
+	if e.rlock() {
+		defer e.runlock()
+	}
+	return e.frozen
+}
+
+// Assign overwrites a slot that has already been defined
+func (e *Environment) Assign(depth, slot int, val Object) bool {
+	frame := e.ancestor(depth)
+	if frame.concurrent() {
+		return frame.assignLocked(slot, val)
+	}
+	return frame.assign(slot, val)
+}
+
+func (e *Environment) assign(slot int, val Object) bool {
+	if slot >= len(e.store) || e.store[slot] == nil {
+		return false
+	}
+	e.store[slot] = val
+	return true
+}
+
+func (e *Environment) assignLocked(slot int, val Object) bool {
+	e.lock()
+	defer e.unlock()
+	return e.assign(slot, val)
+}
+
+// Names returns the names of the slots in this frame
+func (e *Environment) Names() []string {
+	if e.rlock() {
+		defer e.runlock()
+	}
+	return e.names[:len(e.names):len(e.names)]
+}
+
+// Values returns a copy of the values of the slots in this frame. A slot
+// that hasn't been defined yet is nil
+func (e *Environment) Values() []Object {
+	if e.rlock() {
+		defer e.runlock()
+	}
+	return append([]Object{}, e.store...)
+}
+
+func (e *Environment) ancestor(depth int) *Environment {
+	frame := e
+	for i := 0; i < depth; i++ {
+		frame = frame.outer
+	}
+	return frame
+}
+
+// find returns the slot of name in this frame or -1
+func (e *Environment) find(name string) int {
+	if e.rlock() {
+		defer e.runlock()
+	}
+	return e.lookup(name)
+}
+
+// lookup returns the slot of name in this frame or -1. The frame must be locked
+func (e *Environment) lookup(name string) int {
+	for i := len(e.names) - 1; i >= 0; i-- {
+		if e.names[i] == name && e.store[i] != nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// getHere returns the value of name in this frame
+func (e *Environment) getHere(name string) (Object, bool) {
+	if e.rlock() {
+		defer e.runlock()
+	}
+	if slot := e.lookup(name); slot != -1 {
+		return e.store[slot], true
+	}
+	return nil, false
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	if val, ok := e.getHere(name); ok {
+		return val, true
 	}
-	return obj, ok
+	if e.outer != nil {
+		return e.outer.Get(name)
+	}
+	return nil, false
 }
 
 func (e *Environment) GetOuterMost(name string) (Object, bool) {
 	if e.outer != nil {
 		return e.outer.GetOuterMost(name)
 	}
+	return e.getHere(name)
+}
+
+// GetIdentifier finds the value of ident in its resolved slot,
+// or by name if the resolver hasn't seen it
+func (e *Environment) GetIdentifier(ident *ast.Identifier) (Object, bool) {
+	if ident.Resolved {
+		return e.GetAt(ident.Depth, ident.Slot)
+	}
+	if ident.HasThisPrefix {
+		return e.GetOuterMost(ident.Value)
+	}
+	return e.Get(ident.Value)
+}
+
+// Declare binds val to ident in this frame
+func (e *Environment) Declare(ident *ast.Identifier, val Object) {
+	if ident.Resolved {
+		e.Define(ident.Slot, ident.Value, val)
+	} else {
+		e.Set(ident.Value, val)
+	}
+}
 
-	obj, ok := e.store[name]
-	return obj, ok
+// DeclareConstant binds val to ident in this frame like Declare, and keeps
+// it from being assigned again
+func (e *Environment) DeclareConstant(ident *ast.Identifier, val Object) {
+	if ident.Resolved {
+		e.DefineConstant(ident.Slot, ident.Value, val)
+	} else {
+		e.SetConstant(ident.Value, val)
+	}
 }
 
 func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val
+	if e.lock() {
+		defer e.unlock()
+	}
+	return e.set(name, val)
+}
+
+func (e *Environment) set(name string, val Object) Object {
+	for i := len(e.names) - 1; i >= 0; i-- {
+		if e.names[i] == name {
+			e.store[i] = val
+			e.setConstant(i, false)
+			return val
+		}
+	}
+	return e.define(len(e.store), name, val)
+}
+
+// SetConstant binds val to name like Set, and keeps it from being assigned again
+func (e *Environment) SetConstant(name string, val Object) Object {
+	if e.lock() {
+		defer e.unlock()
+	}
+	e.set(name, val)
+	e.setConstant(e.lookup(name), true)
 	return val
 }
 
+// updateHere assigns val to name in this frame. Returns false if name isn't in it
+func (e *Environment) updateHere(name string, val Object) bool {
+	if e.lock() {
+		defer e.unlock()
+	}
+	if slot := e.lookup(name); slot != -1 {
+		e.store[slot] = val
+		return true
+	}
+	return false
+}
+
 func (e *Environment) Update(name string, val Object) bool {
-	_, ok := e.store[name]
-	if !ok && e.outer != nil {
-		ok = e.outer.Update(name, val)
-	} else {
-		e.Set(name, val)
+	if e.updateHere(name, val) {
+		return true
 	}
-	return ok
+	if e.outer != nil {
+		return e.outer.Update(name, val)
+	}
+	return false
 }
 
 func (e *Environment) UpdateOuterMost(name string, val Object) bool {
 	if e.outer != nil {
 		return e.outer.UpdateOuterMost(name, val)
 	}
-
-	_, ok := e.store[name]
-	if ok {
-		e.Set(name, val)
-	}
-
-	return ok
+	return e.updateHere(name, val)
 }
 
 func (e *Environment) GetCopyOfEnvWithOuterEnvNil() *Environment {
-	newEnv := &Environment{}
-
-	newStore := map[string]Object{}
-
-	for key, value := range e.store {
-		newStore[key] = value
+	if e.rlock() {
+		defer e.runlock()
 	}
+	newEnv := &Environment{arithmetic: e.arithmetic, task: e.task}
 
-	newEnv.store = newStore
+	newEnv.store = append([]Object{}, e.store...)
+	newEnv.names = append([]string{}, e.names...)
+	newEnv.constants = append([]bool(nil), e.constants...)
 
 	return newEnv
 }
@@ -0,0 +1,345 @@
+package object
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+)
+
+// comparison compares two values structurally. It remembers the instances
+// it is comparing, since an instance can hold itself through its fields
+type comparison struct {
+	apply     Applier
+	comparing map[[2]*ClassInstance]bool
+}
+
+func newComparison(apply Applier) *comparison {
+	return &comparison{apply: apply, comparing: map[[2]*ClassInstance]bool{}}
+}
+
+func equality(operator string, left, right Object, apply Applier) Object {
+	equal, err := newComparison(apply).equal(left, right)
+	if err != nil {
+		return err
+	}
+
+	if operator == "!=" {
+		return NewBoolean(!equal)
+	}
+	return NewBoolean(equal)
+}
+
+func (c *comparison) equal(left, right Object) (bool, *Error) {
+	if left == right {
+		return true, nil
+	}
+
+	switch left := left.(type) {
+	case *Array:
+		right, ok := right.(*Array)
+		if !ok {
+			return false, nil
+		}
+		return c.equalArrays(left, right)
+	case *Hash:
+		right, ok := right.(*Hash)
+		if !ok {
+			return false, nil
+		}
+		return c.equalHashes(left, right)
+	case *Set:
+		right, ok := right.(*Set)
+		if !ok || left.Len() != right.Len() {
+			return false, nil
+		}
+		return isSubset(left, right, c.apply)
+	case *ClassInstance:
+		right, ok := right.(*ClassInstance)
+		if !ok {
+			return false, nil
+		}
+		return c.equalInstances(left, right)
+	}
+
+	switch left.(type) {
+	case Number, *String:
+		// Values in a structure that can't be compared, like 1 and "1", are just different
+		return Infix("==", left, right, c.apply, Arithmetic{}) == TRUE, nil
+	default:
+		return false, nil
+	}
+}
+
+func (c *comparison) equalArrays(left, right *Array) (bool, *Error) {
+	if left.Elements.Len() != right.Elements.Len() {
+		return false, nil
+	}
+
+	rightElements := right.Elements.Values()
+	for i, elem := range left.Elements.Values() {
+		if equal, err := c.equal(elem, rightElements[i]); !equal || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// equalHashes doesn't care about the order of the pairs
+func (c *comparison) equalHashes(left, right *Hash) (bool, *Error) {
+	if left.Pairs.Len() != right.Pairs.Len() {
+		return false, nil
+	}
+
+	for _, pair := range left.Pairs.Pairs() {
+		key, err := AsKey(pair.Key, c.apply)
+		if err != nil {
+			return false, err
+		}
+		rightPair, ok, err := right.Get(key)
+		if !ok || err != nil {
+			return false, err
+		}
+		if equal, err := c.equal(pair.Value, rightPair.Value); !equal || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// equalInstances uses the Equals method of the class when it has one.
+// Otherwise instances of the same class are equal when their fields are
+func (c *comparison) equalInstances(left, right *ClassInstance) (bool, *Error) {
+	if left.Name != right.Name {
+		return false, nil
+	}
+
+	// Two instances that are already being compared are equal, unless
+	// something else about them is different
+	pair := [2]*ClassInstance{left, right}
+	if c.comparing[pair] {
+		return true, nil
+	}
+	c.comparing[pair] = true
+	defer delete(c.comparing, pair)
+
+	if equals, ok := publicMethod(left, "Equals"); ok {
+		result := c.apply(equals, []Object{right})
+		if err, ok := result.(*Error); ok {
+			return false, err
+		}
+		return IsTruthy(result), nil
+	}
+
+	leftNames := left.Env.Names()
+	rightNames := right.Env.Names()
+	leftValues := left.Env.Values()
+	rightValues := right.Env.Values()
+	if len(leftNames) != len(rightNames) {
+		return false, nil
+	}
+
+	for i, name := range leftNames {
+		if name != rightNames[i] {
+			return false, nil
+		}
+		if isMethod(left, leftValues[i]) && isMethod(right, rightValues[i]) {
+			continue
+		}
+		if equal, err := c.equal(leftValues[i], rightValues[i]); !equal || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// publicMethod returns the public method with the given name, for both the evaluator and the vm
+func publicMethod(instance *ClassInstance, name string) (Object, bool) {
+	method, ok := instance.Env.Get(name)
+	if !ok {
+		return nil, false
+	}
+
+	switch method := method.(type) {
+	case *Function:
+		return method, method.IsPublic
+	case *Closure:
+		return method, method.Fn.IsPublic && method.Fn.ThisParams == nil
+	default:
+		return nil, false
+	}
+}
+
+// isMethod reports whether value is a method bound to instance
+func isMethod(instance *ClassInstance, value Object) bool {
+	switch value := value.(type) {
+	case *Function:
+		return value.Env == instance.Env
+	case *InitFunction:
+		return value.Env == instance.Env
+	case *Closure:
+		return value.Env == instance.Env
+	default:
+		return false
+	}
+}
+
+// copyObject returns a copy of obj. A deep copy also copies the values inside
+// obj, and copies a value that occurs more than once, or inside itself, only once
+func copyObject(obj Object, deep bool, copies map[Object]Object) Object {
+	if copied, ok := copies[obj]; ok {
+		return copied
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		if !deep {
+			return &Array{Elements: obj.Elements}
+		}
+		elements := []Object{}
+		for _, elem := range obj.Elements.Values() {
+			elements = append(elements, copyObject(elem, deep, copies))
+		}
+		return NewArray(elements)
+
+	case *Hash:
+		if !deep {
+			return &Hash{Pairs: obj.Pairs}
+		}
+		// The keys are kept, since changing a key would change where it belongs
+		pairs := obj.Pairs.MapValues(func(pair HashPair) Object {
+			return copyObject(pair.Value, deep, copies)
+		})
+		return &Hash{Pairs: pairs}
+
+	case *ClassInstance:
+		instance := obj.Instantiate()
+		copies[obj] = instance
+		if !deep {
+			return instance
+		}
+
+		names := instance.Env.Names()
+		for slot, value := range instance.Env.Values() {
+			if value == nil || isMethod(instance, value) {
+				continue
+			}
+			if instance.Env.MutabilityAt(0, slot) == Constant {
+				instance.Env.DefineConstant(slot, names[slot], copyObject(value, deep, copies))
+			} else {
+				instance.Env.Define(slot, names[slot], copyObject(value, deep, copies))
+			}
+		}
+		return instance
+
+	default:
+		// Everything else is immutable
+		return obj
+	}
+}
+
+// freezeObject keeps the fields of every instance in obj, and in the values
+// inside it, from being assigned again. Arrays, maps and sets can't be
+// changed already, but the instances in them can
+func freezeObject(obj Object) {
+	switch obj := obj.(type) {
+	case *Array:
+		for _, elem := range obj.Elements.Values() {
+			freezeObject(elem)
+		}
+
+	case *Hash:
+		for _, pair := range obj.Pairs.Pairs() {
+			freezeObject(pair.Key)
+			freezeObject(pair.Value)
+		}
+
+	case *Set:
+		for _, elem := range obj.Values() {
+			freezeObject(elem)
+		}
+
+	case *ClassInstance:
+		// An instance that is frozen already is not visited again, so an
+		// instance inside itself doesn't loop forever
+		if obj.Env.Frozen() {
+			return
+		}
+		obj.Env.Freeze()
+		for _, value := range obj.Env.Values() {
+			if value != nil && !isMethod(obj, value) {
+				freezeObject(value)
+			}
+		}
+	}
+}
+
+// AsKey returns obj as a key of a hash or an element of a set. Arrays and sets
+// are keys when their elements are, and an instance is a key when its class
+// has a public Hash method.
+// Keys are the same key when they are equal with ==
+func AsKey(obj Object, apply Applier) (Hashable, *Error) {
+	switch obj := obj.(type) {
+	case *Array:
+		h := fnv.New64a()
+		for _, elem := range obj.Elements.Values() {
+			key, err := AsKey(elem, apply)
+			if err != nil {
+				return nil, err
+			}
+			writeHashKey(h, key.HashKey())
+		}
+		return computedKey(obj, HashKey{Type: ARRAY_OBJ, Value: h.Sum64()}, apply), nil
+
+	case *Set:
+		// The order of the elements doesn't matter, so their hashes are added
+		var sum uint64
+		for _, elem := range obj.Values() {
+			key, err := AsKey(elem, apply)
+			if err != nil {
+				return nil, err
+			}
+			h := fnv.New64a()
+			writeHashKey(h, key.HashKey())
+			sum += h.Sum64()
+		}
+		return computedKey(obj, HashKey{Type: SET_OBJ, Value: sum}, apply), nil
+
+	case *ClassInstance:
+		hashMethod, ok := publicMethod(obj, "Hash")
+		if !ok {
+			return nil, newError("unusable as hash key: %s %s has no Hash method", obj.Type(), obj.Name)
+		}
+
+		result := apply(hashMethod, []Object{})
+		if err, ok := result.(*Error); ok {
+			return nil, err
+		}
+		key, err := AsKey(result, apply)
+		if err != nil {
+			return nil, err
+		}
+
+		h := fnv.New64a()
+		h.Write([]byte(obj.Name))
+		writeHashKey(h, key.HashKey())
+		return computedKey(obj, HashKey{Type: CLASS_OBJ, Value: h.Sum64()}, apply), nil
+
+	case Hashable:
+		return obj, nil
+
+	default:
+		return nil, newError("unusable as hash key: %s", obj.Type())
+	}
+}
+
+func computedKey(obj Object, hashKey HashKey, apply Applier) *ComputedKey {
+	equals := func(other Object) (bool, *Error) {
+		return newComparison(apply).equal(obj, other)
+	}
+	return &ComputedKey{Object: obj, Key: hashKey, Equals: equals}
+}
+
+func writeHashKey(h hash.Hash64, key HashKey) {
+	h.Write([]byte(key.Type))
+	h.Write(binary.LittleEndian.AppendUint64(nil, key.Value))
+}
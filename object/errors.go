@@ -0,0 +1,36 @@
+package object
+
+// The errors of the runtime that the evaluator and the vm both report
+
+// ReadOnlyError is the error of assigning name, or nil when its mutability
+// lets it be assigned
+func ReadOnlyError(name string, mutability Mutability) *Error {
+	switch mutability {
+	case Constant:
+		return newError("cannot assign to constant %s", name)
+	case Frozen:
+		return newError("cannot assign to %s of a frozen object", name)
+	}
+	return nil
+}
+
+// RaceError is the error of assigning name in a task while another task
+// that it didn't wait for assigned it
+func RaceError(name string) *Error {
+	return newError("data race on %s: tasks that don't wait for each other assign it", name)
+}
+
+// RecursionError is the error of nesting calls deeper than MaxDepth
+func RecursionError() *Error {
+	return newError("maximum recursion depth of %d exceeded", MaxDepth)
+}
+
+// AwaitError is the error of awaiting a promise that nothing can settle anymore
+func AwaitError() *Error {
+	return newError("await never ends: nothing is left that could settle the promise")
+}
+
+// NoMatchError is the error of a match expression that no arm matched
+func NoMatchError(subject Object) *Error {
+	return newError("no pattern matched %s", subject.Inspect())
+}
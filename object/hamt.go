@@ -0,0 +1,350 @@
+package object
+
+import (
+	"hash/fnv"
+	"math/bits"
+)
+
+const (
+	mapBits  = 5
+	mapWidth = 1 << mapBits
+	mapMask  = mapWidth - 1
+)
+
+// Map is a persistent hash array mapped trie from keys to pairs, which
+// remembers the order the keys were added in. Every change returns a new
+// map that shares most of its nodes with the old one, so the old one is
+// untouched. Get, Set and Delete are O(log n).
+type Map struct {
+	root *mapNode // nil when the map is empty
+	size int
+
+	// order has the pairs of the map in the order their keys were added,
+	// with nil where a pair has been deleted. The trie finds their index
+	order *Vector
+}
+
+// mapNode has an entry for every bit set in bitmap. When all the bits of
+// the hash have been used, the node is a list of the keys that collide
+type mapNode struct {
+	bitmap  uint32
+	entries []mapEntry
+}
+
+// mapEntry is a key, or a node with the keys whose hashes share a prefix
+type mapEntry struct {
+	hash   uint64
+	key    HashKey
+	object Object // The key itself, which is compared when hash keys are equal
+	index  int    // The position of the pair in the order of the map
+	node   *mapNode
+}
+
+// mapPair lets the order of a map, which is a Vector, hold pairs
+type mapPair struct {
+	HashPair
+}
+
+func (p *mapPair) Type() ObjectType { return "PAIR" }
+func (p *mapPair) Inspect() string  { return p.Key.Inspect() + ": " + p.Value.Inspect() }
+
+// hash spreads the bits of a hash key over the whole hash, so keys
+// that only differ in their high bits don't end up deep in the trie
+func (k HashKey) hash() uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(k.Type))
+	x := k.Value ^ h.Sum64()
+
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// matches reports whether the entry holds key. Different keys can have the
+// same hash key, so the keys themselves are compared when the hash keys are equal
+func (e *mapEntry) matches(hashKey HashKey, key Hashable) bool {
+	return e.key == hashKey && sameKey(e.object, key)
+}
+
+// sameKey reports whether key, which has the same hash key as stored, is the same key
+func sameKey(stored Object, key Hashable) bool {
+	switch key := key.(type) {
+	case *ComputedKey:
+		return key.equals(stored)
+	case *String:
+		stored, ok := stored.(*String)
+		return ok && stored.Value == key.Value
+	case *Boolean:
+		stored, ok := stored.(*Boolean)
+		return ok && stored.Value == key.Value
+	case *Integer:
+		if stored, ok := stored.(*Integer); ok {
+			return stored.Value == key.Value
+		}
+	}
+
+	// Numbers of different types can be equal, like 1 and 1.0
+	if key, ok := key.(Number); ok {
+		stored, ok := stored.(Number)
+		return ok && numbersEqual(stored, key)
+	}
+	return stored == key.(Object)
+}
+
+// keyObject returns the value a key stands for
+func keyObject(key Hashable) Object {
+	if computed, ok := key.(*ComputedKey); ok {
+		return computed.Object
+	}
+	return key.(Object)
+}
+
+func NewMap() *Map {
+	return &Map{order: NewVector(nil)}
+}
+
+func (m *Map) Len() int {
+	return m.size
+}
+
+func (m *Map) Get(key Hashable) (HashPair, bool) {
+	hashKey := key.HashKey()
+	hash := hashKey.hash()
+	node := m.root
+
+	for shift := 0; node != nil; shift += mapBits {
+		if shift >= 64 {
+			for i := range node.entries {
+				if node.entries[i].matches(hashKey, key) {
+					return m.pair(node.entries[i].index), true
+				}
+			}
+			return HashPair{}, false
+		}
+
+		bit := uint32(1) << ((hash >> shift) & mapMask)
+		if node.bitmap&bit == 0 {
+			return HashPair{}, false
+		}
+
+		entry := &node.entries[node.index(bit)]
+		if entry.node == nil {
+			if entry.matches(hashKey, key) {
+				return m.pair(entry.index), true
+			}
+			return HashPair{}, false
+		}
+		node = entry.node
+	}
+
+	return HashPair{}, false
+}
+
+func (m *Map) pair(index int) HashPair {
+	return m.order.Get(index).(*mapPair).HashPair
+}
+
+// Set returns a map where key is bound to value. A key that is already
+// in the map keeps its place in the order
+func (m *Map) Set(key Hashable, value Object) *Map {
+	root := m.root
+	if root == nil {
+		root = &mapNode{}
+	}
+
+	hashKey := key.HashKey()
+	entry := mapEntry{hash: hashKey.hash(), key: hashKey, object: keyObject(key), index: m.order.Len()}
+	root, index, added := setEntry(root, 0, entry, key)
+
+	if !added {
+		pair := &mapPair{HashPair{Key: m.pair(index).Key, Value: value}}
+		return &Map{root: m.root, size: m.size, order: m.order.Set(index, pair)}
+	}
+
+	pair := &mapPair{HashPair{Key: entry.object, Value: value}}
+	return &Map{root: root, size: m.size + 1, order: m.order.Push(pair)}
+}
+
+// Delete returns a map without key
+func (m *Map) Delete(key Hashable) *Map {
+	if m.root == nil {
+		return m
+	}
+
+	hashKey := key.HashKey()
+	root, index := deleteEntry(m.root, 0, hashKey.hash(), hashKey, key)
+	if index < 0 {
+		return m
+	}
+
+	deleted := &Map{root: root, size: m.size - 1, order: m.order.Set(index, nil)}
+	if deleted.order.Len() > 2*deleted.size+vectorWidth {
+		// Most of the order is deleted pairs, so it's built again without them
+		return deleted.compact()
+	}
+	return deleted
+}
+
+func (m *Map) compact() *Map {
+	indexes := map[int]int{}
+	pairs := []Object{}
+	for i, pair := range m.order.Values() {
+		if pair != nil {
+			indexes[i] = len(pairs)
+			pairs = append(pairs, pair)
+		}
+	}
+	return &Map{root: reindex(m.root, indexes), size: m.size, order: NewVector(pairs)}
+}
+
+// reindex returns a copy of node where the index of every key is changed to its new index
+func reindex(node *mapNode, indexes map[int]int) *mapNode {
+	if node == nil {
+		return nil
+	}
+
+	entries := append([]mapEntry{}, node.entries...)
+	for i := range entries {
+		if entries[i].node != nil {
+			entries[i].node = reindex(entries[i].node, indexes)
+		} else {
+			entries[i].index = indexes[entries[i].index]
+		}
+	}
+	return &mapNode{bitmap: node.bitmap, entries: entries}
+}
+
+// MapValues returns a map with the same keys, where each value is replaced by the result of f
+func (m *Map) MapValues(f func(pair HashPair) Object) *Map {
+	pairs := m.order.Values()
+	for i, pair := range pairs {
+		if pair != nil {
+			old := pair.(*mapPair)
+			pairs[i] = &mapPair{HashPair{Key: old.Key, Value: f(old.HashPair)}}
+		}
+	}
+	return &Map{root: m.root, size: m.size, order: NewVector(pairs)}
+}
+
+// Pairs returns the pairs of the map in a new slice, in the order their keys were added
+func (m *Map) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, m.size)
+	for _, pair := range m.order.Values() {
+		if pair != nil {
+			pairs = append(pairs, pair.(*mapPair).HashPair)
+		}
+	}
+	return pairs
+}
+
+// index returns the position in entries of the entry for bit
+func (n *mapNode) index(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+// setEntry returns a copy of node with entry added, and the index of entry.
+// If key is already there, it returns node itself, the index of the key and false
+func setEntry(node *mapNode, shift int, entry mapEntry, key Hashable) (*mapNode, int, bool) {
+	if shift >= 64 {
+		for _, existing := range node.entries {
+			if existing.matches(entry.key, key) {
+				return node, existing.index, false
+			}
+		}
+		entries := append(append([]mapEntry{}, node.entries...), entry)
+		return &mapNode{entries: entries}, entry.index, true
+	}
+
+	bit := uint32(1) << ((entry.hash >> shift) & mapMask)
+	idx := node.index(bit)
+
+	if node.bitmap&bit == 0 {
+		entries := make([]mapEntry, 0, len(node.entries)+1)
+		entries = append(entries, node.entries[:idx]...)
+		entries = append(entries, entry)
+		entries = append(entries, node.entries[idx:]...)
+		return &mapNode{bitmap: node.bitmap | bit, entries: entries}, entry.index, true
+	}
+
+	existing := node.entries[idx]
+	var child *mapNode
+
+	switch {
+	case existing.node != nil:
+		var index int
+		var added bool
+		child, index, added = setEntry(existing.node, shift+mapBits, entry, key)
+		if !added {
+			return node, index, false
+		}
+	case existing.matches(entry.key, key):
+		return node, existing.index, false
+	default:
+		// Two keys share the prefix, so they get a node of their own
+		child, _, _ = setEntry(&mapNode{}, shift+mapBits, existing, nil)
+		child, _, _ = setEntry(child, shift+mapBits, entry, key)
+	}
+
+	entries := append([]mapEntry{}, node.entries...)
+	entries[idx] = mapEntry{node: child}
+	return &mapNode{bitmap: node.bitmap, entries: entries}, entry.index, true
+}
+
+// deleteEntry returns a copy of node without key, or nil if the node is empty,
+// and the index of the key. The index is -1 if the key wasn't there
+func deleteEntry(node *mapNode, shift int, hash uint64, hashKey HashKey, key Hashable) (*mapNode, int) {
+	if shift >= 64 {
+		for i := range node.entries {
+			if node.entries[i].matches(hashKey, key) {
+				return removeEntry(node, 0, i), node.entries[i].index
+			}
+		}
+		return node, -1
+	}
+
+	bit := uint32(1) << ((hash >> shift) & mapMask)
+	if node.bitmap&bit == 0 {
+		return node, -1
+	}
+
+	idx := node.index(bit)
+	existing := node.entries[idx]
+
+	if existing.node == nil {
+		if !existing.matches(hashKey, key) {
+			return node, -1
+		}
+		return removeEntry(node, bit, idx), existing.index
+	}
+
+	child, index := deleteEntry(existing.node, shift+mapBits, hash, hashKey, key)
+	if index < 0 {
+		return node, -1
+	}
+	if child == nil {
+		return removeEntry(node, bit, idx), index
+	}
+
+	entries := append([]mapEntry{}, node.entries...)
+	if len(child.entries) == 1 && child.entries[0].node == nil {
+		// A node with a single key is replaced by the key
+		entries[idx] = child.entries[0]
+	} else {
+		entries[idx].node = child
+	}
+	return &mapNode{bitmap: node.bitmap, entries: entries}, index
+}
+
+func removeEntry(node *mapNode, bit uint32, idx int) *mapNode {
+	if len(node.entries) == 1 {
+		return nil
+	}
+
+	entries := make([]mapEntry, 0, len(node.entries)-1)
+	entries = append(entries, node.entries[:idx]...)
+	entries = append(entries, node.entries[idx+1:]...)
+	return &mapNode{bitmap: node.bitmap &^ bit, entries: entries}
+}
@@ -0,0 +1,235 @@
+package object
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMapSetGetDelete(t *testing.T) {
+	m := NewMap()
+	keys := []*String{}
+	for i := 0; i < 3000; i++ {
+		key := &String{Value: fmt.Sprintf("key%d", i)}
+		keys = append(keys, key)
+		m = m.Set(key, &Integer{Value: int64(i)})
+	}
+
+	if m.Len() != 3000 {
+		t.Fatalf("map has wrong length. got=%d", m.Len())
+	}
+	testMapOrder(t, m, keys)
+
+	for i, key := range keys {
+		// A different string with the same value finds the pair
+		pair, ok := m.Get(&String{Value: key.Value})
+		if !ok {
+			t.Fatalf("key %s not found", key.Value)
+		}
+		testIntegerValue(t, pair.Value, int64(i))
+	}
+
+	replaced := m.Set(keys[5], &Integer{Value: -5})
+	if replaced.Len() != 3000 {
+		t.Errorf("setting an existing key changed the length. got=%d", replaced.Len())
+	}
+	testMapOrder(t, replaced, keys)
+	pair, _ := replaced.Get(keys[5])
+	testIntegerValue(t, pair.Value, -5)
+	pair, _ = m.Get(keys[5])
+	testIntegerValue(t, pair.Value, 5)
+
+	deleted := m
+	remaining := []*String{}
+	for i, key := range keys {
+		if i%2 == 0 {
+			deleted = deleted.Delete(key)
+		} else {
+			remaining = append(remaining, key)
+		}
+	}
+	if deleted.Len() != 1500 {
+		t.Fatalf("map has wrong length after delete. got=%d", deleted.Len())
+	}
+	testMapOrder(t, deleted, remaining)
+	for i, key := range keys {
+		_, ok := deleted.Get(key)
+		if ok != (i%2 == 1) {
+			t.Errorf("wrong presence of %s after delete. got=%t", key.Value, ok)
+		}
+		if _, ok := m.Get(key); !ok {
+			t.Errorf("delete changed the old map. %s is missing", key.Value)
+		}
+	}
+
+	if deleted.Delete(keys[0]) != deleted {
+		t.Errorf("deleting a missing key made a new map")
+	}
+}
+
+func TestMapOrder(t *testing.T) {
+	a := &String{Value: "a"}
+	b := &Integer{Value: 2}
+	c := &Boolean{Value: true}
+
+	m := NewMap().Set(c, &Null{}).Set(a, &Null{}).Set(b, &Null{})
+	testMapOrder(t, m, []Hashable{c, a, b})
+
+	// A key that is deleted and added again goes to the end
+	testMapOrder(t, m.Delete(c).Set(c, &Null{}), []Hashable{a, b, c})
+
+	// Deleting everything but one key many times keeps the order right
+	m = NewMap().Set(a, &Null{})
+	for i := 0; i < 500; i++ {
+		key := &Integer{Value: int64(i)}
+		m = m.Set(key, &Null{}).Delete(key)
+	}
+	m = m.Set(b, &Null{})
+	testMapOrder(t, m, []Hashable{a, b})
+	if m.order.Len() > 2*m.Len()+vectorWidth {
+		t.Errorf("deleted keys weren't compacted. got=%d", m.order.Len())
+	}
+}
+
+// collidingKey is a string whose hash key is the same as every other collidingKey
+type collidingKey struct {
+	*String
+}
+
+func (k collidingKey) HashKey() HashKey {
+	return HashKey{Type: STRING_OBJ, Value: 42}
+}
+
+func TestMapCollisions(t *testing.T) {
+	a := collidingKey{&String{Value: "a"}}
+	b := collidingKey{&String{Value: "b"}}
+	c := collidingKey{&String{Value: "c"}}
+
+	m := NewMap().
+		Set(a, &Integer{Value: 1}).
+		Set(b, &Integer{Value: 2}).
+		Set(c, &Integer{Value: 3})
+
+	if m.Len() != 3 {
+		t.Fatalf("map has wrong length. got=%d", m.Len())
+	}
+	testMapOrder(t, m, []Hashable{a, b, c})
+	for i, key := range []Hashable{a, b, c} {
+		pair, ok := m.Get(key)
+		if !ok {
+			t.Fatalf("key %d not found", i)
+		}
+		testIntegerValue(t, pair.Value, int64(i+1))
+	}
+
+	m = m.Set(b, &Integer{Value: 4})
+	pair, _ := m.Get(b)
+	testIntegerValue(t, pair.Value, 4)
+	pair, _ = m.Get(a)
+	testIntegerValue(t, pair.Value, 1)
+
+	m = m.Delete(b)
+	if _, ok := m.Get(b); ok {
+		t.Errorf("deleted key still found")
+	}
+	pair, _ = m.Get(c)
+	testIntegerValue(t, pair.Value, 3)
+
+	m = m.Delete(a).Delete(c)
+	if m.Len() != 0 || len(m.Pairs()) != 0 {
+		t.Errorf("map not empty. got=%d", m.Len())
+	}
+}
+
+func TestMapNumberKeys(t *testing.T) {
+	m := NewMap().Set(&Integer{Value: 1}, &Integer{Value: 1})
+	m = m.Set(&Real{Value: 1.0}, &Integer{Value: 2})
+	m = m.Set(&Real{Value: 1.5}, &Integer{Value: 3})
+
+	if m.Len() != 2 {
+		t.Fatalf("1 and 1.0 aren't the same key. got=%d keys", m.Len())
+	}
+	pair, _ := m.Get(&Integer{Value: 1})
+	testIntegerValue(t, pair.Value, 2)
+	if pair.Key.Inspect() != "1" {
+		t.Errorf("the first key wasn't kept. got=%s", pair.Key.Inspect())
+	}
+	pair, _ = m.Get(&Real{Value: 1.5})
+	testIntegerValue(t, pair.Value, 3)
+	if _, ok := m.Get(&Integer{Value: 2}); ok {
+		t.Errorf("2 was found")
+	}
+}
+
+func TestMapComputedKeys(t *testing.T) {
+	// Keys that are equal when their lengths are
+	key := func(s string) *ComputedKey {
+		str := &String{Value: s}
+		equals := func(other Object) (bool, *Error) {
+			str, ok := other.(*String)
+			return ok && len(str.Value) == len(s), nil
+		}
+		return &ComputedKey{Object: str, Key: HashKey{Type: STRING_OBJ, Value: uint64(len(s))}, Equals: equals}
+	}
+
+	m := NewMap().Set(key("ab"), &Integer{Value: 1}).Set(key("abc"), &Integer{Value: 2})
+	m = m.Set(key("cd"), &Integer{Value: 3})
+
+	if m.Len() != 2 {
+		t.Fatalf("map has wrong length. got=%d", m.Len())
+	}
+	pair, ok := m.Get(key("xy"))
+	if !ok {
+		t.Fatalf("key not found")
+	}
+	testIntegerValue(t, pair.Value, 3)
+	if pair.Key.Inspect() != "ab" {
+		t.Errorf("the key isn't the object of the first key. got=%s", pair.Key.Inspect())
+	}
+
+	m = m.Delete(key("zz"))
+	if _, ok := m.Get(key("ab")); ok || m.Len() != 1 {
+		t.Errorf("key wasn't deleted")
+	}
+}
+
+func TestMapValues(t *testing.T) {
+	m := NewMap().Set(&String{Value: "a"}, &Integer{Value: 1}).Set(&String{Value: "b"}, &Integer{Value: 2})
+	doubled := m.MapValues(func(pair HashPair) Object {
+		return &Integer{Value: pair.Value.(*Integer).Value * 2}
+	})
+
+	pairs := doubled.Pairs()
+	if len(pairs) != 2 || pairs[0].Key.Inspect() != "a" || pairs[1].Key.Inspect() != "b" {
+		t.Fatalf("wrong pairs. got=%v", pairs)
+	}
+	testIntegerValue(t, pairs[0].Value, 2)
+	testIntegerValue(t, pairs[1].Value, 4)
+
+	pair, _ := doubled.Get(&String{Value: "b"})
+	testIntegerValue(t, pair.Value, 4)
+	pair, _ = m.Get(&String{Value: "b"})
+	testIntegerValue(t, pair.Value, 2)
+}
+
+func testMapOrder[K Hashable](t *testing.T, m *Map, keys []K) {
+	t.Helper()
+
+	pairs := m.Pairs()
+	if len(pairs) != len(keys) {
+		t.Fatalf("Pairs() has wrong length. expected=%d, got=%d", len(keys), len(pairs))
+	}
+	for i, pair := range pairs {
+		if pair.Key != any(keys[i]) {
+			t.Fatalf("wrong key at %d. expected=%s, got=%s", i, any(keys[i]).(Object).Inspect(), pair.Key.Inspect())
+		}
+	}
+}
+
+func testIntegerValue(t *testing.T, obj Object, expected int64) {
+	t.Helper()
+
+	integer, ok := obj.(*Integer)
+	if !ok || integer.Value != expected {
+		t.Errorf("wrong value. expected=%d, got=%v", expected, obj)
+	}
+}
@@ -0,0 +1,206 @@
+package object
+
+import (
+	"math"
+	"math/big"
+)
+
+// AddInt64, SubInt64 and MulInt64 return false when the result doesn't fit in 64 bits
+func AddInt64(a, b int64) (int64, bool) {
+	sum := a + b
+	return sum, (sum > a) == (b > 0)
+}
+
+func SubInt64(a, b int64) (int64, bool) {
+	difference := a - b
+	return difference, (difference < a) == (b > 0)
+}
+
+func MulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	if a == -1 && b == math.MinInt64 || b == -1 && a == math.MinInt64 {
+		return 0, false
+	}
+	product := a * b
+	return product, product/b == a
+}
+
+// powInt64 returns base ** exponent for an exponent that isn't negative
+func powInt64(base, exponent int64) (int64, bool) {
+	result := int64(1)
+	for exponent > 0 {
+		if exponent&1 == 1 {
+			var ok bool
+			if result, ok = MulInt64(result, base); !ok {
+				return 0, false
+			}
+		}
+		exponent >>= 1
+		if exponent > 0 {
+			var ok bool
+			if base, ok = MulInt64(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+	return result, true
+}
+
+// floorDivInt64 rounds the quotient towards negative infinity, so -7 // 2 is -4
+func floorDivInt64(a, b int64) int64 {
+	quotient := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		quotient--
+	}
+	return quotient
+}
+
+func floorDivBig(a, b *big.Int) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(a, b, new(big.Int))
+	if remainder.Sign() != 0 && remainder.Sign() != b.Sign() {
+		quotient.Sub(quotient, big.NewInt(1))
+	}
+	return quotient
+}
+
+// maxIntegerBits limits the integers << and ** make, so a typo like
+// 2 ** 10000000000 is an error instead of using up all the memory
+const maxIntegerBits = 1 << 24
+
+func isInteger(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInteger:
+		return true
+	default:
+		return false
+	}
+}
+
+func bigValue(obj Object) *big.Int {
+	if integer, ok := obj.(*Integer); ok {
+		return big.NewInt(integer.Value)
+	}
+	return obj.(*BigInteger).Value
+}
+
+// NewBigInteger returns value as an Integer when it fits in one. Otherwise
+// it's a BigInteger, or an error described by format when overflow is an error
+func NewBigInteger(value *big.Int, arithmetic Arithmetic, format string, a ...interface{}) Object {
+	if value.IsInt64() {
+		return NewInteger(value.Int64())
+	}
+	if arithmetic.Overflow == ErrorOnOverflow {
+		return newError("integer overflow: "+format, a...)
+	}
+	return &BigInteger{Value: value}
+}
+
+// bigIntegerInfix works on two integers of which either can be a BigInteger
+func bigIntegerInfix(operator string, left, right Object, arithmetic Arithmetic) Object {
+	leftValue := bigValue(left)
+	rightValue := bigValue(right)
+	result := new(big.Int)
+
+	switch operator {
+	case "+":
+		result.Add(leftValue, rightValue)
+	case "-":
+		result.Sub(leftValue, rightValue)
+	case "*":
+		result.Mul(leftValue, rightValue)
+	case "/":
+		if rightValue.Sign() == 0 {
+			return newError("division by zero")
+		}
+		result.Quo(leftValue, rightValue)
+	case "%":
+		if rightValue.Sign() == 0 {
+			return newError("division by zero")
+		}
+		result.Rem(leftValue, rightValue)
+	case "//":
+		if rightValue.Sign() == 0 {
+			return newError("division by zero")
+		}
+		result = floorDivBig(leftValue, rightValue)
+	case "**":
+		if rightValue.Sign() < 0 {
+			return negativePower(left, right)
+		}
+		if powerTooLarge(leftValue, rightValue) {
+			return newError("integer too large: %s ** %s", left.Inspect(), right.Inspect())
+		}
+		result.Exp(leftValue, rightValue, nil)
+	case "&":
+		result.And(leftValue, rightValue)
+	case "|":
+		result.Or(leftValue, rightValue)
+	case "^":
+		result.Xor(leftValue, rightValue)
+	case "<<", ">>":
+		if rightValue.Sign() < 0 {
+			return newError("negative shift count: %s", right.Inspect())
+		}
+		if operator == ">>" {
+			// Shifting out every bit leaves 0, or -1 for a negative integer
+			shift := uint(leftValue.BitLen())
+			if rightValue.IsInt64() && rightValue.Int64() < int64(shift) {
+				shift = uint(rightValue.Int64())
+			}
+			result.Rsh(leftValue, shift)
+			break
+		}
+		if leftValue.Sign() != 0 && (!rightValue.IsInt64() || int64(leftValue.BitLen())+rightValue.Int64() > maxIntegerBits) {
+			return newError("integer too large: %s << %s", left.Inspect(), right.Inspect())
+		}
+		if leftValue.Sign() != 0 {
+			result.Lsh(leftValue, uint(rightValue.Int64()))
+		}
+	case "<":
+		return NewBoolean(leftValue.Cmp(rightValue) < 0)
+	case ">":
+		return NewBoolean(leftValue.Cmp(rightValue) > 0)
+	case "==":
+		return NewBoolean(leftValue.Cmp(rightValue) == 0)
+	case "!=":
+		return NewBoolean(leftValue.Cmp(rightValue) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	return NewBigInteger(result, arithmetic, "%s %s %s", left.Inspect(), operator, right.Inspect())
+}
+
+// negativePower returns an integer to a negative power, which is a real like 2 ** -1 is 0.5
+func negativePower(left, right Object) Object {
+	if bigValue(left).Sign() == 0 {
+		return newError("division by zero")
+	}
+	return &Real{Value: math.Pow(realValue(left), realValue(right))}
+}
+
+// bitwiseNot returns ~x, which is -x - 1
+func bitwiseNot(right Object, arithmetic Arithmetic) Object {
+	if integer, ok := right.(*Integer); ok {
+		return NewInteger(^integer.Value)
+	}
+	if !isInteger(right) {
+		return newError("unknown operator: ~%s", right.Type())
+	}
+	return NewBigInteger(new(big.Int).Not(bigValue(right)), arithmetic, "~(%s)", right.Inspect())
+}
+
+// AddToInteger adds factor to obj for ++ and --. It returns false when obj isn't an integer
+func AddToInteger(obj Object, factor int64, arithmetic Arithmetic) (Object, bool) {
+	if integer, ok := obj.(*Integer); ok {
+		if sum, ok := AddInt64(integer.Value, factor); ok {
+			return NewInteger(sum), true
+		}
+	}
+	if !isInteger(obj) {
+		return nil, false
+	}
+	return bigIntegerInfix("+", obj, NewInteger(factor), arithmetic), true
+}
@@ -0,0 +1,587 @@
+package object
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the time the timers of a program run on
+type Clock interface {
+	Now() time.Time
+	// After returns a channel that gets the time once d has passed
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SystemClock is the time of the computer, which programs run on by default
+var SystemClock Clock = systemClock{}
+
+// ManualClock only moves when the loop waits on it, and then jumps to the
+// time the loop waits for. Timers run at once and always in the same order,
+// which makes the clock useful for tests
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewManualClock() *ManualClock {
+	return &ManualClock{now: time.Unix(0, 0)}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	fired := make(chan time.Time, 1)
+	fired <- c.now
+	return fired
+}
+
+// job is something the loop runs: a timer that is due, or an async function
+// that can go on since what it awaits is settled. Runner is the task that
+// runs the loop, and apply calls functions in it
+type job func(runner *Task, apply Applier) Object
+
+type timer struct {
+	at       time.Time
+	order    int           // timers that are due at the same time run in this order
+	interval time.Duration // the time between two runs of a repeating timer
+	repeat   bool
+	run      job
+}
+
+// Loop is the event loop of a program. It runs the timers and the async
+// functions that wait for a promise. A program runs the loop after its last
+// statement, until nothing is left that could run
+type Loop struct {
+	mu        sync.Mutex
+	clock     Clock
+	start     time.Time
+	jobs      []job
+	timers    map[int]*timer
+	lastTimer int
+	lastOrder int
+	watching  []*Task       // spawned tasks that promises are waiting for
+	wake      chan struct{} // told when a job is added while the loop sleeps
+	rejected  []*Promise
+
+	// concurrent is set when a second task of the program starts: a spawned
+	// task or an async function. Until then the program runs in one task on
+	// one goroutine, so its environments don't lock, don't look for races
+	// and keep the task they're made in. Another program starts without it
+	concurrent atomic.Bool
+
+	// tasks is the number of tasks of the program that haven't finished,
+	// and waiters the ones that wait for something. Both are guarded by sched
+	tasks   int
+	waiters []*waiter
+}
+
+func NewLoop(clock Clock) *Loop {
+	return &Loop{
+		clock:  clock,
+		start:  clock.Now(),
+		timers: make(map[int]*timer),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// SetClock decides the clock the timers run on. The time of the loop starts again at 0
+func (l *Loop) SetClock(clock Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = clock
+	l.start = clock.Now()
+}
+
+// Elapsed returns how long the loop has run on its clock
+func (l *Loop) Elapsed() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.clock.Now().Sub(l.start)
+}
+
+// SetTimeout calls fn with args once delay has passed, and returns the id of the timer
+func (l *Loop) SetTimeout(delay time.Duration, fn Object, args []Object) int {
+	return l.setTimer(delay, false, call(fn, args))
+}
+
+// SetInterval calls fn with args every interval until the timer is cleared,
+// and returns the id of the timer
+func (l *Loop) SetInterval(interval time.Duration, fn Object, args []Object) int {
+	return l.setTimer(interval, true, call(fn, args))
+}
+
+// ClearTimer stops the timer with the id. Returns false if there is no such timer
+func (l *Loop) ClearTimer(id int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.timers[id]
+	delete(l.timers, id)
+	return ok
+}
+
+// Sleep returns a promise that is fulfilled with value once delay has passed
+func (l *Loop) Sleep(delay time.Duration, value Object) *Promise {
+	promise := l.newPromise()
+	l.setTimer(delay, false, func(runner *Task, apply Applier) Object {
+		promise.settle(value)
+		return nil
+	})
+	return promise
+}
+
+// call is a job that calls fn with args. Only an error of fn is kept,
+// since it stops the loop
+func call(fn Object, args []Object) job {
+	return func(runner *Task, apply Applier) Object {
+		if result := apply(fn, args); isError(result) {
+			return result
+		}
+		return nil
+	}
+}
+
+func (l *Loop) setTimer(delay time.Duration, repeat bool, run job) int {
+	if delay < 0 {
+		delay = 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastTimer++
+	l.lastOrder++
+	l.timers[l.lastTimer] = &timer{
+		at:       l.clock.Now().Add(delay),
+		order:    l.lastOrder,
+		interval: delay,
+		repeat:   repeat,
+		run:      run,
+	}
+	return l.lastTimer
+}
+
+// next returns the id of the timer that is due first
+func (l *Loop) next() (int, *timer) {
+	var id int
+	var first *timer
+	for timerID, t := range l.timers {
+		if first == nil || t.at.Before(first.at) || t.at.Equal(first.at) && t.order < first.order {
+			id, first = timerID, t
+		}
+	}
+	return id, first
+}
+
+func (l *Loop) enqueue(j job) {
+	l.mu.Lock()
+	l.jobs = append(l.jobs, j)
+	l.mu.Unlock()
+	l.signal()
+}
+
+func (l *Loop) signal() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	sched.Lock()
+	schedCond.Broadcast()
+	sched.Unlock()
+}
+
+// Run runs the loop in runner until nothing is left that could run.
+// Functions are called with apply. Returns the error of a timer that stopped
+// the loop, or of a rejected promise that nothing awaited
+func (l *Loop) Run(runner *Task, apply Applier) Object {
+	if err := l.run(runner, apply, nil); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	promises := l.rejected
+	l.rejected = nil
+	for _, promise := range promises {
+		if !promise.isHandled() {
+			return promise.value
+		}
+	}
+	return nil
+}
+
+// run runs jobs as they come, and sleeps until the next timer when there
+// are none, until done is true or nothing is left that could run
+func (l *Loop) run(runner *Task, apply Applier, done func() bool) Object {
+	for done == nil || !done() {
+		l.mu.Lock()
+		if len(l.jobs) > 0 {
+			next := l.jobs[0]
+			l.jobs = l.jobs[1:]
+			l.mu.Unlock()
+
+			if err := next(runner, apply); err != nil {
+				return err
+			}
+			continue
+		}
+
+		id, next := l.next()
+		if next == nil && len(l.watching) == 0 {
+			l.mu.Unlock()
+			return nil
+		}
+		if next == nil {
+			// Only spawned tasks can give the loop something to do
+			l.mu.Unlock()
+			if !l.idle(done) {
+				return deadlockError()
+			}
+			continue
+		}
+
+		wait := next.at.Sub(l.clock.Now())
+		if wait <= 0 {
+			if next.repeat {
+				l.lastOrder++
+				next.at = next.at.Add(next.interval)
+				next.order = l.lastOrder
+			} else {
+				delete(l.timers, id)
+			}
+			l.jobs = append(l.jobs, next.run)
+			l.mu.Unlock()
+			continue
+		}
+		due := l.clock.After(wait)
+		l.mu.Unlock()
+
+		select {
+		case <-due:
+		case <-l.wake:
+		}
+	}
+	return nil
+}
+
+// idle waits like a task until done is true or the loop has something to
+// do. Returns false when every task waits, so neither can happen
+func (l *Loop) idle(done func() bool) bool {
+	sched.Lock()
+	defer sched.Unlock()
+	return l.wait(func() bool {
+		if done != nil && done() {
+			return true
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if len(l.jobs) > 0 || len(l.timers) > 0 || len(l.watching) == 0 {
+			return true
+		}
+		// A finished task settles its promise soon
+		for _, task := range l.watching {
+			if task.finished {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// watch returns a promise that is settled with the result of a spawned task
+func (l *Loop) watch(task *Task) *Promise {
+	promise := l.newPromise()
+
+	l.mu.Lock()
+	l.watching = append(l.watching, task)
+	l.mu.Unlock()
+
+	go func() {
+		<-task.done
+		promise.settleFrom(task.result, task.final)
+
+		l.mu.Lock()
+		for i, watched := range l.watching {
+			if watched == task {
+				l.watching = append(l.watching[:i], l.watching[i+1:]...)
+				break
+			}
+		}
+		l.mu.Unlock()
+		l.signal()
+	}()
+	return promise
+}
+
+type promiseState int
+
+const (
+	pending promiseState = iota
+	fulfilled
+	rejected
+)
+
+// Promise is the result of an async function, which is there once the
+// function has returned. A promise that gets an error is rejected
+type Promise struct {
+	loop *Loop
+
+	mu        sync.Mutex
+	state     promiseState
+	value     Object
+	clock     clock // the clock of the task that settled the promise, if a task did
+	callbacks []job
+	handled   bool // something awaited the promise
+}
+
+func (l *Loop) newPromise() *Promise {
+	return &Promise{loop: l}
+}
+
+func (p *Promise) Type() ObjectType { return PROMISE_OBJ }
+func (p *Promise) Inspect() string  { return "promise" }
+
+// resolve settles p with value from a task that released released, or,
+// when value is a promise too, like that promise
+func (p *Promise) resolve(value Object, released clock) {
+	other, ok := value.(*Promise)
+	if !ok {
+		p.settleFrom(value, released)
+		return
+	}
+	other.then(func(runner *Task, apply Applier) Object {
+		value, released := other.take()
+		p.settleFrom(value, released)
+		return nil
+	})
+}
+
+func (p *Promise) settle(value Object) {
+	p.settleFrom(value, nil)
+}
+
+// settleFrom settles p with value. Released is the clock of the task that
+// settled it, which the tasks that await p wait for
+func (p *Promise) settleFrom(value Object, released clock) {
+	p.mu.Lock()
+	if p.state != pending {
+		p.mu.Unlock()
+		return
+	}
+	p.value = value
+	p.clock = released
+	p.state = fulfilled
+	if isError(value) {
+		p.state = rejected
+	}
+	callbacks := p.callbacks
+	p.callbacks = nil
+	p.mu.Unlock()
+
+	if p.state == rejected {
+		p.loop.mu.Lock()
+		p.loop.rejected = append(p.loop.rejected, p)
+		p.loop.mu.Unlock()
+	}
+	for _, callback := range callbacks {
+		p.loop.enqueue(callback)
+	}
+	// A loop can wait for p to be settled
+	p.loop.signal()
+}
+
+func (p *Promise) settled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state != pending
+}
+
+func (p *Promise) isHandled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.handled
+}
+
+// take returns the value of a settled promise, which counts as handled, and
+// the clock of the task that settled it
+func (p *Promise) take() (Object, clock) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handled = true
+	return p.value, p.clock
+}
+
+// then makes the loop run callback once the promise is settled
+func (p *Promise) then(callback job) {
+	p.mu.Lock()
+	if p.state == pending {
+		p.callbacks = append(p.callbacks, callback)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	p.loop.enqueue(callback)
+}
+
+// coroutine is an async function that runs on a goroutine of its own, but
+// only while the goroutine that resumes it waits. So the program still does
+// one thing at a time, and an async function can stop in an await
+type coroutine struct {
+	task   *Task // the task the async function runs in
+	resume chan struct{}
+	yield  chan struct{}
+}
+
+// switchTo runs the coroutine from the task from until it awaits or
+// returns. Each of the two tasks waits for what the other did before
+func (co *coroutine) switchTo(from *Task) {
+	co.task.acquire(from.release())
+	co.resume <- struct{}{}
+	<-co.yield
+	from.acquire(co.task.release())
+}
+
+// suspend gives control back to the goroutine that resumed the coroutine
+// and waits until it is resumed again
+func (co *coroutine) suspend() {
+	co.yield <- struct{}{}
+	<-co.resume
+}
+
+// Async calls body as an async function of t. Body runs at once, until it
+// awaits something, and the promise that Async returns then is settled with
+// the result of body. Body runs in a task of its own, which goes on after
+// an await while t or another task runs the loop. So what body does after
+// an await is ordered after t only where the tasks wait for each other
+func (t *Task) Async(body func(task *Task) Object) *Promise {
+	t.Loop.concurrent.Store(true)
+	co := &coroutine{resume: make(chan struct{}), yield: make(chan struct{})}
+	task := newTask(t.Loop)
+	task.co = co
+	co.task = task
+	promise := t.Loop.newPromise()
+
+	go func() {
+		<-co.resume
+		result := body(task)
+		promise.resolve(result, task.release())
+		co.yield <- struct{}{}
+	}()
+	co.switchTo(t)
+	return promise
+}
+
+// Await returns the result of a promise, or of a spawned task, once it's
+// there. In an async function the function stops until then and lets the
+// loop run other things. Elsewhere the loop runs until then, and returns
+// false if nothing is left that could settle the promise. Other values are
+// returned as they are
+func (t *Task) Await(val Object, apply Applier) (Object, bool) {
+	var promise *Promise
+	switch val := val.(type) {
+	case *Promise:
+		promise = val
+	case *Task:
+		promise = t.Loop.watch(val)
+	default:
+		return val, true
+	}
+
+	if t.co != nil {
+		co := t.co
+		promise.then(func(runner *Task, apply Applier) Object {
+			co.switchTo(runner)
+			return nil
+		})
+		co.suspend()
+	} else {
+		if err := t.Loop.run(t, apply, promise.settled); err != nil {
+			return err, true
+		}
+		if !promise.settled() {
+			return nil, false
+		}
+	}
+
+	value, released := promise.take()
+	if released != nil {
+		t.acquire(released)
+	}
+	return value, true
+}
+
+func isError(obj Object) bool {
+	return obj != nil && obj.Type() == ERROR_OBJ
+}
+
+// milliseconds is a delay argument of a timer builtin
+func milliseconds(builtin string, arg Object) (time.Duration, *Error) {
+	ms, ok := arg.(*Integer)
+	if !ok {
+		return 0, newError("delay of `%s` must be INTEGER, got %s", builtin, arg.Type())
+	}
+	return time.Duration(ms.Value) * time.Millisecond, nil
+}
+
+// setTimer is setTimeout or setInterval: setTimeout(f, ms, args...)
+func setTimer(builtin string, task *Task, args []Object) Object {
+	if len(args) < 2 {
+		return newError("wrong number of arguments. got=%d, want=2 or more", len(args))
+	}
+	if args[0].Type() != FUNCTION_OBJ && args[0].Type() != BUILTIN_OBJ {
+		return newError("argument to `%s` must be FUNCTION, got %s", builtin, args[0].Type())
+	}
+	delay, err := milliseconds(builtin, args[1])
+	if err != nil {
+		return err
+	}
+
+	var id int
+	if builtin == "setInterval" {
+		id = task.Loop.SetInterval(delay, args[0], args[2:])
+	} else {
+		id = task.Loop.SetTimeout(delay, args[0], args[2:])
+	}
+	return NewInteger(int64(id))
+}
+
+func clearTimer(builtin string, task *Task, args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	id, ok := args[0].(*Integer)
+	if !ok {
+		return newError("argument to `%s` must be INTEGER, got %s", builtin, args[0].Type())
+	}
+	task.Loop.ClearTimer(int(id.Value))
+	return NULL
+}
+
+func sleep(task *Task, args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	delay, err := milliseconds("sleep", args[0])
+	if err != nil {
+		return err
+	}
+	return task.Loop.Sleep(delay, NULL)
+}
+
+func now(task *Task, args []Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return NewInteger(task.Loop.Elapsed().Milliseconds())
+}
@@ -0,0 +1,194 @@
+package object
+
+import (
+	"Pron-Lang/ast"
+)
+
+// typeNames are the builtin types a type pattern like `int n` can match
+var typeNames = map[string][]ObjectType{
+	"int":      {INTEGER_OBJ, BIG_INTEGER_OBJ},
+	"real":     {REAL_OBJ},
+	"decimal":  {DECIMAL_OBJ},
+	"rational": {RATIONAL_OBJ},
+	"string":   {STRING_OBJ},
+	"bool":     {BOOLEAN_OBJ},
+	"array":    {ARRAY_OBJ},
+	"map":      {HASH_OBJ},
+	"set":      {SET_OBJ},
+	"function": {FUNCTION_OBJ, BUILTIN_OBJ},
+}
+
+// MatchPatterns reports whether one of patterns matches value, and binds the
+// variables of the first pattern that does in env
+func MatchPatterns(patterns []ast.Pattern, value Object, env *Environment, apply Applier) (bool, *Error) {
+	for _, pattern := range patterns {
+		bindings := map[*ast.Identifier]Object{}
+		matched, err := newComparison(apply).match(pattern, value, env, bindings)
+		if err != nil {
+			return false, err
+		}
+		if !matched {
+			continue
+		}
+
+		for ident, val := range bindings {
+			env.Declare(ident, val)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Destructure binds the variables of pattern to the parts of value, like
+// var [a, b] = value does
+func Destructure(pattern ast.Pattern, value Object, env *Environment, apply Applier) *Error {
+	matched, err := MatchPatterns([]ast.Pattern{pattern}, value, env, apply)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return newError("cannot destructure %s with %s", value.Inspect(), pattern.String())
+	}
+	return nil
+}
+
+// match compares value with pattern and collects the variables it binds.
+// Nothing is bound unless the whole pattern matches
+func (c *comparison) match(pattern ast.Pattern, value Object, env *Environment,
+	bindings map[*ast.Identifier]Object) (bool, *Error) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			bindings[pattern] = value
+		}
+		return true, nil
+
+	case *ast.LiteralPattern:
+		literal := patternValue(pattern.Value, env)
+		if err, ok := literal.(*Error); ok {
+			return false, err
+		}
+		return c.equal(literal, value)
+
+	case *ast.ArrayPattern:
+		array, ok := value.(*Array)
+		if !ok {
+			return false, nil
+		}
+		return c.matchElements(pattern.Elements, array.Elements.Values(), env, bindings)
+
+	case *ast.HashPattern:
+		hash, ok := value.(*Hash)
+		if !ok {
+			return false, nil
+		}
+		for i, keyNode := range pattern.Keys {
+			key, err := AsKey(patternValue(keyNode, env), c.apply)
+			if err != nil {
+				return false, err
+			}
+			pair, ok, err := hash.Get(key)
+			if !ok || err != nil {
+				return false, err
+			}
+			if matched, err := c.match(pattern.Values[i], pair.Value, env, bindings); !matched || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case *ast.TypePattern:
+		if !hasType(value, pattern.TypeName.Value) {
+			return false, nil
+		}
+		return c.match(pattern.Name, value, env, bindings)
+
+	default:
+		return false, newError("unknown pattern: %s", pattern.String())
+	}
+}
+
+// matchElements matches the elements of an array with the patterns in order.
+// A rest pattern takes the elements that the patterns after it leave over
+func (c *comparison) matchElements(patterns []ast.Pattern, elements []Object, env *Environment,
+	bindings map[*ast.Identifier]Object) (bool, *Error) {
+	for i, pattern := range patterns {
+		rest, ok := pattern.(*ast.RestPattern)
+		if !ok {
+			continue
+		}
+		after := len(patterns) - i - 1
+		if len(elements) < i+after {
+			return false, nil
+		}
+		if matched, err := c.matchElements(patterns[:i], elements[:i], env, bindings); !matched || err != nil {
+			return false, err
+		}
+		restElements := elements[i : len(elements)-after]
+		if matched, err := c.match(rest.Name, &Array{Elements: NewVector(restElements)}, env, bindings); !matched || err != nil {
+			return false, err
+		}
+		return c.matchElements(patterns[i+1:], elements[len(elements)-after:], env, bindings)
+	}
+
+	if len(elements) != len(patterns) {
+		return false, nil
+	}
+	for i, elem := range elements {
+		if matched, err := c.match(patterns[i], elem, env, bindings); !matched || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// hasType reports whether value is an instance of the class with the given
+// name, a member of the enum with that name, or a value of the builtin type
+// with that name
+func hasType(value Object, typeName string) bool {
+	if instance, ok := value.(*ClassInstance); ok {
+		return instance.Name == typeName
+	}
+	if member, ok := value.(*EnumMember); ok {
+		return member.Enum.Name == typeName
+	}
+	for _, objectType := range typeNames[typeName] {
+		if value.Type() == objectType {
+			return true
+		}
+	}
+	return false
+}
+
+// patternValue returns the value of the literal in a pattern: a number,
+// which can be negative, a string, a boolean or the member of an enum
+func patternValue(node ast.Expression, env *Environment) Object {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return NewInteger(node.Value)
+	case *ast.BigIntegerLiteral:
+		return NewBigInteger(node.Value, env.Arithmetic(), "%s doesn't fit in 64 bits", node.Value)
+	case *ast.RealLiteral:
+		return &Real{Value: node.Value}
+	case *ast.DecimalLiteral:
+		return &Decimal{Coefficient: node.Coefficient, Exponent: node.Exponent}
+	case *ast.StringLiteral:
+		return &String{Value: node.Value}
+	case *ast.Boolean:
+		return NewBoolean(node.Value)
+	case *ast.PrefixExpression:
+		right := patternValue(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return Prefix(node.Operator, right, env.Arithmetic())
+	case *ast.MemberExpression:
+		obj, ok := env.GetIdentifier(node.Object)
+		if !ok {
+			return newError("identifier not found: %s", node.Object.Value)
+		}
+		return GetMember(obj, node.Object.Value, node.Member.Value)
+	default:
+		return NULL
+	}
+}
@@ -0,0 +1,247 @@
+package object
+
+import (
+	"math/big"
+	"strings"
+)
+
+// Arithmetic is how an interpreter computes numbers. The zero value promotes
+// integers that overflow and rounds decimals to DefaultPrecision digits, half to even
+type Arithmetic struct {
+	Overflow  OverflowMode
+	Precision int          // The significant digits of a decimal result. 0 means DefaultPrecision
+	Rounding  RoundingMode // How a decimal result with more digits than Precision is rounded
+}
+
+const DefaultPrecision = 28
+
+// DecimalPrecision returns the significant digits of a decimal result
+func (a Arithmetic) DecimalPrecision() int {
+	if a.Precision <= 0 {
+		return DefaultPrecision
+	}
+	return a.Precision
+}
+
+// OverflowMode decides what integer arithmetic does when the result doesn't fit in 64 bits
+type OverflowMode int
+
+const (
+	PromoteOnOverflow OverflowMode = iota // The result becomes a BigInteger
+	ErrorOnOverflow                       // The operation is an error
+)
+
+// RoundingMode decides which way a decimal is rounded when digits are dropped
+type RoundingMode int
+
+const (
+	RoundHalfEven RoundingMode = iota // To the nearest, or the even one when it's halfway
+	RoundHalfUp                       // To the nearest, or away from zero when it's halfway
+	RoundHalfDown                     // To the nearest, or towards zero when it's halfway
+	RoundUp                           // Away from zero
+	RoundDown                         // Towards zero
+	RoundCeiling                      // Towards positive infinity
+	RoundFloor                        // Towards negative infinity
+)
+
+var roundingModes = map[string]RoundingMode{
+	"half-even": RoundHalfEven,
+	"half-up":   RoundHalfUp,
+	"half-down": RoundHalfDown,
+	"up":        RoundUp,
+	"down":      RoundDown,
+	"ceiling":   RoundCeiling,
+	"floor":     RoundFloor,
+}
+
+// ParseRoundingMode returns the rounding mode with the given name, like "half-up"
+func ParseRoundingMode(name string) (RoundingMode, bool) {
+	mode, ok := roundingModes[name]
+	return mode, ok
+}
+
+// Number is implemented by every numeric type
+type Number interface {
+	Object
+	NumberType()
+	Float() float64 // The nearest real
+}
+
+func (i *Integer) Float() float64 { return float64(i.Value) }
+func (r *Real) Float() float64    { return r.Value }
+
+func (b *BigInteger) Float() float64 {
+	value, _ := new(big.Float).SetInt(b.Value).Float64()
+	return value
+}
+
+// Decimal is Coefficient * 10^Exponent, so decimal fractions like 0.1 are exact.
+// The exponent is kept, so 1.10 and 1.1 are equal but print differently
+type Decimal struct {
+	Coefficient *big.Int
+	Exponent    int
+}
+
+func (d *Decimal) NumberType()      {}
+func (d *Decimal) Type() ObjectType { return DECIMAL_OBJ }
+func (d *Decimal) Float() float64   { value, _ := d.Rat().Float64(); return value }
+func (d *Decimal) HashKey() HashKey { return exactHashKey(d.Rat()) }
+
+func (d *Decimal) Inspect() string {
+	sign := ""
+	if d.Coefficient.Sign() < 0 {
+		sign = "-"
+	}
+	digits := new(big.Int).Abs(d.Coefficient).String()
+
+	if d.Exponent >= 0 {
+		return sign + digits + strings.Repeat("0", d.Exponent)
+	}
+	places := -d.Exponent
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+}
+
+// Rat returns the exact value of the decimal
+func (d *Decimal) Rat() *big.Rat {
+	if d.Exponent >= 0 {
+		return new(big.Rat).SetInt(new(big.Int).Mul(d.Coefficient, pow10(d.Exponent)))
+	}
+	return new(big.Rat).SetFrac(d.Coefficient, pow10(-d.Exponent))
+}
+
+// Round returns d with exactly places digits after the point
+func (d *Decimal) Round(places int, mode RoundingMode) *Decimal {
+	extra := -d.Exponent - places
+	if extra > 0 {
+		return &Decimal{Coefficient: roundCoefficient(d.Coefficient, extra, mode), Exponent: -places}
+	}
+	return &Decimal{Coefficient: new(big.Int).Mul(d.Coefficient, pow10(-extra)), Exponent: -places}
+}
+
+// NewDecimal returns coefficient * 10^exponent, rounded to precision significant digits
+func NewDecimal(coefficient *big.Int, exponent, precision int, mode RoundingMode) *Decimal {
+	if extra := NumDigits(coefficient) - precision; extra > 0 {
+		coefficient = roundCoefficient(coefficient, extra, mode)
+		exponent += extra
+
+		if NumDigits(coefficient) > precision {
+			// Rounding carried into a new digit, like 999 to 1000, so the last digit is 0
+			coefficient.Quo(coefficient, big.NewInt(10))
+			exponent++
+		}
+	}
+	return &Decimal{Coefficient: coefficient, Exponent: exponent}
+}
+
+// ParseDecimal reads a decimal like "-1.10". It returns false if text isn't one
+func ParseDecimal(text string) (*Decimal, bool) {
+	digits := strings.TrimPrefix(text, "-")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole+fraction == "" || strings.Trim(whole+fraction, "0123456789") != "" {
+		return nil, false
+	}
+
+	coefficient, _ := new(big.Int).SetString(whole+fraction, 10)
+	if len(digits) < len(text) {
+		coefficient.Neg(coefficient)
+	}
+	return &Decimal{Coefficient: coefficient, Exponent: -len(fraction)}, true
+}
+
+// roundCoefficient drops the last digits of coefficient and rounds what is left with mode
+func roundCoefficient(coefficient *big.Int, digits int, mode RoundingMode) *big.Int {
+	divisor := pow10(digits)
+	quotient, remainder := new(big.Int).QuoRem(coefficient, divisor, new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient
+	}
+
+	// half compares the dropped digits with a half
+	twice := new(big.Int).Lsh(remainder.Abs(remainder), 1)
+	half := twice.Cmp(divisor)
+	sign := coefficient.Sign()
+
+	var away bool
+	switch mode {
+	case RoundHalfEven:
+		away = half > 0 || half == 0 && quotient.Bit(0) == 1
+	case RoundHalfUp:
+		away = half >= 0
+	case RoundHalfDown:
+		away = half > 0
+	case RoundUp:
+		away = true
+	case RoundCeiling:
+		away = sign > 0
+	case RoundFloor:
+		away = sign < 0
+	}
+
+	if away {
+		quotient.Add(quotient, big.NewInt(int64(sign)))
+	}
+	return quotient
+}
+
+// NumDigits returns the number of decimal digits of x
+func NumDigits(x *big.Int) int {
+	if x.Sign() == 0 {
+		return 1
+	}
+	return len(new(big.Int).Abs(x).String())
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// Rational is an exact fraction
+type Rational struct {
+	Value *big.Rat
+}
+
+func (r *Rational) NumberType()      {}
+func (r *Rational) Type() ObjectType { return RATIONAL_OBJ }
+func (r *Rational) Inspect() string  { return r.Value.RatString() }
+func (r *Rational) Float() float64   { value, _ := r.Value.Float64(); return value }
+func (r *Rational) HashKey() HashKey { return exactHashKey(r.Value) }
+
+// exactHashKey is the hash key of an exact number. It is the hash key of the
+// integer or real it is equal to, since numbers that are equal are the same key
+func exactHashKey(value *big.Rat) HashKey {
+	if !value.IsInt() {
+		f, _ := value.Float64()
+		return (&Real{Value: f}).HashKey()
+	}
+	if value.Num().IsInt64() {
+		return (&Integer{Value: value.Num().Int64()}).HashKey()
+	}
+	return (&BigInteger{Value: value.Num()}).HashKey()
+}
+
+// numbersEqual compares numbers like == does. A real is only about equal to
+// an exact number, so they are compared as reals
+func numbersEqual(a, b Number) bool {
+	_, aReal := a.(*Real)
+	_, bReal := b.(*Real)
+	if aReal || bReal {
+		return a.Float() == b.Float()
+	}
+	return exactValue(a).Cmp(exactValue(b)) == 0
+}
+
+func exactValue(n Number) *big.Rat {
+	switch n := n.(type) {
+	case *Integer:
+		return new(big.Rat).SetInt64(n.Value)
+	case *BigInteger:
+		return new(big.Rat).SetInt(n.Value)
+	case *Decimal:
+		return n.Rat()
+	default:
+		return n.(*Rational).Value
+	}
+}
@@ -0,0 +1,107 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestRealInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{0.30000000000000004, "0.30000000000000004"},
+		{2.5, "2.5"},
+		{3, "3.0"},
+		{-0.75, "-0.75"},
+		{0, "0.0"},
+		{123456789.125, "123456789.125"},
+		{1e21, "1000000000000000000000.0"},
+		{1e23, "100000000000000000000000.0"},
+		{-2.5e22, "-25000000000000000000000.0"},
+		{0.00001, "0.00001"},
+		{1e-06, "0.000001"},
+		{-1.25e-10, "-0.000000000125"},
+		{math.Inf(1), "+Inf"},
+	}
+
+	for _, tt := range tests {
+		if actual := (&Real{Value: tt.value}).Inspect(); actual != tt.expected {
+			t.Errorf("wrong text for %v. expected=%q, got=%q", tt.value, tt.expected, actual)
+		}
+	}
+}
+
+func TestDecimalRound(t *testing.T) {
+	tests := []struct {
+		decimal  string
+		places   int
+		mode     RoundingMode
+		expected string
+	}{
+		{"2.675", 2, RoundHalfEven, "2.68"},
+		{"2.665", 2, RoundHalfEven, "2.66"},
+		{"2.665", 2, RoundHalfUp, "2.67"},
+		{"2.665", 2, RoundHalfDown, "2.66"},
+		{"2.6651", 2, RoundHalfDown, "2.67"},
+		{"2.661", 2, RoundUp, "2.67"},
+		{"2.669", 2, RoundDown, "2.66"},
+		{"-2.661", 2, RoundCeiling, "-2.66"},
+		{"-2.661", 2, RoundFloor, "-2.67"},
+		{"-2.5", 0, RoundHalfEven, "-2"},
+		{"9.99", 1, RoundHalfUp, "10.0"},
+		{"1.5", 3, RoundHalfEven, "1.500"},
+		{"1250", -2, RoundHalfEven, "1200"},
+	}
+
+	for _, tt := range tests {
+		decimal, ok := ParseDecimal(tt.decimal)
+		if !ok {
+			t.Fatalf("could not parse %q", tt.decimal)
+		}
+		if actual := decimal.Round(tt.places, tt.mode).Inspect(); actual != tt.expected {
+			t.Errorf("wrong rounding of %s to %d places. expected=%s, got=%s", tt.decimal, tt.places, tt.expected, actual)
+		}
+	}
+}
+
+func TestNewDecimalPrecision(t *testing.T) {
+	decimal := NewDecimal(big.NewInt(99995), -4, 4, RoundHalfEven)
+	if decimal.Inspect() != "10.00" {
+		t.Errorf("wrong rounding to 4 digits. expected=10.00, got=%s", decimal.Inspect())
+	}
+
+	decimal = NewDecimal(big.NewInt(123), -2, 4, RoundHalfEven)
+	if decimal.Inspect() != "1.23" {
+		t.Errorf("decimal with fewer digits than the precision changed. got=%s", decimal.Inspect())
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for _, text := range []string{"1.10", "-0.05", "5", ".5", "7."} {
+		if _, ok := ParseDecimal(text); !ok {
+			t.Errorf("could not parse %q", text)
+		}
+	}
+	for _, text := range []string{"", ".", "abc", "1.2.3", "--1", "1e5", "+1"} {
+		if _, ok := ParseDecimal(text); ok {
+			t.Errorf("parsed %q", text)
+		}
+	}
+}
+
+func TestExactNumberHashKeys(t *testing.T) {
+	half, _ := ParseDecimal("0.50")
+	one, _ := ParseDecimal("1.0")
+
+	if half.HashKey() != (&Real{Value: 0.5}).HashKey() {
+		t.Errorf("0.50 and 0.5 have different hash keys")
+	}
+	if half.HashKey() != (&Rational{Value: big.NewRat(1, 2)}).HashKey() {
+		t.Errorf("0.50 and 1/2 have different hash keys")
+	}
+	if one.HashKey() != (&Integer{Value: 1}).HashKey() {
+		t.Errorf("1.0 and 1 have different hash keys")
+	}
+}
@@ -2,18 +2,31 @@ package object
 
 import (
 	"Pron-Lang/ast"
+	"Pron-Lang/code"
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 )
 
 type ObjectType string
-type BuiltinFunction func(args ...Object) Object
+
+// BuiltinFunction gets the Applier of the evaluator or vm it runs in, so it can call functions
+type BuiltinFunction func(apply Applier, args ...Object) Object
+
+// Applier calls a function with arguments. The evaluator and the vm each
+// have their own, so builtins and operators that call functions work with both
+type Applier func(fn Object, args []Object) Object
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	BIG_INTEGER_OBJ  = "BIG_INTEGER"
 	REAL_OBJ         = "REAL"
+	DECIMAL_OBJ      = "DECIMAL"
+	RATIONAL_OBJ     = "RATIONAL"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
@@ -23,8 +36,18 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	SET_OBJ          = "SET"
 	CLASS_OBJ        = "CLASS"
+	ENUM_OBJ         = "ENUM"
+	ENUM_MEMBER_OBJ  = "ENUM_MEMBER"
+	TASK_OBJ         = "TASK"
+	CHANNEL_OBJ      = "CHANNEL"
+	PROMISE_OBJ      = "PROMISE"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
 	INITFUNCTION_OBJ = "INITFUNCTION"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type Object interface {
@@ -44,13 +67,35 @@ func (i *Integer) NumberType()      {}
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+// BigInteger is an integer that doesn't fit in an Integer. Arithmetic only
+// returns one when the result is too big, so it never holds a value an Integer could
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (b *BigInteger) NumberType()      {}
+func (b *BigInteger) Type() ObjectType { return BIG_INTEGER_OBJ }
+func (b *BigInteger) Inspect() string  { return b.Value.String() }
+
 type Real struct {
 	Value float64
 }
 
 func (r *Real) NumberType()      {}
 func (r *Real) Type() ObjectType { return REAL_OBJ }
-func (r *Real) Inspect() string  { return fmt.Sprintf("%f", r.Value) }
+
+// Inspect returns the shortest text that reads as the same real
+func (r *Real) Inspect() string {
+	// No exponent, since the lexer can't read one back
+	text := strconv.FormatFloat(r.Value, 'f', -1, 64)
+	if math.IsInf(r.Value, 0) || math.IsNaN(r.Value) {
+		return text
+	}
+	if !strings.Contains(text, ".") {
+		text += ".0"
+	}
+	return text
+}
 
 type Boolean struct {
 	Value bool
@@ -80,20 +125,24 @@ func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression
+	Variadic   bool
 	Body       *ast.BlockStatement
 	Env        *Environment
 	IsPublic   bool
+	Async      bool
+	Locals     []string
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, param := range f.Parameters {
-		params = append(params, param.String())
-	}
+	params := ast.ParameterStrings(f.Parameters, f.Defaults, f.Variadic)
 
+	if f.Async {
+		out.WriteString("async ")
+	}
 	out.WriteString("func")
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
@@ -104,6 +153,22 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// Quote is code as a value, which a macro returns to replace its call with
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+// Macro is a function that is called with the code of its arguments
+type Macro struct {
+	Function *Function
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string  { return "macro" }
+
 type String struct {
 	Value string
 }
@@ -111,15 +176,32 @@ type String struct {
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 
+// TaskFunction is a builtin that needs the task it runs in, like wait and receive
+type TaskFunction func(task *Task, apply Applier, args ...Object) Object
+
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn     BuiltinFunction
+	TaskFn TaskFunction // used instead of Fn when it's set
+}
+
+// Call runs the builtin in task
+func (b *Builtin) Call(task *Task, apply Applier, args ...Object) Object {
+	if b.TaskFn != nil {
+		return b.TaskFn(task, apply, args...)
+	}
+	return b.Fn(apply, args...)
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 
+// Array is immutable. Changing it creates a new array that shares its elements
 type Array struct {
-	Elements []Object
+	Elements *Vector
+}
+
+func NewArray(elements []Object) *Array {
+	return &Array{Elements: NewVector(elements)}
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
@@ -127,7 +209,7 @@ func (ao *Array) Inspect() string {
 	var out bytes.Buffer
 
 	elements := []string{}
-	for _, e := range ao.Elements {
+	for _, e := range ao.Elements.Values() {
 		elements = append(elements, e.Inspect())
 	}
 
@@ -165,13 +247,106 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
+// HashKey of a big integer that is exactly a real is the hash key of the real,
+// since they are equal
+func (b *BigInteger) HashKey() HashKey {
+	if f, accuracy := new(big.Float).SetInt(b.Value).Float64(); accuracy == big.Exact {
+		return (&Real{Value: f}).HashKey()
+	}
+	h := fnv.New64a()
+	h.Write([]byte{byte(b.Value.Sign() + 1)})
+	h.Write(b.Value.Bytes())
+	return HashKey{Type: INTEGER_OBJ, Value: h.Sum64()}
+}
+
+// HashKey of a real with an integer value is the hash key of the integer,
+// since 1 == 1.0 means they are the same key
+func (r *Real) HashKey() HashKey {
+	if r.Value == math.Trunc(r.Value) && math.Abs(r.Value) < math.MaxInt64 {
+		return HashKey{Type: INTEGER_OBJ, Value: uint64(int64(r.Value))}
+	}
+	return HashKey{Type: r.Type(), Value: math.Float64bits(r.Value)}
+}
+
+// ComputedKey is a key whose hash key the evaluator or the vm has worked out,
+// since it depends on the Hash and Equals methods of classes. Arrays and
+// class instances are used as keys through it
+type ComputedKey struct {
+	Object Object
+	Key    HashKey
+	Equals func(other Object) (bool, *Error)
+	err    *Error // The first error of Equals. The key matches nothing after it
+}
+
+func (k *ComputedKey) HashKey() HashKey { return k.Key }
+
+func (k *ComputedKey) equals(other Object) bool {
+	if k.err != nil {
+		return false
+	}
+	equal, err := k.Equals(other)
+	k.err = err
+	return equal && err == nil
+}
+
+// keyError returns the error key ran into while it was compared with the
+// keys of a map. A map only finds keys, so Hash and Set pass the error on
+func keyError(key Hashable) *Error {
+	if computed, ok := key.(*ComputedKey); ok {
+		return computed.err
+	}
+	return nil
+}
+
 type HashPair struct {
 	Key   Object
 	Value Object
 }
 
+// Hash is immutable. Changing it creates a new hash that shares its pairs.
+// The pairs are kept in the order their keys were first added
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	Pairs *Map
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: NewMap()}
+}
+
+// Get returns the pair of key, and whether the hash has it
+func (h *Hash) Get(key Hashable) (HashPair, bool, *Error) {
+	pair, ok := h.Pairs.Get(key)
+	if err := keyError(key); err != nil {
+		return HashPair{}, false, err
+	}
+	return pair, ok, nil
+}
+
+// Set returns a hash where key is bound to value
+func (h *Hash) Set(key Hashable, value Object) (*Hash, *Error) {
+	pairs := h.Pairs.Set(key, value)
+	if err := keyError(key); err != nil {
+		return nil, err
+	}
+	return &Hash{Pairs: pairs}, nil
+}
+
+// Delete returns a hash without key
+func (h *Hash) Delete(key Hashable) (*Hash, *Error) {
+	pairs := h.Pairs.Delete(key)
+	if err := keyError(key); err != nil {
+		return nil, err
+	}
+	return &Hash{Pairs: pairs}, nil
+}
+
+// Keys returns the keys of the hash in the order they were added
+func (h *Hash) Keys() []Object {
+	keys := []Object{}
+	for _, pair := range h.Pairs.Pairs() {
+		keys = append(keys, pair.Key)
+	}
+	return keys
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -179,7 +354,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Pairs.Pairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 
@@ -190,6 +365,71 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// Set is immutable. Changing it creates a new set that shares its elements.
+// The elements are kept in the order they were first added
+type Set struct {
+	Elements *Map
+}
+
+func NewSet() *Set {
+	return &Set{Elements: NewMap()}
+}
+
+// Add returns a set with elem in it
+func (s *Set) Add(elem Hashable) (*Set, *Error) {
+	ok, err := s.Contains(elem)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return s, nil
+	}
+	return &Set{Elements: s.Elements.Set(elem, keyObject(elem))}, nil
+}
+
+// Remove returns a set without elem
+func (s *Set) Remove(elem Hashable) (*Set, *Error) {
+	elements := s.Elements.Delete(elem)
+	if err := keyError(elem); err != nil {
+		return nil, err
+	}
+	return &Set{Elements: elements}, nil
+}
+
+func (s *Set) Contains(elem Hashable) (bool, *Error) {
+	_, ok := s.Elements.Get(elem)
+	return ok, keyError(elem)
+}
+
+func (s *Set) Len() int {
+	return s.Elements.Len()
+}
+
+// Values returns the elements of the set in the order they were added
+func (s *Set) Values() []Object {
+	values := []Object{}
+	for _, pair := range s.Elements.Pairs() {
+		values = append(values, pair.Key)
+	}
+	return values
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+func (s *Set) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range s.Values() {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("#{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
 type ClassInstance struct {
 	Name string // Name of class
 	Env  *Environment
@@ -198,10 +438,92 @@ type ClassInstance struct {
 func (ci *ClassInstance) Type() ObjectType { return CLASS_OBJ }
 func (ci *ClassInstance) Inspect() string  { return "Class: " + ci.Name }
 
+// Instantiate returns a copy of the class, where the methods
+// are bound to the env of the copy instead of the class
+func (ci *ClassInstance) Instantiate() *ClassInstance {
+	instance := &ClassInstance{Name: ci.Name, Env: ci.Env.GetCopyOfEnvWithOuterEnvNil()}
+
+	for i, value := range instance.Env.store {
+		switch value := value.(type) {
+		case *Function:
+			if value.Env == ci.Env {
+				bound := *value
+				bound.Env = instance.Env
+				instance.Env.store[i] = &bound
+			}
+		case *InitFunction:
+			if value.Env == ci.Env {
+				bound := *value
+				bound.Env = instance.Env
+				instance.Env.store[i] = &bound
+			}
+		case *Closure:
+			if value.Env == ci.Env {
+				bound := *value
+				bound.Env = instance.Env
+				instance.Env.store[i] = &bound
+			}
+		}
+	}
+
+	return instance
+}
+
+// Enum is a type with a fixed list of named members
+type Enum struct {
+	Name    string
+	Members []*EnumMember // in the order they were declared
+}
+
+func NewEnum(name string, memberNames []string) *Enum {
+	enum := &Enum{Name: name}
+	for i, memberName := range memberNames {
+		enum.Members = append(enum.Members, &EnumMember{Enum: enum, Name: memberName, Ordinal: i})
+	}
+	return enum
+}
+
+func (e *Enum) Type() ObjectType { return ENUM_OBJ }
+func (e *Enum) Inspect() string {
+	names := []string{}
+	for _, member := range e.Members {
+		names = append(names, member.Name)
+	}
+	return "enum " + e.Name + " {" + strings.Join(names, ", ") + "}"
+}
+
+// Member returns the member with the given name
+func (e *Enum) Member(name string) (*EnumMember, bool) {
+	for _, member := range e.Members {
+		if member.Name == name {
+			return member, true
+		}
+	}
+	return nil, false
+}
+
+// EnumMember is one of the values of an Enum. There is only one of each
+// member, so a member is only equal to itself
+type EnumMember struct {
+	Enum    *Enum
+	Name    string
+	Ordinal int
+}
+
+func (em *EnumMember) Type() ObjectType { return ENUM_MEMBER_OBJ }
+func (em *EnumMember) Inspect() string  { return em.Enum.Name + "." + em.Name }
+func (em *EnumMember) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(em.Inspect()))
+
+	return HashKey{Type: em.Type(), Value: h.Sum64()}
+}
+
 type InitFunction struct {
 	Parameters []*ast.InitParam
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Locals     []string
 }
 
 func (i *InitFunction) Type() ObjectType { return INITFUNCTION_OBJ }
@@ -210,12 +532,7 @@ func (i *InitFunction) Inspect() string {
 
 	params := []string{}
 	for _, param := range i.Parameters {
-		if param.IsThisParam {
-			params = append(params, "this."+param.String())
-		} else {
-			params = append(params, param.String())
-		}
-
+		params = append(params, param.Declaration())
 	}
 
 	out.WriteString("init")
@@ -227,3 +544,47 @@ func (i *InitFunction) Inspect() string {
 
 	return out.String()
 }
+
+// CompiledFunction is a function the compiler has turned into bytecode
+type CompiledFunction struct {
+	Instructions code.Instructions
+	Parameters   []*ast.Identifier
+	Defaults     []ast.Expression
+	DefaultFns   []*CompiledFunction // compute the defaults in the env of the call
+	Variadic     bool
+	ThisParams   []bool // which parameters of an Init are 'this.' parameters
+	Locals       []string
+	Body         *ast.BlockStatement
+	IsPublic     bool
+	Async        bool
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is a CompiledFunction together with the env it was created in.
+// It's the vm's counterpart to Function and has the same type and output.
+type Closure struct {
+	Fn  *CompiledFunction
+	Env *Environment
+}
+
+func (c *Closure) Type() ObjectType {
+	if c.Fn.ThisParams != nil {
+		return INITFUNCTION_OBJ
+	}
+	return FUNCTION_OBJ
+}
+func (c *Closure) Inspect() string {
+	function := &Function{Parameters: c.Fn.Parameters, Defaults: c.Fn.Defaults, Variadic: c.Fn.Variadic, Body: c.Fn.Body, Async: c.Fn.Async}
+	if c.Fn.ThisParams != nil {
+		params := []*ast.InitParam{}
+		for i, param := range c.Fn.Parameters {
+			params = append(params, &ast.InitParam{Parameter: param, IsThisParam: c.Fn.ThisParams[i], Default: c.Fn.Defaults[i]})
+		}
+		return (&InitFunction{Parameters: params, Body: c.Fn.Body}).Inspect()
+	}
+	return function.Inspect()
+}
@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"runtime/debug"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -58,3 +61,21 @@ func TestBooleanHashKey(t *testing.T) {
 		t.Errorf("bools with different content have same hash keys")
 	}
 }
+
+func TestSetMaxDepthRaisesMaxStack(t *testing.T) {
+	defer SetMaxDepth(DefaultMaxDepth)
+
+	SetMaxDepth(MaxDepthLimit)
+	stack := debug.SetMaxStack(defaultMaxStack)
+	if MaxDepth != MaxDepthLimit {
+		t.Errorf("MaxDepth wrong. expected=%d, got=%d", MaxDepthLimit, MaxDepth)
+	}
+	if stack < MaxDepthLimit*stackPerCall {
+		t.Errorf("max stack too small for %d calls. got=%d", MaxDepthLimit, stack)
+	}
+
+	SetMaxDepth(DefaultMaxDepth)
+	if stack := debug.SetMaxStack(defaultMaxStack); stack != defaultMaxStack {
+		t.Errorf("max stack not back to the default. expected=%d, got=%d", defaultMaxStack, stack)
+	}
+}
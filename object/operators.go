@@ -0,0 +1,319 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// The operators here are the semantics of the language. The evaluator and
+// the vm both use them, so the two run a program the same way
+
+// NULL, TRUE and FALSE are the only null and boolean values, so they can be
+// compared by identity
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// smallIntegers are shared by every integer in their range, so
+// forloops and arithmetic don't allocate for the most common values
+var smallIntegers = func() []*Integer {
+	integers := make([]*Integer, 1280)
+	for i := range integers {
+		integers[i] = &Integer{Value: int64(i) - 256}
+	}
+	return integers
+}()
+
+// NewInteger returns an integer with value, which is shared when value is small
+func NewInteger(value int64) *Integer {
+	if value >= -256 && value < 1024 {
+		return smallIntegers[value+256]
+	}
+	return &Integer{Value: value}
+}
+
+// NewBoolean returns TRUE or FALSE
+func NewBoolean(input bool) *Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+// Prefix applies the prefix operator !, - or ~ to right
+func Prefix(operator string, right Object, arithmetic Arithmetic) Object {
+	switch operator {
+	case "!":
+		return not(right)
+	case "-":
+		return negate(right, arithmetic)
+	case "~":
+		return bitwiseNot(right, arithmetic)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func not(right Object) Object {
+	switch right {
+	case TRUE:
+		return FALSE
+	case FALSE:
+		return TRUE
+	case NULL:
+		return TRUE
+	default:
+		return FALSE
+	}
+}
+
+func negate(right Object, arithmetic Arithmetic) Object {
+	if right.Type() == INTEGER_OBJ && right.(*Integer).Value != math.MinInt64 {
+		value := right.(*Integer).Value
+		return &Integer{Value: -value}
+	} else if isInteger(right) {
+		value := new(big.Int).Neg(bigValue(right))
+		return NewBigInteger(value, arithmetic, "-(%s)", right.Inspect())
+	} else if right.Type() == REAL_OBJ {
+		value := right.(*Real).Value
+		return &Real{Value: -value}
+	} else if right.Type() == DECIMAL_OBJ {
+		decimal := right.(*Decimal)
+		return &Decimal{Coefficient: new(big.Int).Neg(decimal.Coefficient), Exponent: decimal.Exponent}
+	} else if right.Type() == RATIONAL_OBJ {
+		return &Rational{Value: new(big.Rat).Neg(right.(*Rational).Value)}
+	} else {
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
+// Infix applies a binary operator to left and right. apply calls the methods
+// an operator needs, like Equals, and numbers are computed with arithmetic
+func Infix(operator string, left, right Object, apply Applier, arithmetic Arithmetic) Object {
+	switch {
+	case operator == "in":
+		return contains(left, right, apply)
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return stringInfix(operator, left, right)
+	case left.Type() == ARRAY_OBJ && right.Type() == ARRAY_OBJ:
+		return arrayInfix(operator, left, right, apply)
+	case left.Type() == HASH_OBJ && right.Type() == HASH_OBJ:
+		return hashInfix(operator, left, right, apply)
+	case operator == "*" && (isRepeatable(left) && isInteger(right) || isInteger(left) && isRepeatable(right)):
+		return repetition(left, right)
+	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
+		return integerInfix(operator, left, right, arithmetic)
+	case isInteger(left) && isInteger(right):
+		return bigIntegerInfix(operator, left, right, arithmetic)
+	case isNumber(left) && isNumber(right):
+		return numberInfix(operator, left, right, arithmetic)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case operator == "==" || operator == "!=":
+		return equality(operator, left, right, apply)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func integerInfix(operator string, left, right Object, arithmetic Arithmetic) Object {
+	leftValue := left.(*Integer).Value
+	rightValue := right.(*Integer).Value
+
+	switch operator {
+	case "+":
+		if sum, ok := AddInt64(leftValue, rightValue); ok {
+			return NewInteger(sum)
+		}
+	case "-":
+		if difference, ok := SubInt64(leftValue, rightValue); ok {
+			return NewInteger(difference)
+		}
+	case "*":
+		if product, ok := MulInt64(leftValue, rightValue); ok {
+			return NewInteger(product)
+		}
+	case "/":
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
+		if leftValue != math.MinInt64 || rightValue != -1 {
+			return NewInteger(leftValue / rightValue)
+		}
+	case "%":
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
+		return NewInteger(leftValue % rightValue)
+	case "//":
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
+		if leftValue != math.MinInt64 || rightValue != -1 {
+			return NewInteger(floorDivInt64(leftValue, rightValue))
+		}
+	case "**":
+		if rightValue < 0 {
+			return negativePower(left, right)
+		}
+		if power, ok := powInt64(leftValue, rightValue); ok {
+			return NewInteger(power)
+		}
+	case "&":
+		return NewInteger(leftValue & rightValue)
+	case "|":
+		return NewInteger(leftValue | rightValue)
+	case "^":
+		return NewInteger(leftValue ^ rightValue)
+	case "<<":
+		if rightValue < 0 {
+			return newError("negative shift count: %d", rightValue)
+		}
+		if rightValue < 63 && leftValue<<rightValue>>rightValue == leftValue {
+			return NewInteger(leftValue << rightValue)
+		}
+	case ">>":
+		if rightValue < 0 {
+			return newError("negative shift count: %d", rightValue)
+		}
+		return NewInteger(leftValue >> min(rightValue, 63))
+	case "<":
+		return NewBoolean(leftValue < rightValue)
+	case ">":
+		return NewBoolean(leftValue > rightValue)
+	case "==":
+		return NewBoolean(leftValue == rightValue)
+	case "!=":
+		return NewBoolean(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	// The result doesn't fit in 64 bits
+	return bigIntegerInfix(operator, left, right, arithmetic)
+}
+
+func realInfix(operator string, left, right Object) Object {
+	leftValue := realValue(left)
+	rightValue := realValue(right)
+
+	switch operator {
+	case "+":
+		return &Real{Value: leftValue + rightValue}
+	case "-":
+		return &Real{Value: leftValue - rightValue}
+	case "*":
+		return &Real{Value: leftValue * rightValue}
+	case "/":
+		return &Real{Value: leftValue / rightValue}
+	case "%":
+		return &Real{Value: math.Mod(leftValue, rightValue)}
+	case "//":
+		return &Real{Value: math.Floor(leftValue / rightValue)}
+	case "**":
+		return &Real{Value: math.Pow(leftValue, rightValue)}
+	case "<":
+		return NewBoolean(leftValue < rightValue)
+	case ">":
+		return NewBoolean(leftValue > rightValue)
+	case "==":
+		return NewBoolean(leftValue == rightValue)
+	case "!=":
+		return NewBoolean(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// IsTruthy reports whether obj counts as true in a condition. Only null
+// and false don't
+func IsTruthy(obj Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func stringInfix(operator string, left, right Object) Object {
+	switch operator {
+	case "+":
+		leftVal := left.(*String).Value
+		rightVal := right.(*String).Value
+		return &String{Value: leftVal + rightVal}
+	case "==":
+		leftVal := left.(*String).Value
+		rightVal := right.(*String).Value
+		return NewBoolean(leftVal == rightVal)
+	case "!=":
+		leftVal := left.(*String).Value
+		rightVal := right.(*String).Value
+		return NewBoolean(leftVal != rightVal)
+	case "<":
+		leftVal := left.(*String).Value
+		rightVal := right.(*String).Value
+		return NewBoolean(leftVal < rightVal)
+	case ">":
+		leftVal := left.(*String).Value
+		rightVal := right.(*String).Value
+		return NewBoolean(leftVal > rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// Index returns left[index] for an array or a hash, or NULL when there is
+// no such element. apply calls the Hash and Equals methods of a key
+func Index(left, index Object, apply Applier) Object {
+	switch {
+	case left.Type() == ARRAY_OBJ && index.Type() == INTEGER_OBJ:
+		return arrayIndex(left, index)
+	case left.Type() == HASH_OBJ:
+		return hashIndex(left, index, apply)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+func arrayIndex(array, index Object) Object {
+	arrayObject := array.(*Array)
+	idx := index.(*Integer).Value
+	max := int64(arrayObject.Elements.Len() - 1)
+
+	if idx < 0 || idx > max {
+		return NULL
+	}
+
+	return arrayObject.Elements.Get(int(idx))
+}
+
+func hashIndex(hash, index Object, apply Applier) Object {
+	hashObject := hash.(*Hash)
+
+	key, err := AsKey(index, apply)
+	if err != nil {
+		return err
+	}
+
+	pair, ok, err := hashObject.Get(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
@@ -0,0 +1,80 @@
+package object
+
+// BuildSet returns a set of elements. Elements that are equal are only in it once
+func BuildSet(elements []Object, apply Applier) Object {
+	set := NewSet()
+
+	for _, elem := range elements {
+		key, err := AsKey(elem, apply)
+		if err != nil {
+			return err
+		}
+		set, err = set.Add(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return set
+}
+
+// setOperation combines two sets. keep decides if an element of one of the
+// sets is in the result, from whether it is in the left and the right set
+func setOperation(name string, args []Object, apply Applier,
+	keep func(inLeft, inRight bool) bool) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	left, ok := args[0].(*Set)
+	if !ok {
+		return newError("argument to `%s` must be SET, got %s", name, args[0].Type())
+	}
+	right, ok := args[1].(*Set)
+	if !ok {
+		return newError("argument to `%s` must be SET, got %s", name, args[1].Type())
+	}
+
+	result := NewSet()
+	for _, elems := range [][]Object{left.Values(), right.Values()} {
+		for _, elem := range elems {
+			key, err := AsKey(elem, apply)
+			if err != nil {
+				return err
+			}
+			inLeft, err := left.Contains(key)
+			if err != nil {
+				return err
+			}
+			inRight, err := right.Contains(key)
+			if err != nil {
+				return err
+			}
+			if keep(inLeft, inRight) {
+				result, err = result.Add(key)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// isSubset reports whether every element of left is in right
+func isSubset(left, right *Set, apply Applier) (bool, *Error) {
+	if left.Len() > right.Len() {
+		return false, nil
+	}
+
+	for _, elem := range left.Values() {
+		key, err := AsKey(elem, apply)
+		if err != nil {
+			return false, err
+		}
+		if ok, err := right.Contains(key); !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,518 @@
+package object
+
+import (
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+var lastTaskID atomic.Int64
+
+// clock is a vector clock: how far each task had come when something happened
+type clock map[int]int
+
+func (c clock) copy() clock {
+	copied := make(clock, len(c))
+	for id, time := range c {
+		copied[id] = time
+	}
+	return copied
+}
+
+// join moves c forward to everything other has seen
+func (c clock) join(other clock) {
+	for id, time := range other {
+		if time > c[id] {
+			c[id] = time
+		}
+	}
+}
+
+// epoch is a moment in a task: its id and the time on its own clock
+type epoch struct {
+	task int
+	time int
+}
+
+// Task is the program, or a function started by spawn that runs on a
+// goroutine of its own. Its clock orders what it does against the other
+// tasks, so two tasks that assign a variable without waiting for each other
+// can be reported
+type Task struct {
+	ID    int
+	Depth int     // the number of function calls running in the task
+	Apply Applier // calls functions in the task, set by the interpreter that runs it
+	Loop  *Loop   // the event loop of the program, which the tasks it spawns share
+
+	co       *coroutine // the async function the task runs, or nil
+	clock    clock
+	done     chan struct{}
+	finished bool // guarded by sched, like result and final
+	result   Object
+	final    clock // the clock when the task finished
+}
+
+// NewTask creates the task a program runs in
+func NewTask() *Task {
+	loop := NewLoop(SystemClock)
+	loop.tasks = 1
+	return newTask(loop)
+}
+
+func newTask(loop *Loop) *Task {
+	id := int(lastTaskID.Add(1))
+	return &Task{ID: id, Loop: loop, clock: clock{id: 1}, done: make(chan struct{})}
+}
+
+func (t *Task) Type() ObjectType { return TASK_OBJ }
+func (t *Task) Inspect() string  { return "task" }
+
+// Concurrent tells whether a second task of the program has started
+func (t *Task) Concurrent() bool {
+	return t.Loop.concurrent.Load()
+}
+
+// Spawn creates a task that starts after everything t has done so far
+func (t *Task) Spawn() *Task {
+	t.Loop.concurrent.Store(true)
+	child := newTask(t.Loop)
+	child.clock.join(t.release())
+
+	sched.Lock()
+	t.Loop.tasks++
+	sched.Unlock()
+	return child
+}
+
+// release returns the clock of t for a task that waits for it, and moves
+// t on, so what t does next isn't ordered before that task
+func (t *Task) release() clock {
+	released := t.clock.copy()
+	t.clock[t.ID]++
+	return released
+}
+
+// acquire orders what t does next after everything released has seen
+func (t *Task) acquire(released clock) {
+	t.clock.join(released)
+}
+
+func (t *Task) now() epoch {
+	return epoch{task: t.ID, time: t.clock[t.ID]}
+}
+
+// happenedBefore tells whether t has waited for the moment e
+func (t *Task) happenedBefore(e epoch) bool {
+	return e.task == t.ID || e.time <= t.clock[e.task]
+}
+
+// Finish ends the task with its result
+func (t *Task) Finish(result Object) {
+	sched.Lock()
+	defer sched.Unlock()
+	t.result = result
+	t.final = t.release()
+	t.finished = true
+	close(t.done)
+
+	t.Loop.tasks--
+	t.Loop.findDeadlock()
+	schedCond.Broadcast()
+}
+
+// Wait blocks waiter until t has finished and returns the result of t, or
+// a deadlock error when every task waits
+func (t *Task) Wait(waiter *Task) Object {
+	sched.Lock()
+	defer sched.Unlock()
+	if !waiter.Loop.wait(func() bool { return t.finished }) {
+		return deadlockError()
+	}
+	waiter.acquire(t.final)
+	return t.result
+}
+
+// sched guards the channels of every program and the tasks that wait for
+// them or for other tasks. A task waits on schedCond until what it waits
+// for is ready, and everything that could make it ready broadcasts
+var (
+	sched     sync.Mutex
+	schedCond = sync.NewCond(&sched)
+)
+
+// waiter is a task that waits until ready is true
+type waiter struct {
+	ready func() bool
+	stuck bool // every task of the program waits, so ready can't become true
+}
+
+// wait blocks until ready is true. Returns false when every task of the
+// program waits and none of them is ready, since nothing can wake them
+// then. sched must be held
+func (l *Loop) wait(ready func() bool) bool {
+	if ready() {
+		return true
+	}
+	w := &waiter{ready: ready}
+	l.waiters = append(l.waiters, w)
+	l.findDeadlock()
+
+	for !w.stuck && !ready() {
+		schedCond.Wait()
+	}
+	if w.stuck {
+		return false
+	}
+	for i, other := range l.waiters {
+		if other == w {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// findDeadlock wakes every waiter as stuck when every task of the program
+// waits for something that isn't ready. An async function waits in place of
+// the task that runs it, which waits for the function until it awaits.
+// sched must be held
+func (l *Loop) findDeadlock() {
+	if len(l.waiters) == 0 || len(l.waiters) < l.tasks {
+		return
+	}
+	for _, w := range l.waiters {
+		if w.ready() {
+			return
+		}
+	}
+	for _, w := range l.waiters {
+		w.stuck = true
+	}
+	l.waiters = nil
+	schedCond.Broadcast()
+}
+
+func deadlockError() *Error {
+	return &Error{Message: "deadlock: every task is waiting for another"}
+}
+
+// message is a value sent on a channel, with the clock of the sender
+type message struct {
+	value Object
+	clock clock
+	taken bool // a receiver has the value
+}
+
+// Channel passes values between tasks. Send blocks until a receiver takes the
+// value or, when the channel has a buffer, until there is room in it. The
+// fields are guarded by sched
+type Channel struct {
+	size       int
+	messages   []*message // without a buffer, the values whose senders wait
+	closed     bool
+	closeClock clock
+}
+
+func NewChannel(size int) *Channel {
+	return &Channel{size: size}
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return "channel" }
+
+// Send sends val from task. Returns false if the channel is closed, and an
+// error when every task waits, since nothing could receive val then
+func (c *Channel) Send(task *Task, val Object) (bool, *Error) {
+	sched.Lock()
+	defer sched.Unlock()
+
+	if c.size > 0 {
+		if !task.Loop.wait(func() bool { return c.closed || len(c.messages) < c.size }) {
+			return false, deadlockError()
+		}
+		if c.closed {
+			return false, nil
+		}
+		c.messages = append(c.messages, &message{value: val, clock: task.release()})
+		schedCond.Broadcast()
+		return true, nil
+	}
+
+	if c.closed {
+		return false, nil
+	}
+	msg := &message{value: val, clock: task.release()}
+	c.messages = append(c.messages, msg)
+	schedCond.Broadcast()
+	if !task.Loop.wait(func() bool { return msg.taken || c.closed }) {
+		c.drop(msg)
+		return false, deadlockError()
+	}
+	return msg.taken, nil
+}
+
+func (c *Channel) drop(msg *message) {
+	for i, other := range c.messages {
+		if other == msg {
+			c.messages = append(c.messages[:i], c.messages[i+1:]...)
+			return
+		}
+	}
+}
+
+// Receive blocks task until there is a value. Returns false when the
+// channel is closed and every value has been received, and an error when
+// every task waits, since nothing could send a value then
+func (c *Channel) Receive(task *Task) (Object, bool, *Error) {
+	sched.Lock()
+	defer sched.Unlock()
+	if !task.Loop.wait(c.ready) {
+		return nil, false, deadlockError()
+	}
+	value, ok := c.take(task)
+	return value, ok, nil
+}
+
+// ready tells whether a receive wouldn't wait
+func (c *Channel) ready() bool {
+	return len(c.messages) > 0 || c.closed
+}
+
+// take receives from a ready channel
+func (c *Channel) take(task *Task) (Object, bool) {
+	if len(c.messages) == 0 {
+		task.acquire(c.closeClock)
+		return nil, false
+	}
+	msg := c.messages[0]
+	c.messages = c.messages[1:]
+	msg.taken = true
+	task.acquire(msg.clock)
+	schedCond.Broadcast()
+	return msg.value, true
+}
+
+// Close closes the channel from task. Returns false if it's already closed.
+// The values in the buffer can still be received, but the senders that
+// wait on a channel without a buffer stop with false
+func (c *Channel) Close(task *Task) bool {
+	sched.Lock()
+	defer sched.Unlock()
+	if c.closed {
+		return false
+	}
+	c.closed = true
+	c.closeClock = task.release()
+	if c.size == 0 {
+		c.messages = nil
+	}
+	schedCond.Broadcast()
+	return true
+}
+
+// Select blocks task until one of the channels has a value or is closed.
+// Returns the index of that channel, and the value like Receive does. When
+// more channels are ready, one of them is picked at random
+func Select(task *Task, channels []*Channel) (int, Object, bool, *Error) {
+	sched.Lock()
+	defer sched.Unlock()
+
+	var ready []int
+	found := task.Loop.wait(func() bool {
+		ready = ready[:0]
+		for i, c := range channels {
+			if c.ready() {
+				ready = append(ready, i)
+			}
+		}
+		return len(ready) > 0
+	})
+	if !found {
+		return 0, nil, false, deadlockError()
+	}
+
+	chosen := ready[rand.Intn(len(ready))]
+	value, ok := channels[chosen].take(task)
+	return chosen, value, ok, nil
+}
+
+// CheckSpawn reports what spawn can't run, before a task is started for it
+func CheckSpawn(function Object) *Error {
+	if function.Type() != FUNCTION_OBJ && function.Type() != BUILTIN_OBJ {
+		return newError("not a function %s", function.Type())
+	}
+	return nil
+}
+
+func channelArgument(builtin string, arg Object) (*Channel, *Error) {
+	channel, ok := arg.(*Channel)
+	if !ok {
+		return nil, newError("argument to `%s` must be CHANNEL, got %s", builtin, arg.Type())
+	}
+	return channel, nil
+}
+
+func newChannel(args []Object) Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+	if len(args) == 0 {
+		return NewChannel(0)
+	}
+	size, ok := args[0].(*Integer)
+	if !ok {
+		return newError("argument to `channel` must be INTEGER, got %s", args[0].Type())
+	}
+	if size.Value < 0 {
+		return newError("a channel can't have a negative size. got=%d", size.Value)
+	}
+	return NewChannel(int(size.Value))
+}
+
+func send(task *Task, args []Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	channel, err := channelArgument("send", args[0])
+	if err != nil {
+		return err
+	}
+	sent, deadlock := channel.Send(task, args[1])
+	if deadlock != nil {
+		return deadlock
+	}
+	if !sent {
+		return newError("send on closed channel")
+	}
+	return NULL
+}
+
+func receive(task *Task, args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	channel, err := channelArgument("receive", args[0])
+	if err != nil {
+		return err
+	}
+	value, ok, deadlock := channel.Receive(task)
+	if deadlock != nil {
+		return deadlock
+	}
+	if !ok {
+		return NULL
+	}
+	return value
+}
+
+func closeChannel(task *Task, args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	channel, err := channelArgument("close", args[0])
+	if err != nil {
+		return err
+	}
+	if !channel.Close(task) {
+		return newError("close of closed channel")
+	}
+	return NULL
+}
+
+// selectChannel receives from whichever channel of an array has a value
+// first, and returns [index of the channel, value]
+func selectChannel(task *Task, args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("argument to `select` must be ARRAY, got %s", args[0].Type())
+	}
+	if arr.Elements.Len() == 0 {
+		return newError("select needs at least one channel")
+	}
+
+	channels := []*Channel{}
+	for _, elem := range arr.Elements.Values() {
+		channel, err := channelArgument("select", elem)
+		if err != nil {
+			return err
+		}
+		channels = append(channels, channel)
+	}
+
+	index, value, ok, deadlock := Select(task, channels)
+	if deadlock != nil {
+		return deadlock
+	}
+	if !ok {
+		value = NULL
+	}
+	return NewArray([]Object{NewInteger(int64(index)), value})
+}
+
+// wait waits for a task and returns its result, or for an array of tasks
+// and returns their results. An error in a task is an error of wait
+func wait(task *Task, args []Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Task:
+		return arg.Wait(task)
+
+	case *Array:
+		results := []Object{}
+		for _, elem := range arg.Elements.Values() {
+			other, ok := elem.(*Task)
+			if !ok {
+				return newError("argument to `wait` must be TASK or ARRAY of TASK, got %s", elem.Type())
+			}
+			result := other.Wait(task)
+			if isError(result) {
+				return result
+			}
+			results = append(results, result)
+		}
+		return NewArray(results)
+
+	default:
+		return newError("argument to `wait` must be TASK or ARRAY of TASK, got %s", args[0].Type())
+	}
+}
+
+// DefaultMaxDepth is the MaxDepth of a program that doesn't ask for another
+const DefaultMaxDepth = 10000
+
+// MaxDepth is how deep calls can be nested in a task before the program
+// stops with an error, instead of running out of Go stack. Tail calls don't nest
+var MaxDepth = DefaultMaxDepth
+
+// MaxDepthLimit is the largest MaxDepth a program can ask for. Every call
+// needs about stackPerCall of Go stack, and SetMaxDepth raises the Go stack
+// limit to depth*stackPerCall, so the limit keeps that at a size a machine has
+const MaxDepthLimit = 100000
+
+// stackPerCall is the Go stack SetMaxDepth makes room for with every call a
+// task can nest. The evaluator takes a few kilobytes for a call, more when
+// the body nests deeper
+const stackPerCall = 16 << 10
+
+// defaultMaxStack is the most Go stack a goroutine can have before
+// SetMaxDepth raises it
+const defaultMaxStack = 1000000000
+
+// SetMaxDepth sets MaxDepth, which should be between 1 and MaxDepthLimit.
+// It raises the Go stack limit of goroutines to depth*stackPerCall, since
+// nesting depth calls takes about that much Go stack
+func SetMaxDepth(depth int) {
+	MaxDepth = depth
+	stack := depth * stackPerCall
+	if stack < defaultMaxStack {
+		stack = defaultMaxStack
+	}
+	debug.SetMaxStack(stack)
+}
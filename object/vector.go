@@ -0,0 +1,375 @@
+package object
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+
+	// vectorExtra is the number of nodes more than the optimal a level may
+	// have after a concatenation before its nodes are redistributed
+	vectorExtra = 2
+)
+
+// Vector is a persistent RRB vector. Every change returns a new vector
+// that shares most of its nodes with the old one, so the old one is
+// untouched. Push, Set and Get are O(log n), and so are Concat and Slice.
+type Vector struct {
+	root   *vectorNode // nil when the vector is empty
+	height int         // 0 when the root is a leaf
+}
+
+// vectorNode is a leaf with values or a branch with children. A branch
+// keeps the number of values below each child, since the children of a
+// relaxed node may hold fewer values than a full tree of their height.
+type vectorNode struct {
+	values   []Object
+	children []*vectorNode
+	sizes    []int // sizes[i] is the number of values in children[:i+1]
+}
+
+func (n *vectorNode) isLeaf() bool { return n.children == nil }
+
+// count returns the number of values below the node
+func (n *vectorNode) count() int {
+	if n.isLeaf() {
+		return len(n.values)
+	}
+	return n.sizes[len(n.sizes)-1]
+}
+
+// slots returns the number of values of a leaf or children of a branch
+func (n *vectorNode) slots() int {
+	if n.isLeaf() {
+		return len(n.values)
+	}
+	return len(n.children)
+}
+
+// find returns the child holding the value at index i and the index of the value in the child
+func (n *vectorNode) find(i, height int) (int, int) {
+	// The child can't be before the one a full tree would use
+	slot := i >> (vectorBits * height)
+	if slot >= len(n.sizes) {
+		slot = len(n.sizes) - 1
+	}
+	for n.sizes[slot] <= i {
+		slot++
+	}
+	if slot > 0 {
+		i -= n.sizes[slot-1]
+	}
+	return slot, i
+}
+
+func newLeaf(values []Object) *vectorNode {
+	return &vectorNode{values: values}
+}
+
+func newBranch(children []*vectorNode) *vectorNode {
+	sizes := make([]int, len(children))
+	total := 0
+	for i, child := range children {
+		total += child.count()
+		sizes[i] = total
+	}
+	return &vectorNode{children: children, sizes: sizes}
+}
+
+// NewVector creates a vector with a copy of values
+func NewVector(values []Object) *Vector {
+	if len(values) == 0 {
+		return &Vector{}
+	}
+
+	nodes := []*vectorNode{}
+	for start := 0; start < len(values); start += vectorWidth {
+		end := min(start+vectorWidth, len(values))
+		nodes = append(nodes, newLeaf(append([]Object{}, values[start:end]...)))
+	}
+
+	height := 0
+	for len(nodes) > 1 {
+		parents := []*vectorNode{}
+		for start := 0; start < len(nodes); start += vectorWidth {
+			end := min(start+vectorWidth, len(nodes))
+			parents = append(parents, newBranch(nodes[start:end:end]))
+		}
+		nodes = parents
+		height++
+	}
+
+	return &Vector{root: nodes[0], height: height}
+}
+
+func (v *Vector) Len() int {
+	if v.root == nil {
+		return 0
+	}
+	return v.root.count()
+}
+
+// Get returns the value at index i, which must be in range
+func (v *Vector) Get(i int) Object {
+	node := v.root
+	for height := v.height; height > 0; height-- {
+		var slot int
+		slot, i = node.find(i, height)
+		node = node.children[slot]
+	}
+	return node.values[i]
+}
+
+// Set returns a vector where the value at index i, which must be in range, is val
+func (v *Vector) Set(i int, val Object) *Vector {
+	return &Vector{root: setValue(v.root, v.height, i, val), height: v.height}
+}
+
+func setValue(node *vectorNode, height, i int, val Object) *vectorNode {
+	if height == 0 {
+		values := append([]Object{}, node.values...)
+		values[i] = val
+		return newLeaf(values)
+	}
+
+	slot, i := node.find(i, height)
+	children := append([]*vectorNode{}, node.children...)
+	children[slot] = setValue(children[slot], height-1, i, val)
+	return &vectorNode{children: children, sizes: node.sizes}
+}
+
+// Push returns a vector with val added to the end
+func (v *Vector) Push(val Object) *Vector {
+	if v.root == nil {
+		return &Vector{root: newLeaf([]Object{val})}
+	}
+	if root, ok := pushValue(v.root, v.height, val); ok {
+		return &Vector{root: root, height: v.height}
+	}
+	// The tree is full, so it grows a level
+	return v.Concat(&Vector{root: newLeaf([]Object{val})})
+}
+
+// pushValue adds val to the rightmost leaf, or a new path. Returns false if there is no room
+func pushValue(node *vectorNode, height int, val Object) (*vectorNode, bool) {
+	if height == 0 {
+		if len(node.values) == vectorWidth {
+			return nil, false
+		}
+		return newLeaf(append(node.values[:len(node.values):len(node.values)], val)), true
+	}
+
+	last := len(node.children) - 1
+	children := append([]*vectorNode{}, node.children...)
+
+	if child, ok := pushValue(children[last], height-1, val); ok {
+		children[last] = child
+	} else if len(children) < vectorWidth {
+		children = append(children, newPath(height-1, val))
+	} else {
+		return nil, false
+	}
+
+	sizes := append([]int{}, node.sizes...)
+	if len(sizes) < len(children) {
+		sizes = append(sizes, sizes[last])
+	}
+	sizes[len(sizes)-1]++
+	return &vectorNode{children: children, sizes: sizes}, true
+}
+
+func newPath(height int, val Object) *vectorNode {
+	if height == 0 {
+		return newLeaf([]Object{val})
+	}
+	return newBranch([]*vectorNode{newPath(height-1, val)})
+}
+
+// Concat returns a vector with the values of v followed by the values of other
+func (v *Vector) Concat(other *Vector) *Vector {
+	if v.root == nil {
+		return other
+	}
+	if other.root == nil {
+		return v
+	}
+
+	root := concatNodes(v.root, v.height, other.root, other.height)
+	return shrink(root, max(v.height, other.height)+1)
+}
+
+// concatNodes returns a branch one level above the highest of the two nodes,
+// holding the values of left followed by the values of right. Only the nodes
+// where the two trees meet are rebuilt
+func concatNodes(left *vectorNode, leftHeight int, right *vectorNode, rightHeight int) *vectorNode {
+	switch {
+	case leftHeight > rightHeight:
+		last := len(left.children) - 1
+		middle := concatNodes(left.children[last], leftHeight-1, right, rightHeight)
+		return rebalance(left.children[:last], middle, nil)
+
+	case leftHeight < rightHeight:
+		middle := concatNodes(left, leftHeight, right.children[0], rightHeight-1)
+		return rebalance(nil, middle, right.children[1:])
+
+	case leftHeight == 0:
+		if len(left.values)+len(right.values) <= vectorWidth {
+			values := append(append([]Object{}, left.values...), right.values...)
+			return newBranch([]*vectorNode{newLeaf(values)})
+		}
+		return newBranch([]*vectorNode{left, right})
+
+	default:
+		last := len(left.children) - 1
+		middle := concatNodes(left.children[last], leftHeight-1, right.children[0], rightHeight-1)
+		return rebalance(left.children[:last], middle, right.children[1:])
+	}
+}
+
+// rebalance joins the children of the three parts and returns them in a
+// branch two levels above them
+func rebalance(left []*vectorNode, middle *vectorNode, right []*vectorNode) *vectorNode {
+	all := []*vectorNode{}
+	all = append(all, left...)
+	all = append(all, middle.children...)
+	all = append(all, right...)
+
+	all = redistribute(all)
+
+	if len(all) <= vectorWidth {
+		return newBranch([]*vectorNode{newBranch(all)})
+	}
+	return newBranch([]*vectorNode{newBranch(all[:vectorWidth]), newBranch(all[vectorWidth:])})
+}
+
+// redistribute moves the slots of the nodes of a level into fewer nodes, when
+// there are more than vectorExtra nodes more than needed. This keeps the tree
+// shallow, so finding a value only has to search a few slots of each node
+func redistribute(nodes []*vectorNode) []*vectorNode {
+	sizes := make([]int, len(nodes))
+	total := 0
+	for i, node := range nodes {
+		sizes[i] = node.slots()
+		total += sizes[i]
+	}
+
+	optimal := (total + vectorWidth - 1) / vectorWidth
+	n := len(nodes)
+	if n <= optimal+vectorExtra {
+		return nodes
+	}
+
+	i := 0
+	for n > optimal+vectorExtra {
+		// Skip the nodes that are full
+		for sizes[i] > vectorWidth-vectorExtra/2 {
+			i++
+		}
+
+		// Spread the slots of node i over the following nodes
+		remaining := sizes[i]
+		for remaining > 0 && i+1 < n {
+			size := min(remaining+sizes[i+1], vectorWidth)
+			sizes[i] = size
+			remaining = remaining + sizes[i+1] - size
+			i++
+		}
+
+		copy(sizes[i:n-1], sizes[i+1:n])
+		n--
+		i--
+	}
+	sizes = sizes[:n]
+
+	// Build the nodes of the plan from the slots of the old nodes
+	isLeaf := nodes[0].isLeaf()
+	values := []Object{}
+	children := []*vectorNode{}
+	for _, node := range nodes {
+		values = append(values, node.values...)
+		children = append(children, node.children...)
+	}
+
+	result := make([]*vectorNode, n)
+	start := 0
+	for i, size := range sizes {
+		if isLeaf {
+			result[i] = newLeaf(values[start : start+size : start+size])
+		} else {
+			result[i] = newBranch(children[start : start+size : start+size])
+		}
+		start += size
+	}
+	return result
+}
+
+// shrink removes the branches at the top of a tree that only have one child
+func shrink(root *vectorNode, height int) *Vector {
+	for height > 0 && len(root.children) == 1 {
+		root = root.children[0]
+		height--
+	}
+	return &Vector{root: root, height: height}
+}
+
+// Slice returns a vector with the values from index from up to, but not including, index to
+func (v *Vector) Slice(from, to int) *Vector {
+	if from >= to {
+		return &Vector{}
+	}
+
+	root := v.root
+	if to < v.Len() {
+		root = takeValues(root, v.height, to)
+	}
+	if from > 0 {
+		root = dropValues(root, v.height, from)
+	}
+	return shrink(root, v.height)
+}
+
+// takeValues returns a node with the first n values of node
+func takeValues(node *vectorNode, height, n int) *vectorNode {
+	if height == 0 {
+		return newLeaf(node.values[:n:n])
+	}
+
+	slot, i := node.find(n-1, height)
+	children := append([]*vectorNode{}, node.children[:slot]...)
+	children = append(children, takeValues(node.children[slot], height-1, i+1))
+	return newBranch(children)
+}
+
+// dropValues returns a node without the first n values of node
+func dropValues(node *vectorNode, height, n int) *vectorNode {
+	if height == 0 {
+		return newLeaf(append([]Object{}, node.values[n:]...))
+	}
+
+	slot, i := node.find(n, height)
+	children := []*vectorNode{dropValues(node.children[slot], height-1, i)}
+	children = append(children, node.children[slot+1:]...)
+	return newBranch(children)
+}
+
+// Remove returns a vector without the value at index i, which must be in range
+func (v *Vector) Remove(i int) *Vector {
+	return v.Slice(0, i).Concat(v.Slice(i+1, v.Len()))
+}
+
+// Values returns the values of the vector in a new slice
+func (v *Vector) Values() []Object {
+	values := make([]Object, 0, v.Len())
+	if v.root != nil {
+		values = appendValues(values, v.root)
+	}
+	return values
+}
+
+func appendValues(values []Object, node *vectorNode) []Object {
+	if node.isLeaf() {
+		return append(values, node.values...)
+	}
+	for _, child := range node.children {
+		values = appendValues(values, child)
+	}
+	return values
+}
@@ -0,0 +1,132 @@
+package object
+
+import "testing"
+
+func integers(from, to int) []Object {
+	values := []Object{}
+	for i := from; i < to; i++ {
+		values = append(values, &Integer{Value: int64(i)})
+	}
+	return values
+}
+
+func testVectorValues(t *testing.T, v *Vector, expected []Object) {
+	t.Helper()
+
+	if v.Len() != len(expected) {
+		t.Fatalf("vector has wrong length. expected=%d, got=%d", len(expected), v.Len())
+	}
+	for i, value := range expected {
+		if got := v.Get(i); got != value {
+			t.Fatalf("wrong value at %d. expected=%s, got=%s", i, value.Inspect(), got.Inspect())
+		}
+	}
+	for i, got := range v.Values() {
+		if got != expected[i] {
+			t.Fatalf("Values() has wrong value at %d. expected=%s, got=%s", i, expected[i].Inspect(), got.Inspect())
+		}
+	}
+}
+
+func TestVectorPush(t *testing.T) {
+	values := integers(0, 2000)
+
+	v := NewVector(nil)
+	versions := []*Vector{}
+	for _, value := range values {
+		versions = append(versions, v)
+		v = v.Push(value)
+	}
+
+	testVectorValues(t, v, values)
+	for i, old := range versions {
+		testVectorValues(t, old, values[:i])
+	}
+}
+
+func TestNewVector(t *testing.T) {
+	for _, n := range []int{0, 1, 32, 33, 1024, 1025, 5000} {
+		values := integers(0, n)
+		testVectorValues(t, NewVector(values), values)
+	}
+}
+
+func TestVectorSet(t *testing.T) {
+	values := integers(0, 1100)
+	v := NewVector(values)
+
+	replaced := &Integer{Value: -1}
+	changed := v.Set(1050, replaced)
+
+	expected := append([]Object{}, values...)
+	expected[1050] = replaced
+	testVectorValues(t, changed, expected)
+	testVectorValues(t, v, values)
+}
+
+func TestVectorConcat(t *testing.T) {
+	values := integers(0, 3000)
+
+	// Many small vectors of uneven sizes make a relaxed tree
+	v := NewVector(nil)
+	for start, size := 0, 1; start < len(values); size = size%45 + 1 {
+		end := min(start+size, len(values))
+		v = v.Concat(NewVector(values[start:end]))
+		start = end
+	}
+	testVectorValues(t, v, values)
+
+	left := NewVector(values[:1234])
+	right := NewVector(values[1234:])
+	testVectorValues(t, left.Concat(right), values)
+	testVectorValues(t, left, values[:1234])
+	testVectorValues(t, right, values[1234:])
+
+	last := &Integer{Value: 3000}
+	pushed := left.Concat(right).Push(last)
+	testVectorValues(t, pushed, append(values[:3000:3000], last))
+}
+
+func TestVectorSlice(t *testing.T) {
+	values := integers(0, 2500)
+	v := NewVector(values)
+
+	tests := []struct{ from, to int }{
+		{0, 2500},
+		{0, 0},
+		{1, 2500},
+		{0, 2499},
+		{31, 33},
+		{1000, 1025},
+		{7, 2100},
+		{2499, 2500},
+	}
+
+	for _, tt := range tests {
+		testVectorValues(t, v.Slice(tt.from, tt.to), values[tt.from:tt.to])
+	}
+	testVectorValues(t, v, values)
+
+	sliced := v.Slice(100, 2000).Push(&Integer{Value: -1})
+	if sliced.Len() != 1901 || sliced.Get(0) != values[100] {
+		t.Errorf("push after slice went wrong. len=%d", sliced.Len())
+	}
+}
+
+func TestVectorRemove(t *testing.T) {
+	values := integers(0, 1500)
+	v := NewVector(values)
+
+	for _, i := range []int{0, 31, 32, 1024, 1499} {
+		expected := append(append([]Object{}, values[:i]...), values[i+1:]...)
+		testVectorValues(t, v.Remove(i), expected)
+	}
+	testVectorValues(t, v, values)
+
+	// Removing over and over keeps the tree balanced enough to work with
+	for v.Len() > 0 {
+		v = v.Remove(v.Len() / 2)
+		values = append(values[:len(values)/2:len(values)/2], values[len(values)/2+1:]...)
+	}
+	testVectorValues(t, v, values)
+}
@@ -0,0 +1,268 @@
+package optimizer
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/token"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+func isLiteral(node ast.Expression) bool {
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.RealLiteral, *ast.StringLiteral, *ast.Boolean, *ast.Null:
+		return true
+	default:
+		return false
+	}
+}
+
+// staticTruth returns whether a literal is truthy. known is false for anything else
+func staticTruth(node ast.Expression) (truthy bool, known bool) {
+	switch node := node.(type) {
+	case *ast.Boolean:
+		return node.Value, true
+	case *ast.Null:
+		return false, true
+	case *ast.IntegerLiteral, *ast.RealLiteral, *ast.StringLiteral:
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+func foldPrefix(node *ast.PrefixExpression) (ast.Expression, bool) {
+	switch node.Operator {
+	case "!":
+		truthy, known := staticTruth(node.Right)
+		if !known {
+			return nil, false
+		}
+		// Only false and null are negated to true, like in the evaluator
+		_, isBoolean := node.Right.(*ast.Boolean)
+		_, isNull := node.Right.(*ast.Null)
+		return newBoolean(!truthy && (isBoolean || isNull)), true
+
+	case "-":
+		switch right := node.Right.(type) {
+		case *ast.IntegerLiteral:
+			if right.Value == math.MinInt64 {
+				return nil, false
+			}
+			return newIntegerLiteral(-right.Value), true
+		case *ast.RealLiteral:
+			return newRealLiteral(-right.Value)
+		}
+
+	case "~":
+		if right, ok := node.Right.(*ast.IntegerLiteral); ok {
+			return newIntegerLiteral(^right.Value), true
+		}
+	}
+
+	return nil, false
+}
+
+func foldInfix(node *ast.InfixExpression) (ast.Expression, bool) {
+	if node.Operator == "??" && isLiteral(node.Left) {
+		if _, isNull := node.Left.(*ast.Null); isNull {
+			return node.Right, true
+		}
+		return node.Left, true
+	}
+
+	switch left := node.Left.(type) {
+	case *ast.IntegerLiteral:
+		switch right := node.Right.(type) {
+		case *ast.IntegerLiteral:
+			return foldIntegers(node.Operator, left.Value, right.Value)
+		case *ast.RealLiteral:
+			return foldReals(node.Operator, float64(left.Value), right.Value)
+		}
+
+	case *ast.RealLiteral:
+		switch right := node.Right.(type) {
+		case *ast.IntegerLiteral:
+			return foldReals(node.Operator, left.Value, float64(right.Value))
+		case *ast.RealLiteral:
+			return foldReals(node.Operator, left.Value, right.Value)
+		}
+
+	case *ast.StringLiteral:
+		if right, ok := node.Right.(*ast.StringLiteral); ok {
+			return foldStrings(node.Operator, left.Value, right.Value)
+		}
+
+	case *ast.Boolean:
+		if right, ok := node.Right.(*ast.Boolean); ok {
+			switch node.Operator {
+			case "==":
+				return newBoolean(left.Value == right.Value), true
+			case "!=":
+				return newBoolean(left.Value != right.Value), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func foldIntegers(operator string, left, right int64) (ast.Expression, bool) {
+	switch operator {
+	// Results that overflow aren't folded, since each interpreter decides what overflow does
+	case "+":
+		if sum := left + right; (sum > left) == (right > 0) {
+			return newIntegerLiteral(sum), true
+		}
+		return nil, false
+	case "-":
+		if difference := left - right; (difference < left) == (right > 0) {
+			return newIntegerLiteral(difference), true
+		}
+		return nil, false
+	case "*":
+		if left == 0 || right == 0 {
+			return newIntegerLiteral(0), true
+		}
+		product := left * right
+		if product/right != left || left == -1 && right == math.MinInt64 || right == -1 && left == math.MinInt64 {
+			return nil, false
+		}
+		return newIntegerLiteral(product), true
+	case "/":
+		if right == 0 || right == -1 && left == math.MinInt64 {
+			return nil, false
+		}
+		return newIntegerLiteral(left / right), true
+	case "%":
+		if right == 0 {
+			return nil, false
+		}
+		return newIntegerLiteral(left % right), true
+	case "//":
+		if right == 0 || right == -1 && left == math.MinInt64 {
+			return nil, false
+		}
+		quotient := left / right
+		if left%right != 0 && (left < 0) != (right < 0) {
+			quotient--
+		}
+		return newIntegerLiteral(quotient), true
+	case "**":
+		// A negative exponent gives a real, and a large one would take long to fold
+		if right < 0 || right > 64 {
+			return nil, false
+		}
+		power := big.NewInt(left)
+		power.Exp(power, big.NewInt(right), nil)
+		if !power.IsInt64() {
+			return nil, false
+		}
+		return newIntegerLiteral(power.Int64()), true
+	case "&":
+		return newIntegerLiteral(left & right), true
+	case "|":
+		return newIntegerLiteral(left | right), true
+	case "^":
+		return newIntegerLiteral(left ^ right), true
+	case "<<":
+		if right < 0 || right >= 63 || left<<right>>right != left {
+			return nil, false
+		}
+		return newIntegerLiteral(left << right), true
+	case ">>":
+		if right < 0 {
+			return nil, false
+		}
+		return newIntegerLiteral(left >> min(right, 63)), true
+	case "<":
+		return newBoolean(left < right), true
+	case ">":
+		return newBoolean(left > right), true
+	case "==":
+		return newBoolean(left == right), true
+	case "!=":
+		return newBoolean(left != right), true
+	default:
+		return nil, false
+	}
+}
+
+func foldReals(operator string, left, right float64) (ast.Expression, bool) {
+	switch operator {
+	case "+":
+		return newRealLiteral(left + right)
+	case "-":
+		return newRealLiteral(left - right)
+	case "*":
+		return newRealLiteral(left * right)
+	case "/":
+		if right == 0 {
+			return nil, false
+		}
+		return newRealLiteral(left / right)
+	case "%":
+		if right == 0 {
+			return nil, false
+		}
+		return newRealLiteral(math.Mod(left, right))
+	case "//":
+		if right == 0 {
+			return nil, false
+		}
+		return newRealLiteral(math.Floor(left / right))
+	case "**":
+		return newRealLiteral(math.Pow(left, right))
+	case "<":
+		return newBoolean(left < right), true
+	case ">":
+		return newBoolean(left > right), true
+	case "==":
+		return newBoolean(left == right), true
+	case "!=":
+		return newBoolean(left != right), true
+	default:
+		return nil, false
+	}
+}
+
+func foldStrings(operator string, left, right string) (ast.Expression, bool) {
+	switch operator {
+	case "+":
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: left + right}, Value: left + right}, true
+	case "==":
+		return newBoolean(left == right), true
+	case "!=":
+		return newBoolean(left != right), true
+	case "<":
+		return newBoolean(left < right), true
+	case ">":
+		return newBoolean(left > right), true
+	default:
+		return nil, false
+	}
+}
+
+func newIntegerLiteral(value int64) *ast.IntegerLiteral {
+	literal := strconv.FormatInt(value, 10)
+	return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal}, Value: value}
+}
+
+// newRealLiteral doesn't fold results that can't be written as a literal
+func newRealLiteral(value float64) (ast.Expression, bool) {
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return nil, false
+	}
+	literal := strconv.FormatFloat(value, 'f', -1, 64)
+	if math.Trunc(value) == value {
+		literal += ".0"
+	}
+	return &ast.RealLiteral{Token: token.Token{Type: token.REAL, Literal: literal}, Value: value}, true
+}
+
+func newBoolean(value bool) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}
+	}
+	return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false}
+}
@@ -0,0 +1,685 @@
+package optimizer
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/token"
+)
+
+// variable is a slot in the env of a frame. The frame is the node
+// that creates the env: the program, a function, a forloop or a class
+type variable struct {
+	frame ast.Node
+	slot  int
+}
+
+type optimizer struct {
+	frames []ast.Node
+
+	declarations map[variable]int
+	assigned     map[variable]bool
+
+	// constants holds the variables that can be inlined where they are visible
+	constants map[variable]ast.Expression
+	blocks    [][]variable // the constants declared in each enclosing block
+
+	// keepGlobals is set when programs run after this one can change the
+	// variables it declares at the top level, so they aren't inlined
+	keepGlobals bool
+}
+
+// Optimize rewrites a program that has been resolved with resolver.Resolve.
+// It folds constant expressions, removes if and elif branches that can never
+// run and inlines variables that are bound once to a literal and never changed.
+// Expressions that fail when they run, like a division by zero, are left alone
+// so they fail the same way.
+func Optimize(program *ast.Program) *ast.Program {
+	return optimize(program, false)
+}
+
+// OptimizeLine is Optimize for a line of the REPL. The lines after it run in
+// the same env and can change the variables it declares at the top level,
+// like a function it defines would see, so those aren't inlined
+func OptimizeLine(program *ast.Program) *ast.Program {
+	return optimize(program, true)
+}
+
+func optimize(program *ast.Program, keepGlobals bool) *ast.Program {
+	o := &optimizer{
+		declarations: make(map[variable]int),
+		assigned:     make(map[variable]bool),
+		constants:    make(map[variable]ast.Expression),
+		keepGlobals:  keepGlobals,
+	}
+
+	o.enterFrame(program)
+	o.analyze(program)
+	o.leaveFrame()
+
+	o.enterFrame(program)
+	program.Statements = o.optimizeBlockStatements(program.Statements)
+	o.leaveFrame()
+
+	return program
+}
+
+func (o *optimizer) enterFrame(frame ast.Node) {
+	o.frames = append(o.frames, frame)
+}
+
+func (o *optimizer) leaveFrame() {
+	o.frames = o.frames[:len(o.frames)-1]
+}
+
+// variableOf returns the variable ident points at
+func (o *optimizer) variableOf(ident *ast.Identifier) (variable, bool) {
+	if !ident.Resolved || ident.Depth >= len(o.frames) {
+		return variable{}, false
+	}
+	return variable{frame: o.frames[len(o.frames)-1-ident.Depth], slot: ident.Slot}, true
+}
+
+func (o *optimizer) declare(ident *ast.Identifier) {
+	if v, ok := o.variableOf(ident); ok {
+		o.declarations[v]++
+	}
+}
+
+// declarePattern declares the variables a match pattern binds
+func (o *optimizer) declarePattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		o.declare(pattern)
+	case *ast.ArrayPattern:
+		for _, elem := range pattern.Elements {
+			o.declarePattern(elem)
+		}
+	case *ast.HashPattern:
+		for _, value := range pattern.Values {
+			o.declarePattern(value)
+		}
+	case *ast.TypePattern:
+		o.declare(pattern.Name)
+	case *ast.RestPattern:
+		o.declare(pattern.Name)
+	}
+}
+
+func (o *optimizer) assign(ident *ast.Identifier) {
+	if v, ok := o.variableOf(ident); ok {
+		o.assigned[v] = true
+	} else {
+		// An unresolved assignment could change any variable with that name
+		o.assigned[variable{}] = true
+	}
+}
+
+// analyze counts the declarations and assignments of every variable
+func (o *optimizer) analyze(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, stmt := range node.Statements {
+			o.analyze(stmt)
+		}
+
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			o.analyze(stmt)
+		}
+
+	case *ast.ExpressionStatement:
+		o.analyzeExpression(node.Expression)
+
+	case *ast.ReturnStatement:
+		o.analyzeExpression(node.ReturnValue)
+
+	case *ast.VarStatement:
+		o.analyzeExpression(node.Value)
+		if node.Pattern != nil {
+			o.declarePattern(node.Pattern)
+		} else {
+			o.declare(node.Name)
+		}
+
+	case *ast.DirectFunctionStatement:
+		o.declare(node.Name)
+		o.analyzeExpression(&node.Function)
+
+	case *ast.EnumStatement:
+		o.declare(node.Name)
+
+	case *ast.ClassStatement:
+		o.declare(node.Name)
+
+		o.enterFrame(node)
+		for _, field := range node.Fields {
+			o.analyzeExpression(field.Value)
+			o.declare(field.Name)
+		}
+		for _, function := range node.Functions {
+			o.declare(function.Name)
+			o.analyzeExpression(&function.Function)
+		}
+		if node.InitBody != nil {
+			o.enterFrame(node.InitBody)
+			for _, param := range node.InitParams {
+				if param.Default != nil {
+					o.analyzeExpression(param.Default)
+				}
+				if !param.IsThisParam {
+					o.declare(param.Parameter)
+				}
+			}
+			o.analyze(node.InitBody)
+			o.leaveFrame()
+		}
+		o.leaveFrame()
+	}
+}
+
+func (o *optimizer) analyzeExpression(node ast.Expression) {
+	switch node := node.(type) {
+	case *ast.PrefixExpression:
+		o.analyzeExpression(node.Right)
+
+	case *ast.InfixExpression:
+		if ident, ok := node.Left.(*ast.Identifier); ok && node.Operator == "=" {
+			o.assign(ident)
+		} else {
+			o.analyzeExpression(node.Left)
+		}
+		o.analyzeExpression(node.Right)
+
+	case *ast.MatchExpression:
+		o.analyzeExpression(node.Subject)
+		for _, arm := range node.Arms {
+			for _, pattern := range arm.Patterns {
+				o.declarePattern(pattern)
+			}
+			if arm.Guard != nil {
+				o.analyzeExpression(arm.Guard)
+			}
+			o.analyze(arm.Body)
+		}
+
+	case *ast.ConditionalExpression:
+		o.analyzeExpression(node.Condition)
+		o.analyzeExpression(node.Consequence)
+		o.analyzeExpression(node.Alternative)
+
+	case *ast.IfExpression:
+		o.analyzeExpression(node.Condition)
+		o.analyze(node.Consequence)
+		if node.Alternative != nil {
+			o.analyze(node.Alternative)
+		}
+
+	case *ast.ElseIfExpression:
+		for _, conditionAndBlockstatement := range node.ConditionAndBlockstatementList {
+			o.analyzeExpression(conditionAndBlockstatement.Condition)
+			o.analyze(conditionAndBlockstatement.Consequence)
+		}
+		if node.Alternative != nil {
+			o.analyze(node.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		o.enterFrame(node)
+		for i, param := range node.Parameters {
+			if i < len(node.Defaults) && node.Defaults[i] != nil {
+				o.analyzeExpression(node.Defaults[i])
+			}
+			o.declare(param)
+		}
+		o.analyze(node.Body)
+		o.leaveFrame()
+
+	case *ast.CallExpression:
+		o.analyzeExpression(node.Function)
+		o.analyzeExpressions(node.Arguments)
+
+	case *ast.SpawnExpression:
+		o.analyzeExpression(node.Call)
+
+	case *ast.AwaitExpression:
+		o.analyzeExpression(node.Value)
+
+	case *ast.NamedArgument:
+		o.analyzeExpression(node.Value)
+
+	case *ast.SpreadExpression:
+		o.analyzeExpression(node.Value)
+
+	case *ast.ArrayLiteral:
+		o.analyzeExpressions(node.Elements)
+
+	case *ast.SetLiteral:
+		o.analyzeExpressions(node.Elements)
+
+	case *ast.IndexExpression:
+		o.analyzeExpression(node.Left)
+		o.analyzeExpression(node.Index)
+
+	case *ast.HashLiteral:
+		for _, key := range node.Keys {
+			o.analyzeExpression(key)
+			o.analyzeExpression(node.Pairs[key])
+		}
+
+	case *ast.IncrementForloopExpression:
+		o.analyzeExpression(node.From)
+		o.analyzeExpression(node.To)
+		o.analyzeForloop(node, node.LocalVar, node.Body)
+
+	case *ast.ComprehensionExpression:
+		o.analyzeExpression(node.Iterable)
+		o.enterFrame(node)
+		for _, variable := range node.Variables {
+			o.declarePattern(variable)
+		}
+		if node.Condition != nil {
+			o.analyzeExpression(node.Condition)
+		}
+		if node.Key != nil {
+			o.analyzeExpression(node.Key)
+		}
+		o.analyzeExpression(node.Value)
+		o.leaveFrame()
+
+	case *ast.ArrayForloopExpression:
+		o.analyzeExpression(node.ArrayName)
+		o.analyzeForloop(node, node.LocalVar, node.Body)
+
+	case *ast.ObjectInitialization:
+		o.analyzeExpressions(node.Arguments)
+
+	case *ast.CallObjectFunction:
+		o.analyzeExpressions(node.Arguments)
+
+	case *ast.Increment:
+		o.assign(&node.Name)
+
+	case *ast.Decrement:
+		o.assign(&node.Name)
+	}
+}
+
+func (o *optimizer) analyzeExpressions(exps []ast.Expression) {
+	for _, e := range exps {
+		o.analyzeExpression(e)
+	}
+}
+
+func (o *optimizer) analyzeForloop(frame ast.Node, localVar ast.Expression, body *ast.BlockStatement) {
+	o.enterFrame(frame)
+	if ident, ok := localVar.(*ast.Identifier); ok {
+		o.declare(ident)
+	}
+	o.analyze(body)
+	o.leaveFrame()
+}
+
+// isInlinable reports whether the variable declared by ident always holds the same literal
+func (o *optimizer) isInlinable(ident *ast.Identifier, value ast.Expression) (variable, bool) {
+	v, ok := o.variableOf(ident)
+	if !ok || o.assigned[variable{}] {
+		return v, false
+	}
+	if _, ok := v.frame.(*ast.ClassStatement); ok {
+		// Fields are changed by name when Init has 'this.' parameters
+		return v, false
+	}
+	if _, ok := v.frame.(*ast.Program); ok && o.keepGlobals {
+		return v, false
+	}
+	return v, o.declarations[v] == 1 && !o.assigned[v] && isLiteral(value)
+}
+
+// optimizeBlockStatements optimizes the statements of a block. The constants
+// declared in the block are inlined until the end of the block
+func (o *optimizer) optimizeBlockStatements(stmts []ast.Statement) []ast.Statement {
+	o.blocks = append(o.blocks, []variable{})
+
+	result := o.optimizeStatements(stmts)
+
+	for _, v := range o.blocks[len(o.blocks)-1] {
+		delete(o.constants, v)
+	}
+	o.blocks = o.blocks[:len(o.blocks)-1]
+
+	return result
+}
+
+func (o *optimizer) optimizeBlock(block *ast.BlockStatement) *ast.BlockStatement {
+	block.Statements = o.optimizeBlockStatements(block.Statements)
+	return block
+}
+
+func (o *optimizer) optimizeStatements(stmts []ast.Statement) []ast.Statement {
+	result := []ast.Statement{}
+
+	for _, stmt := range stmts {
+		exprStmt, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			result = append(result, o.optimizeStatement(stmt))
+			continue
+		}
+
+		expr, taken, known := o.optimizeConditional(exprStmt.Expression)
+		if !known {
+			exprStmt.Expression = expr
+			result = append(result, exprStmt)
+			continue
+		}
+
+		// The branch that always runs takes the place of the if. It shares the
+		// env of the block, so its statements become statements of the block,
+		// unless it declares names the block could declare too
+		switch {
+		case taken == nil:
+			result = append(result, &ast.ExpressionStatement{Token: exprStmt.Token, Expression: &ast.Null{}})
+		case len(taken.Statements) == 0:
+			result = append(result, &ast.ExpressionStatement{Token: exprStmt.Token})
+		case declares(taken):
+			exprStmt.Expression = &ast.IfExpression{Token: conditionalToken(exprStmt.Expression),
+				Condition: newBoolean(true), Consequence: o.optimizeBlock(taken)}
+			result = append(result, exprStmt)
+		default:
+			result = append(result, o.optimizeStatements(taken.Statements)...)
+		}
+	}
+
+	return result
+}
+
+// declares reports whether the block declares a name
+func declares(block *ast.BlockStatement) bool {
+	for _, stmt := range block.Statements {
+		switch stmt.(type) {
+		case *ast.VarStatement, *ast.DirectFunctionStatement, *ast.ClassStatement, *ast.EnumStatement:
+			return true
+		}
+	}
+	return false
+}
+
+func (o *optimizer) optimizeStatement(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = o.optimizeExpression(stmt.ReturnValue)
+
+	case *ast.VarStatement:
+		stmt.Value = o.optimizeExpression(stmt.Value)
+		if stmt.Pattern != nil {
+			break
+		}
+		if v, ok := o.isInlinable(stmt.Name, stmt.Value); ok {
+			o.constants[v] = stmt.Value
+			o.blocks[len(o.blocks)-1] = append(o.blocks[len(o.blocks)-1], v)
+		}
+
+	case *ast.DirectFunctionStatement:
+		o.optimizeHoistedFunction(&stmt.Function)
+
+	case *ast.ClassStatement:
+		o.optimizeClass(stmt)
+	}
+
+	return stmt
+}
+
+// optimizeHoistedFunction optimizes a function that can be called before the
+// statements above it have run, so constants from outside aren't inlined
+func (o *optimizer) optimizeHoistedFunction(function *ast.FunctionLiteral) {
+	constants := o.constants
+	o.constants = make(map[variable]ast.Expression)
+
+	o.optimizeExpression(function)
+
+	o.constants = constants
+}
+
+func (o *optimizer) optimizeClass(class *ast.ClassStatement) {
+	o.enterFrame(class)
+
+	for _, field := range class.Fields {
+		field.Value = o.optimizeExpression(field.Value)
+	}
+	for _, function := range class.Functions {
+		o.optimizeHoistedFunction(&function.Function)
+	}
+	if class.InitBody != nil {
+		o.enterFrame(class.InitBody)
+		for _, param := range class.InitParams {
+			if param.Default != nil {
+				param.Default = o.optimizeExpression(param.Default)
+			}
+		}
+		o.optimizeBlock(class.InitBody)
+		o.leaveFrame()
+	}
+
+	o.leaveFrame()
+}
+
+// optimizeConditional optimizes an expression. When it's an if whose branch is
+// known, the branch isn't optimized but returned, or nil when no branch runs
+func (o *optimizer) optimizeConditional(node ast.Expression) (ast.Expression, *ast.BlockStatement, bool) {
+	switch node := node.(type) {
+	case *ast.IfExpression:
+		node.Condition = o.optimizeExpression(node.Condition)
+
+		if truthy, known := staticTruth(node.Condition); known {
+			if truthy {
+				return nil, node.Consequence, true
+			}
+			return nil, node.Alternative, true
+		}
+
+		o.optimizeBlock(node.Consequence)
+		if node.Alternative != nil {
+			o.optimizeBlock(node.Alternative)
+		}
+		return node, nil, false
+
+	case *ast.ElseIfExpression:
+		return o.optimizeElseIf(node)
+
+	default:
+		return o.optimizeExpression(node), nil, false
+	}
+}
+
+func (o *optimizer) optimizeElseIf(node *ast.ElseIfExpression) (ast.Expression, *ast.BlockStatement, bool) {
+	branches := []*ast.ConditionAndBlockstatementExpression{}
+	alternative := node.Alternative
+
+	for _, branch := range node.ConditionAndBlockstatementList {
+		branch.Condition = o.optimizeExpression(branch.Condition)
+
+		truthy, known := staticTruth(branch.Condition)
+		if known && !truthy {
+			continue
+		}
+		if known && truthy {
+			if len(branches) == 0 {
+				return nil, branch.Consequence, true
+			}
+			// Every branch after this one is dead, and this one is the else
+			alternative = branch.Consequence
+			break
+		}
+		branches = append(branches, branch)
+	}
+
+	if len(branches) == 0 {
+		return nil, alternative, true
+	}
+
+	for _, branch := range branches {
+		o.optimizeBlock(branch.Consequence)
+	}
+	if alternative != nil {
+		o.optimizeBlock(alternative)
+	}
+
+	if len(branches) == 1 {
+		return &ast.IfExpression{Token: node.Token, Condition: branches[0].Condition,
+			Consequence: branches[0].Consequence, Alternative: alternative}, nil, false
+	}
+
+	node.ConditionAndBlockstatementList = branches
+	node.Alternative = alternative
+	return node, nil, false
+}
+
+func (o *optimizer) optimizeExpression(node ast.Expression) ast.Expression {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		if v, ok := o.variableOf(node); ok {
+			if constant, ok := o.constants[v]; ok {
+				return constant
+			}
+		}
+
+	case *ast.PrefixExpression:
+		node.Right = o.optimizeExpression(node.Right)
+		if folded, ok := foldPrefix(node); ok {
+			return folded
+		}
+
+	case *ast.InfixExpression:
+		if _, ok := node.Left.(*ast.Identifier); !ok || node.Operator != "=" {
+			node.Left = o.optimizeExpression(node.Left)
+		}
+		node.Right = o.optimizeExpression(node.Right)
+		if folded, ok := foldInfix(node); ok {
+			return folded
+		}
+
+	case *ast.MatchExpression:
+		node.Subject = o.optimizeExpression(node.Subject)
+		for _, arm := range node.Arms {
+			if arm.Guard != nil {
+				arm.Guard = o.optimizeExpression(arm.Guard)
+			}
+			o.optimizeBlock(arm.Body)
+		}
+
+	case *ast.ConditionalExpression:
+		node.Condition = o.optimizeExpression(node.Condition)
+		if truthy, known := staticTruth(node.Condition); known {
+			if truthy {
+				return o.optimizeExpression(node.Consequence)
+			}
+			return o.optimizeExpression(node.Alternative)
+		}
+		node.Consequence = o.optimizeExpression(node.Consequence)
+		node.Alternative = o.optimizeExpression(node.Alternative)
+
+	case *ast.IfExpression, *ast.ElseIfExpression:
+		expr, taken, known := o.optimizeConditional(node)
+		if !known {
+			return expr
+		}
+		if taken == nil {
+			return &ast.Null{}
+		}
+
+		o.optimizeBlock(taken)
+		if len(taken.Statements) == 1 {
+			if stmt, ok := taken.Statements[0].(*ast.ExpressionStatement); ok && stmt.Expression != nil {
+				return stmt.Expression
+			}
+		}
+		return &ast.IfExpression{Token: conditionalToken(node), Condition: newBoolean(true), Consequence: taken}
+
+	case *ast.FunctionLiteral:
+		o.enterFrame(node)
+		o.optimizeExpressions(node.Defaults)
+		o.optimizeBlock(node.Body)
+		o.leaveFrame()
+
+	case *ast.CallExpression:
+		node.Function = o.optimizeExpression(node.Function)
+		o.optimizeExpressions(node.Arguments)
+
+	case *ast.SpawnExpression:
+		o.optimizeExpression(node.Call)
+
+	case *ast.AwaitExpression:
+		node.Value = o.optimizeExpression(node.Value)
+
+	case *ast.NamedArgument:
+		node.Value = o.optimizeExpression(node.Value)
+
+	case *ast.SpreadExpression:
+		node.Value = o.optimizeExpression(node.Value)
+
+	case *ast.ArrayLiteral:
+		o.optimizeExpressions(node.Elements)
+
+	case *ast.SetLiteral:
+		o.optimizeExpressions(node.Elements)
+
+	case *ast.IndexExpression:
+		node.Left = o.optimizeExpression(node.Left)
+		node.Index = o.optimizeExpression(node.Index)
+
+	case *ast.HashLiteral:
+		pairs := make(map[ast.Expression]ast.Expression)
+		keys := []ast.Expression{}
+		for _, key := range node.Keys {
+			optimized := o.optimizeExpression(key)
+			pairs[optimized] = o.optimizeExpression(node.Pairs[key])
+			keys = append(keys, optimized)
+		}
+		node.Pairs = pairs
+		node.Keys = keys
+
+	case *ast.IncrementForloopExpression:
+		node.From = o.optimizeExpression(node.From)
+		node.To = o.optimizeExpression(node.To)
+		o.enterFrame(node)
+		o.optimizeBlock(node.Body)
+		o.leaveFrame()
+
+	case *ast.ArrayForloopExpression:
+		node.ArrayName = o.optimizeExpression(node.ArrayName)
+		o.enterFrame(node)
+		o.optimizeBlock(node.Body)
+		o.leaveFrame()
+
+	case *ast.ComprehensionExpression:
+		node.Iterable = o.optimizeExpression(node.Iterable)
+		o.enterFrame(node)
+		if node.Condition != nil {
+			node.Condition = o.optimizeExpression(node.Condition)
+		}
+		if node.Key != nil {
+			node.Key = o.optimizeExpression(node.Key)
+		}
+		node.Value = o.optimizeExpression(node.Value)
+		o.leaveFrame()
+
+	case *ast.ObjectInitialization:
+		o.optimizeExpressions(node.Arguments)
+
+	case *ast.CallObjectFunction:
+		o.optimizeExpressions(node.Arguments)
+	}
+
+	return node
+}
+
+func conditionalToken(node ast.Expression) token.Token {
+	if ifExpression, ok := node.(*ast.IfExpression); ok {
+		return ifExpression.Token
+	}
+	return node.(*ast.ElseIfExpression).Token
+}
+
+func (o *optimizer) optimizeExpressions(exps []ast.Expression) {
+	for i, e := range exps {
+		exps[i] = o.optimizeExpression(e)
+	}
+}
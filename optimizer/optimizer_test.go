@@ -0,0 +1,158 @@
+package optimizer
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/evaluator"
+	"Pron-Lang/lexer"
+	"Pron-Lang/object"
+	"Pron-Lang/parser"
+	"Pron-Lang/resolver"
+	"strings"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"60 * 60 * 24", "86400"},
+		{"-(2 + 3)", "-5"},
+		{"1.5 * 2", "3.0"},
+		{`"ab" + "cd"`, "abcd"},
+		{"!false", "true"},
+		{"!5", "false"},
+		{"1 < 2 == true", "true"},
+		{"1 / 0", "(1 / 0)"},
+		{"5 % 0", "(5 % 0)"},
+		{"1.0 / 0", "(1.0 / 0)"},
+		{"9223372036854775807 + 1", "(9223372036854775807 + 1)"},
+		{"3037000500 * 3037000500", "(3037000500 * 3037000500)"},
+		{"-(-9223372036854775807 - 1)", "(--9223372036854775808)"},
+		{"1 + true", "(1 + true)"},
+		{"2 ** 3 ** 2", "512"},
+		{"-7 // 2", "-4"},
+		{"6 & 3 | 8 ^ 1", "11"},
+		{"~5 << 2 >> 1", "-12"},
+		{"2.0 ** 0.5 // 1", "1.0"},
+		{"2 ** -1", "(2 ** -1)"},
+		{"2 ** 63", "(2 ** 63)"},
+		{"1 << 63", "(1 << 63)"},
+		{"var a = 2; a * 3", "var a = 2;\n6"},
+		{"var a = 2; a = 3; a * 3", "var a = 2;\n(a = 3)\n(a * 3)"},
+		{"var a = 2; a++; a", "var a = 2;\na++\na"},
+		{"var a = 2; func f() { return a }", "var a = 2;\nfunc f(){return a;}"},
+		{"var a = 2; var f = func() { return a }", "var a = 2;\nvar f = func() {return 2;};"},
+		{"if (false) { print(1) }", "Null"},
+		{"if (true) { print(1) } else { print(2) }", "print(1)"},
+		{"if (false) { print(1) } else { var b = 1; print(b) }", "iftrue var b = 1;print(1)"},
+		{"var x = 1; if (x > 0) { 1 } elif (false) { 2 } else { 3 }", "var x = 1;\n1"},
+		{"var y = print(1); if (y) { 1 } elif (true) { 2 } elif (y) { 3 }", "var y = print(1);\nify 1else 2"},
+		{"if (true) { }", ""},
+		{"if (true) { var c = 1; c }", "iftrue var c = 1;1"},
+		{"var f = 2; if (true) { var f = 3; print(f) }", "var f = 2;\niftrue var f = 3;print(3)"},
+		{"if (true) { func g() { 1 } g() }", "iftrue func g(){1}g()"},
+		{"var n = 5; for (i from 0 to n) { i * 2 }", "var n = 5;\nfor ( i from 0 to 5 ) {(i * 2)}"},
+		{"var n = 5; var f = func(a = n * 2, b = a) { a + b }", "var n = 5;\nvar f = func(a = 10, b = a) {(a + b)};"},
+		{"var n = 5; print(...[n], x: n + 1)", "var n = 5;\nprint(...[5], x: 6)"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		Optimize(program)
+
+		if actual := dump(program); actual != tt.expected {
+			t.Errorf("wrong optimization of %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestOptimizeKeepsResults(t *testing.T) {
+	tests := []string{
+		"var a = 10; var b = a * 2; func f(x) { return x + b } f(a)",
+		"var s = 0; for (i from 0 to 10) { var k = 3; s = s + i * k }; s",
+		"if (false) { 1 } elif (1 > 2) { 2 }",
+		"var r = if (true) { 1 } else { 2 }; r",
+		"var t = 5; t = 6; t",
+		"var r = f(); var g = 1; func f() { return g } r",
+		"class C { var n = 2; Init(this.n) {} func Get() { return n } } var c = new C(5); c.Get()",
+		"var x = 1; if (x == 1) { var y = 2; y }",
+		"var f = 2; if (true) { var f = 3 }; f",
+		`"a" + "b" == "ab"`,
+	}
+
+	for _, input := range tests {
+		expected := eval(parse(t, input))
+
+		optimized := parse(t, input)
+		Optimize(optimized)
+		actual := eval(optimized)
+
+		if describe(expected) != describe(actual) {
+			t.Errorf("optimizing %q changed the result. expected=%s, got=%s",
+				input, describe(expected), describe(actual))
+		}
+	}
+}
+
+func TestOptimizeLineKeepsGlobals(t *testing.T) {
+	env := object.NewEnvironment()
+	lines := []struct {
+		input    string
+		expected string
+	}{
+		{"var a = 2; var f = func() { return a }; a * 3", "var a = 2;\nvar f = func() {return a;};\n(a * 3)"},
+		{"a = 3; f()", "(a = 3)\nf()"},
+	}
+
+	var result object.Object
+	for _, line := range lines {
+		program := parser.New(lexer.New(line.input)).ParseProgram()
+		if errors := resolver.Resolve(program, env); len(errors) != 0 {
+			t.Fatalf("resolver has errors for %q: %v", line.input, errors)
+		}
+		OptimizeLine(program)
+
+		if actual := dump(program); actual != line.expected {
+			t.Errorf("wrong optimization of %q.\nexpected=%q\ngot=%q", line.input, line.expected, actual)
+		}
+		result = evaluator.Eval(program, env)
+	}
+
+	if describe(result) != "INTEGER 3" {
+		t.Errorf("f doesn't see the a of the line after it. got=%s", describe(result))
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors for %q: %v", input, p.Errors())
+	}
+	if errors := resolver.Resolve(program, object.NewEnvironment()); len(errors) != 0 {
+		t.Fatalf("resolver has errors for %q: %v", input, errors)
+	}
+	return program
+}
+
+func eval(program *ast.Program) object.Object {
+	return evaluator.Eval(program, object.NewEnvironment())
+}
+
+func dump(program *ast.Program) string {
+	stmts := []string{}
+	for _, stmt := range program.Statements {
+		stmts = append(stmts, stmt.String())
+	}
+	return strings.Join(stmts, "\n")
+}
+
+func describe(obj object.Object) string {
+	if obj == nil {
+		return "nil"
+	}
+	return string(obj.Type()) + " " + obj.Inspect()
+}
@@ -4,7 +4,9 @@ import (
 	"Pron-Lang/ast"
 	"Pron-Lang/lexer"
 	"Pron-Lang/token"
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 )
@@ -12,28 +14,49 @@ import (
 const (
 	_ int = iota // Gives priority to the operators
 	LOWEST
+	ASSIGNMENT  // =
+	TERNARY     // X ? Y : Z
+	COALESCE    // ??
 	EQUALS      // ==
-	LESSGREATER // > or <
+	LESSGREATER // > or < or in
+	PIPELINE    // |>
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
+	SHIFT       // << or >>
 	SUM         // +
-	PRODUCT     // * or /
-	PREFIX      // -X or !X
+	PRODUCT     // * or / or //
+	PREFIX      // -X or !X or ~X
+	POWER       // **
 	CALL        // myFunction(X)
-	INDEX       // array[index]
+	INDEX       // array[index] or array?[index]
 )
 
 var precedences = map[token.TokenType]int{
-	token.ASSIGN:   EQUALS,
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.MODULO:   PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:            ASSIGNMENT,
+	token.QUESTION:          TERNARY,
+	token.COALESCE:          COALESCE,
+	token.EQ:                EQUALS,
+	token.NOT_EQ:            EQUALS,
+	token.LT:                LESSGREATER,
+	token.GT:                LESSGREATER,
+	token.IN:                LESSGREATER,
+	token.PIPELINE:          PIPELINE,
+	token.PLUS:              SUM,
+	token.MINUS:             SUM,
+	token.SLASH:             PRODUCT,
+	token.ASTERISK:          PRODUCT,
+	token.MODULO:            PRODUCT,
+	token.BIT_OR:            BITOR,
+	token.BIT_XOR:           BITXOR,
+	token.BIT_AND:           BITAND,
+	token.LSHIFT:            SHIFT,
+	token.RSHIFT:            SHIFT,
+	token.FLOOR_DIV:         PRODUCT,
+	token.POWER:             POWER,
+	token.LPAREN:            CALL,
+	token.LBRACKET:          INDEX,
+	token.OPTIONAL_LBRACKET: INDEX,
 }
 
 type (
@@ -51,6 +74,10 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// inMatchGuard is set while the guard of a match arm is parsed, where
+	// => starts the body of the arm instead of an arrow function
+	inMatchGuard bool
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -97,14 +124,21 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.VAR:
+	case token.VAR, token.CONST:
 		return p.parseVarStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
 	case token.FUNCTION:
 		return p.parseDirectFunctionStatement()
+	case token.ASYNC:
+		if p.peekTokenIs(token.FUNCTION) {
+			return p.parseAsyncFunctionStatement()
+		}
+		return p.parseExpressionStatement()
 	case token.CLASS:
 		return p.parseClassStatement()
+	case token.ENUM:
+		return p.parseEnumStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -127,10 +161,17 @@ func (p *Parser) parseClassStatement() *ast.ClassStatement {
 
 	for !p.curTokenIs(token.RBRACE) {
 		switch p.curToken.Type {
-		case token.VAR:
-			fields = append(fields, p.parseVarStatement().(*ast.VarStatement))
+		case token.VAR, token.CONST:
+			field, ok := p.parseVarStatement().(*ast.VarStatement)
+			if ok && field.Pattern != nil {
+				p.errors = append(p.errors, "a class field can't be destructured")
+			} else if ok {
+				fields = append(fields, field)
+			}
 		case token.FUNCTION:
 			functions = append(functions, p.parseDirectFunctionStatement())
+		case token.ASYNC:
+			functions = append(functions, p.parseAsyncFunctionStatement())
 		case token.INIT:
 			initParams, initBody := p.parseInitFunction()
 			stmt.InitParams = initParams
@@ -146,6 +187,44 @@ func (p *Parser) parseClassStatement() *ast.ClassStatement {
 	return stmt
 }
 
+func (p *Parser) parseEnumStatement() ast.Statement {
+	stmt := &ast.EnumStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		member := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		for _, other := range stmt.Members {
+			if other.Value == member.Value {
+				p.errors = append(p.errors, fmt.Sprintf("%s is already a member of %s", member.Value, stmt.Name.Value))
+			}
+		}
+		stmt.Members = append(stmt.Members, member)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	if len(stmt.Members) == 0 {
+		p.errors = append(p.errors, fmt.Sprintf("enum %s has no members", stmt.Name.Value))
+		return nil
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseInitFunction() ([]*ast.InitParam, *ast.BlockStatement) {
 	initParams := []*ast.InitParam{}
 
@@ -161,10 +240,12 @@ func (p *Parser) parseInitFunction() ([]*ast.InitParam, *ast.BlockStatement) {
 			p.nextToken()
 			ident := p.parseIdentifier().(*ast.Identifier)
 			param := &ast.InitParam{Token: p.curToken, Parameter: ident, IsThisParam: true}
+			param.Default = p.parseDefault()
 			initParams = append(initParams, param)
 		} else if p.curTokenIs(token.IDENT) {
 			ident := p.parseIdentifier().(*ast.Identifier)
 			param := &ast.InitParam{Token: p.curToken, Parameter: ident, IsThisParam: false}
+			param.Default = p.parseDefault()
 			initParams = append(initParams, param)
 		} else {
 			return nil, nil
@@ -178,10 +259,12 @@ func (p *Parser) parseInitFunction() ([]*ast.InitParam, *ast.BlockStatement) {
 				p.nextToken()
 				ident := p.parseIdentifier().(*ast.Identifier)
 				param := &ast.InitParam{Token: p.curToken, Parameter: ident, IsThisParam: true}
+				param.Default = p.parseDefault()
 				initParams = append(initParams, param)
 			} else if p.curTokenIs(token.IDENT) {
 				ident := p.parseIdentifier().(*ast.Identifier)
 				param := &ast.InitParam{Token: p.curToken, Parameter: ident, IsThisParam: false}
+				param.Default = p.parseDefault()
 				initParams = append(initParams, param)
 			} else {
 				return nil, nil
@@ -204,6 +287,18 @@ func (p *Parser) parseInitFunction() ([]*ast.InitParam, *ast.BlockStatement) {
 	return initParams, body
 }
 
+// parseAsyncFunctionStatement parses async func name(...) {...}
+func (p *Parser) parseAsyncFunctionStatement() *ast.DirectFunctionStatement {
+	if !p.expectPeek(token.FUNCTION) {
+		return nil
+	}
+	stmt := p.parseDirectFunctionStatement()
+	if stmt != nil {
+		stmt.Function.Async = true
+	}
+	return stmt
+}
+
 func (p *Parser) parseDirectFunctionStatement() *ast.DirectFunctionStatement {
 	stmt := &ast.DirectFunctionStatement{Token: p.curToken}
 
@@ -226,13 +321,14 @@ func (p *Parser) parseDirectFunctionStatement() *ast.DirectFunctionStatement {
 	}
 
 	stmt.Function.Token = token.Token{Type: token.FUNCTION, Literal: token.FUNCTION}
-	stmt.Function.Parameters = p.parseFunctionParameters()
+	destructuring := p.parseFunctionParameters(&stmt.Function)
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
 	stmt.Function.Body = p.parseBlockStatement()
+	stmt.Function.Body.Statements = append(destructuring, stmt.Function.Body.Statements...)
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -293,6 +389,26 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 func (p *Parser) parseVarStatement() ast.Statement {
 	stmt := &ast.VarStatement{Token: p.curToken}
 
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		// destructuring: var [a, b] = ... or var {"k": v} = ...
+		if stmt.IsConstant() {
+			p.errors = append(p.errors, "a const can't be destructured")
+			return nil
+		}
+		p.nextToken()
+		stmt.Pattern = p.parsePattern()
+		if !p.expectPeek(token.ASSIGN) {
+			return nil
+		}
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	}
+
 	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
@@ -303,6 +419,10 @@ func (p *Parser) parseVarStatement() ast.Statement {
 		p.nextToken()
 		p.nextToken()
 		stmt.Value = p.parseExpression(LOWEST)
+	} else if stmt.IsConstant() {
+		// a constant without a value could never get one
+		p.addPeekError(token.ASSIGN)
+		return nil
 	} else {
 		stmt.Value = &ast.Null{}
 	}
@@ -333,7 +453,13 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 
 func (p *Parser) parseIdentifier() ast.Expression {
 	// Check for suffixes that change the context
-	if p.peekTokenIs(token.DOT) {
+	if p.peekTokenIs(token.ARROW) && !p.inMatchGuard {
+		// arrow function with one parameter: x => x * 2
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		lit := &ast.FunctionLiteral{Token: arrowFunctionToken, Parameters: []*ast.Identifier{ident}, Defaults: []ast.Expression{nil}}
+		p.nextToken()
+		return p.parseArrowBody(lit, nil)
+	} else if p.peekTokenIs(token.DOT) || p.peekTokenIs(token.OPTIONAL_DOT) {
 		return p.parseCallObjectFunction()
 	} else if p.peekTokenIs(token.INCREMENT) {
 		return p.parseIncrement()
@@ -372,14 +498,25 @@ func (p *Parser) parseCallObjectFunction() ast.Expression {
 	p.nextToken()
 
 	callObjectFunction.Token = p.curToken
+	callObjectFunction.Optional = p.curTokenIs(token.OPTIONAL_DOT)
 
 	p.nextToken()
 
-	callObjectFunction.FunctionName = p.parseIdentifier().(*ast.Identifier)
+	callObjectFunction.FunctionName = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.peekTokenIs(token.LPAREN) {
+		// no call, so it's a member of an enum: Status.Done
+		return &ast.MemberExpression{
+			Token:    callObjectFunction.Token,
+			Object:   callObjectFunction.ObjectName,
+			Member:   callObjectFunction.FunctionName,
+			Optional: callObjectFunction.Optional,
+		}
+	}
 
 	p.nextToken()
 
-	callObjectFunction.Arguments = p.parseExpressionList(token.RPAREN)
+	callObjectFunction.Arguments = p.parseCallArguments()
 
 	return callObjectFunction
 }
@@ -388,6 +525,11 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if bigValue, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			return &ast.BigIntegerLiteral{Token: p.curToken, Value: bigValue}
+		}
+	}
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
 		p.errors = append(p.errors, msg)
@@ -399,6 +541,23 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseDecimalLiteral() ast.Expression {
+	lit := &ast.DecimalLiteral{Token: p.curToken}
+
+	whole, fraction, _ := strings.Cut(strings.TrimSuffix(p.curToken.Literal, "d"), ".")
+	coefficient, ok := new(big.Int).SetString(whole+fraction, 10)
+	if !ok {
+		msg := fmt.Sprintf("could not parse %q as decimal", p.curToken.Literal)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+
+	lit.Coefficient = coefficient
+	lit.Exponent = -len(fraction)
+
+	return lit
+}
+
 func (p *Parser) parseRealLiteral() ast.Expression {
 	lit := &ast.RealLiteral{Token: p.curToken}
 
@@ -456,6 +615,10 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecendence()
+	if p.curTokenIs(token.POWER) {
+		// ** is right-associative, so 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
@@ -467,6 +630,16 @@ func (p *Parser) parseBoolean() ast.Expression {
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	if !p.inMatchGuard && p.arrowFollows() {
+		// arrow function: (a, b = 1) => a + b
+		lit := &ast.FunctionLiteral{Token: arrowFunctionToken}
+		destructuring := p.parseFunctionParameters(lit)
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+		return p.parseArrowBody(lit, destructuring)
+	}
+
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
@@ -478,6 +651,68 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	return exp
 }
 
+// arrowFunctionToken is the token of the function literal of an arrow function
+var arrowFunctionToken = token.Token{Type: token.FUNCTION, Literal: "func"}
+
+// arrowFollows reports whether the parenthesis that is the current token is
+// closed right before a =>, which makes it the parameters of an arrow function
+func (p *Parser) arrowFollows() bool {
+	l := *p.l
+	tok := p.peekToken
+	depth := 1
+
+	for tok.Type != token.EOF {
+		switch tok.Type {
+		case token.LPAREN:
+			depth++
+		case token.RPAREN:
+			depth--
+			if depth == 0 {
+				return l.NextToken().Type == token.ARROW
+			}
+		}
+		tok = l.NextToken()
+	}
+	return false
+}
+
+// parseArrowBody parses what follows the => of an arrow function. A body in
+// braces is a block, anything else is the expression the function returns
+func (p *Parser) parseArrowBody(lit *ast.FunctionLiteral, destructuring []ast.Statement) ast.Expression {
+	p.nextToken()
+
+	if p.curTokenIs(token.LBRACE) {
+		lit.Body = p.parseBlockStatement()
+	} else {
+		returnToken := token.Token{Type: token.RETURN, Literal: "return"}
+		lit.Body = &ast.BlockStatement{Token: p.curToken, Statements: []ast.Statement{
+			&ast.ReturnStatement{Token: returnToken, ReturnValue: p.parseExpression(LOWEST)},
+		}}
+	}
+	lit.Body.Statements = append(destructuring, lit.Body.Statements...)
+
+	return lit
+}
+
+// parsePipelineExpression turns x |> f(a) into the call f(x, a), and x |> f
+// into f(x)
+func (p *Parser) parsePipelineExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+	precedence := p.curPrecendence()
+	p.nextToken()
+	right := p.parseExpression(precedence)
+
+	switch right := right.(type) {
+	case *ast.CallExpression:
+		right.Arguments = append([]ast.Expression{left}, right.Arguments...)
+		return right
+	case *ast.CallObjectFunction:
+		right.Arguments = append([]ast.Expression{left}, right.Arguments...)
+		return right
+	}
+	return &ast.CallExpression{Token: tok, Function: right, Arguments: []ast.Expression{left}}
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
 	ifToken := p.curToken
 
@@ -598,46 +833,103 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	destructuring := p.parseFunctionParameters(lit)
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
 	lit.Body = p.parseBlockStatement()
+	lit.Body.Statements = append(destructuring, lit.Body.Statements...)
 
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+// parseFunctionParameters parses the parameters, their default values and a
+// last ...rest parameter into function. It returns the var statements that
+// destructure the parameters that are patterns, to put at the start of the body
+func (p *Parser) parseFunctionParameters(function *ast.FunctionLiteral) []ast.Statement {
 	identifiers := []*ast.Identifier{}
+	defaults := []ast.Expression{}
+	destructuring := []ast.Statement{}
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		function.Parameters = identifiers
+		return destructuring
 	}
 
-	p.nextToken()
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
-
-	for p.peekTokenIs(token.COMMA) {
+	for {
 		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+			defaults = append(defaults, nil)
+			function.Variadic = true
+			if p.peekTokenIs(token.COMMA) {
+				p.errors = append(p.errors, "a rest parameter must be the last parameter")
+				return nil
+			}
+			break
+		}
+
+		if p.curTokenIs(token.LBRACKET) || p.curTokenIs(token.LBRACE) {
+			ident, stmt := p.parsePatternBinding("$" + strconv.Itoa(len(identifiers)))
+			identifiers = append(identifiers, ident)
+			destructuring = append(destructuring, stmt)
+		} else {
+			ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			identifiers = append(identifiers, ident)
+		}
+		defaults = append(defaults, p.parseDefault())
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
 	}
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
 
-	return identifiers
+	function.Parameters = identifiers
+	function.Defaults = defaults
+	return destructuring
+}
+
+// parseDefault parses the default value after a parameter, or returns nil
+// when it has none
+func (p *Parser) parseDefault() ast.Expression {
+	if !p.peekTokenIs(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+	p.nextToken()
+	return p.parseExpression(ASSIGNMENT)
+}
+
+// parsePatternBinding parses a pattern where a variable is expected. It
+// returns a hidden variable with the given name to use instead, and the var
+// statement that destructures it. The name can't be written in Pron so it
+// doesn't clash with other variables
+func (p *Parser) parsePatternBinding(name string) (*ast.Identifier, ast.Statement) {
+	tok := p.curToken
+	pattern := p.parsePattern()
+
+	stmt := &ast.VarStatement{
+		Token:   token.Token{Type: token.VAR, Literal: "var"},
+		Pattern: pattern,
+		Value:   &ast.Identifier{Token: tok, Value: name},
+	}
+	return &ast.Identifier{Token: tok, Value: name}, stmt
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Arguments = p.parseCallArguments()
 	return exp
 }
 
@@ -663,6 +955,52 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// parseCallArguments parses the arguments of a call. They can spread an
+// array, like ...arr, and end with named arguments, like port: 80
+func (p *Parser) parseCallArguments() []ast.Expression {
+	args := []ast.Expression{}
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return args
+	}
+
+	named := false
+	for {
+		p.nextToken()
+		if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) {
+			arg := &ast.NamedArgument{Token: p.curToken, Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+			p.nextToken()
+			p.nextToken()
+			arg.Value = p.parseExpression(LOWEST)
+			args = append(args, arg)
+			named = true
+		} else {
+			if named {
+				p.errors = append(p.errors, "a named argument can only be followed by named arguments")
+			}
+			if p.curTokenIs(token.ELLIPSIS) {
+				arg := &ast.SpreadExpression{Token: p.curToken}
+				p.nextToken()
+				arg.Value = p.parseExpression(LOWEST)
+				args = append(args, arg)
+			} else {
+				args = append(args, p.parseExpression(LOWEST))
+			}
+		}
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return args
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -670,13 +1008,85 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
-	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		array.Elements = []ast.Expression{}
+		return array
+	}
+
+	p.nextToken()
+	first := p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.FOR) {
+		return p.parseComprehension(array.Token, nil, first, token.RBRACKET)
+	}
+
+	array.Elements = []ast.Expression{first}
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		array.Elements = append(array.Elements, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
 
 	return array
 }
 
+// parseComprehension parses a comprehension from its 'for' on, after the
+// value, or the key and value, that it builds from every iteration
+func (p *Parser) parseComprehension(tok token.Token, key, value ast.Expression, end token.TokenType) ast.Expression {
+	comprehension := &ast.ComprehensionExpression{Token: tok, Key: key, Value: value}
+	p.nextToken()
+
+	for {
+		p.nextToken()
+		comprehension.Variables = append(comprehension.Variables, p.parsePattern())
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	switch len(comprehension.Variables) {
+	case 1:
+		comprehension.Binding = comprehension.Variables[0]
+	case 2:
+		comprehension.Binding = &ast.ArrayPattern{Token: tok, Elements: comprehension.Variables}
+	default:
+		p.errors = append(p.errors, "a comprehension can only have one or two variables")
+		return nil
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	comprehension.Iterable = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		comprehension.Condition = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return comprehension
+}
+
+func (p *Parser) parseSetLiteral() ast.Expression {
+	set := &ast.SetLiteral{Token: p.curToken}
+
+	set.Elements = p.parseExpressionList(token.RBRACE)
+
+	return set
+}
+
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left, Optional: p.curTokenIs(token.OPTIONAL_LBRACKET)}
 
 	p.nextToken()
 
@@ -689,6 +1099,185 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseConditionalExpression(condition ast.Expression) ast.Expression {
+	exp := &ast.ConditionalExpression{Token: p.curToken, Condition: condition}
+
+	p.nextToken()
+	exp.Consequence = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	// A conditional is right-associative, so a ? b : c ? d : e is a ? b : (c ? d : e)
+	p.nextToken()
+	exp.Alternative = p.parseExpression(TERNARY - 1)
+
+	return exp
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		// The arms can be separated by commas
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+	}
+	p.nextToken()
+
+	return expression
+}
+
+// parseMatchArm parses patterns separated by commas, an optional guard and the
+// body after =>. The body is a block when it starts with {, otherwise an expression
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{}
+
+	arm.Patterns = append(arm.Patterns, p.parsePattern())
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		arm.Patterns = append(arm.Patterns, p.parsePattern())
+	}
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		p.inMatchGuard = true
+		arm.Guard = p.parseExpression(LOWEST)
+		p.inMatchGuard = false
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+	arm.Token = p.curToken
+	p.nextToken()
+
+	if p.curTokenIs(token.LBRACE) {
+		arm.Body = p.parseBlockStatement()
+	} else {
+		stmtToken := p.curToken
+		body := p.parseExpression(LOWEST)
+		arm.Body = &ast.BlockStatement{Token: stmtToken, Statements: []ast.Statement{
+			&ast.ExpressionStatement{Token: stmtToken, Expression: body},
+		}}
+	}
+
+	return arm
+}
+
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		if p.peekTokenIs(token.DOT) {
+			return p.parseLiteralPattern()
+		}
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.peekTokenIs(token.IDENT) {
+			return ident
+		}
+		p.nextToken()
+		name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		return &ast.TypePattern{Token: ident.Token, TypeName: ident, Name: name}
+
+	case token.LBRACKET:
+		pattern := &ast.ArrayPattern{Token: p.curToken}
+		hasRest := false
+		for !p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			if p.curTokenIs(token.ELLIPSIS) {
+				rest := &ast.RestPattern{Token: p.curToken}
+				if !p.expectPeek(token.IDENT) {
+					return pattern
+				}
+				if hasRest {
+					p.errors = append(p.errors, "an array pattern can only have one rest pattern")
+				}
+				hasRest = true
+				rest.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+				pattern.Elements = append(pattern.Elements, rest)
+			} else {
+				pattern.Elements = append(pattern.Elements, p.parsePattern())
+			}
+			if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+				return pattern
+			}
+		}
+		p.nextToken()
+		return pattern
+
+	case token.LBRACE:
+		pattern := &ast.HashPattern{Token: p.curToken}
+		for !p.peekTokenIs(token.RBRACE) {
+			p.nextToken()
+			pattern.Keys = append(pattern.Keys, p.parseLiteralPattern().Value)
+			if !p.expectPeek(token.COLON) {
+				return pattern
+			}
+			p.nextToken()
+			pattern.Values = append(pattern.Values, p.parsePattern())
+			if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+				return pattern
+			}
+		}
+		p.nextToken()
+		return pattern
+
+	default:
+		return p.parseLiteralPattern()
+	}
+}
+
+// parseLiteralPattern parses a number, which can be negative, a string, a
+// boolean or the member of an enum
+func (p *Parser) parseLiteralPattern() *ast.LiteralPattern {
+	pattern := &ast.LiteralPattern{Token: p.curToken}
+
+	switch p.curToken.Type {
+	case token.INT, token.REAL, token.DECIMAL, token.STRING, token.TRUE, token.FALSE:
+		pattern.Value = p.prefixParseFns[p.curToken.Type]()
+	case token.MINUS:
+		if p.peekTokenIs(token.INT) || p.peekTokenIs(token.REAL) || p.peekTokenIs(token.DECIMAL) {
+			pattern.Value = p.parsePrefixExpression()
+		}
+	case token.IDENT:
+		if p.peekTokenIs(token.DOT) {
+			if member, ok := p.parseCallObjectFunction().(*ast.MemberExpression); ok {
+				pattern.Value = member
+			}
+		}
+	}
+
+	if pattern.Value == nil {
+		msg := fmt.Sprintf("expected a pattern, got %s", p.curToken.Type)
+		p.errors = append(p.errors, msg)
+		pattern.Value = &ast.Null{}
+	}
+	return pattern
+}
+
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
@@ -704,7 +1293,12 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 
+		if len(hash.Keys) == 0 && p.peekTokenIs(token.FOR) {
+			return p.parseComprehension(hash.Token, key, value, token.RBRACE)
+		}
+
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -726,7 +1320,17 @@ func (p *Parser) parseForloopExpression() ast.Expression {
 	}
 
 	p.nextToken()
-	localVar := p.parseIdentifier()
+	var localVar ast.Expression
+	var destructuring ast.Statement
+	if p.curTokenIs(token.LBRACKET) || p.curTokenIs(token.LBRACE) {
+		localVar, destructuring = p.parsePatternBinding("$item")
+		if !p.peekTokenIs(token.IN) {
+			p.addPeekError(token.IN)
+			return nil
+		}
+	} else {
+		localVar = p.parseIdentifier()
+	}
 
 	if p.peekTokenIs(token.FROM) {
 		// increment forloop
@@ -772,6 +1376,9 @@ func (p *Parser) parseForloopExpression() ast.Expression {
 		}
 
 		expression.Body = p.parseBlockStatement()
+		if destructuring != nil {
+			expression.Body.Statements = append([]ast.Statement{destructuring}, expression.Body.Statements...)
+		}
 
 		return expression
 	} else {
@@ -790,11 +1397,99 @@ func (p *Parser) parseObjectInitialization() ast.Expression {
 		return nil
 	}
 
-	objectInitialiation.Arguments = p.parseExpressionList(token.RPAREN)
+	objectInitialiation.Arguments = p.parseCallArguments()
 
 	return objectInitialiation
 }
 
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	expression := &ast.SpawnExpression{Token: p.curToken}
+
+	p.nextToken()
+
+	call, ok := p.parseExpression(PREFIX).(*ast.CallExpression)
+	if !ok {
+		p.errors = append(p.errors, "spawn needs a function call")
+		return nil
+	}
+	expression.Call = call
+
+	return expression
+}
+
+// parseAsyncFunctionLiteral parses async func(...) {...}
+func (p *Parser) parseAsyncFunctionLiteral() ast.Expression {
+	if !p.expectPeek(token.FUNCTION) {
+		return nil
+	}
+	lit, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+	lit.Async = true
+	return lit
+}
+
+func (p *Parser) parseAwaitExpression() ast.Expression {
+	expression := &ast.AwaitExpression{Token: p.curToken}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(PREFIX)
+
+	return expression
+}
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	macro := &ast.MacroLiteral{Token: p.curToken}
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	destructuring := p.parseFunctionParameters(lit)
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+	lit.Body.Statements = append(destructuring, lit.Body.Statements...)
+	macro.Function = lit
+
+	return macro
+}
+
+func (p *Parser) parseQuoteExpression() ast.Expression {
+	expression := &ast.QuoteExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Node = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return expression
+}
+
+func (p *Parser) parseUnquoteExpression() ast.Expression {
+	expression := &ast.UnquoteExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return expression
+}
+
 func (p *Parser) parseBlockComment() ast.Expression {
 	for !p.peekTokenIs(token.ENDBLOCKCOMMENT) {
 		p.nextToken()
@@ -819,8 +1514,10 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.REAL, p.parseRealLiteral)
+	p.registerPrefix(token.DECIMAL, p.parseDecimalLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.BIT_NOT, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
@@ -829,8 +1526,16 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.HASHBRACE, p.parseSetLiteral)
 	p.registerPrefix(token.FOR, p.parseForloopExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 	p.registerPrefix(token.NEW, p.parseObjectInitialization)
+	p.registerPrefix(token.SPAWN, p.parseSpawnExpression)
+	p.registerPrefix(token.ASYNC, p.parseAsyncFunctionLiteral)
+	p.registerPrefix(token.AWAIT, p.parseAwaitExpression)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.QUOTE, p.parseQuoteExpression)
+	p.registerPrefix(token.UNQUOTE, p.parseUnquoteExpression)
 	p.registerPrefix(token.THIS, p.parseThisPrefixedIdentifier)
 	p.registerPrefix(token.STARTBLOCKCOMMENT, p.parseBlockComment)
 
@@ -844,8 +1549,20 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.IN, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.LSHIFT, p.parseInfixExpression)
+	p.registerInfix(token.RSHIFT, p.parseInfixExpression)
+	p.registerInfix(token.FLOOR_DIV, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.OPTIONAL_LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.QUESTION, p.parseConditionalExpression)
+	p.registerInfix(token.PIPELINE, p.parsePipelineExpression)
+	p.registerInfix(token.COALESCE, p.parseInfixExpression)
 	p.registerInfix(token.ASSIGN, p.parseInfixExpression)
 
 	return p
@@ -70,6 +70,45 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	testLiteralExpression(t, stmt.Expression, 5)
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	input := "9223372036854775808"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.BigIntegerLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.BigIntegerLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value.String() != input {
+		t.Errorf("literal.Value not %s. got=%s", input, literal.Value)
+	}
+}
+
+func TestDecimalLiteralExpression(t *testing.T) {
+	input := "1.10d"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.DecimalLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.DecimalLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Coefficient.Int64() != 110 || literal.Exponent != -2 {
+		t.Errorf("literal is not 110 * 10^-2. got=%s * 10^%d", literal.Coefficient, literal.Exponent)
+	}
+	if literal.String() != input {
+		t.Errorf("literal.String() not %q. got=%q", input, literal.String())
+	}
+}
+
 func TestRealLiteralExpression(t *testing.T) {
 	input := "5.4"
 
@@ -125,6 +164,271 @@ func TestVarStatements(t *testing.T) {
 	}
 }
 
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const MAX = 10", "const MAX = 10;"},
+		{"const name = first(names);", "const name = first(names);"},
+		{"class A { const b = 1 }", "class A {const b = 1}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"const x", "expected next token to be =, got EOF instead"},
+		{"const [a, b] = pair", "a const can't be destructured"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"enum Status { Pending, Running, Done }", "enum Status {Pending, Running, Done}"},
+		{"enum Status { Pending, Done, }", "enum Status {Pending, Done}"},
+		{"var s = Status.Done", "var s = Status.Done;"},
+		{"s?.Done", "s?.Done"},
+		{"s.Name()", "s.Name()"},
+		{"Status.Done == s", "(Status.Done == s)"},
+		{"match (s) { Status.Done => 1, Status st => 2 }", "match (s) {Status.Done => 1, Status st => 2}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"enum Status { Done, Done }", "Done is already a member of Status"},
+		{"enum Status {}", "enum Status has no members"},
+		{"enum Status { 1 }", "expected next token to be IDENT, got INT instead"},
+		{"enum { A }", "expected next token to be IDENT, got { instead"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestSpawn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"spawn f(1, 2)", "spawn f(1, 2)"},
+		{"var t = spawn fetch(url)", "var t = spawn fetch(url);"},
+		{"wait(spawn f())", "wait(spawn f())"},
+		{"spawn func(x) { x }(1)", "spawn func(x) {x}(1)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"spawn f", "spawn needs a function call"},
+		{"spawn 1 + 2", "spawn needs a function call"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestAsyncAwait(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"async func fetch(url) { await get(url) }", "async func fetch(url){await get(url)}"},
+		{"var f = async func(x) { x }", "var f = async func(x) {x};"},
+		{"await f(1)", "await f(1)"},
+		{"await f(1) + 1", "(await f(1) + 1)"},
+		{"var x = await sleep(10)", "var x = await sleep(10);"},
+		{"class A { async func Load() { await sleep(1) } }", "class A {async func Load(){await sleep(1)}}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"async 1", "expected next token to be FUNCTION, got INT instead"},
+		{"var f = async (x) => x", "expected next token to be FUNCTION, got ( instead"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var m = macro(x, y) { quote(unquote(x) + unquote(y)) }", "var m = macro(x, y) {quote((unquote(x) + unquote(y)))};"},
+		{"quote(1 + 2)", "quote((1 + 2))"},
+		{"quote(f(unquote(a * 2)))", "quote(f(unquote((a * 2))))"},
+		{"m(1, 2)", "m(1, 2)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"quote 1", "expected next token to be (, got INT instead"},
+		{"unquote(1", "expected next token to be ), got EOF instead"},
+		{"var m = macro x", "expected next token to be (, got IDENT instead"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var [q, r] = divmod(7, 2)", "var [q, r] = divmod(7, 2);"},
+		{`var {"name": n, "age": a} = person`, "var {name: n, age: a} = person;"},
+		{"var [head, ...tail] = arr", "var [head, ...tail] = arr;"},
+		{"var [[a], ..._, {1: b}] = arr", "var [[a], ..._, {1: b}] = arr;"},
+		{"var f = func([a, b], c) { a }", "var f = func($0, c) {var [a, b] = $0;a};"},
+		{"func f(a, {\"k\": b}) { b }", "func f(a, $1){var {k: b} = $1;, b}"},
+		{"for ([k, v] in pairs) { k }", "for ( $item in pairs ) {var [k, v] = $item;k}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"var [a, b]", "expected next token to be =, got EOF instead"},
+		{"var [...a, ...b] = arr", "an array pattern can only have one rest pattern"},
+		{"var [...1] = arr", "expected next token to be IDENT, got INT instead"},
+		{"for ([a] from 1 to 2) {}", "expected next token to be IN, got FROM instead"},
+		{"class A { var [a] = [1] }", "a class field can't be destructured"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -372,6 +676,70 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a ** b ** c",
+			"(a ** (b ** c))",
+		},
+		{
+			"-a ** b",
+			"(-(a ** b))",
+		},
+		{
+			"a * b ** -c",
+			"(a * (b ** (-c)))",
+		},
+		{
+			"a // b * c",
+			"((a // b) * c)",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & b << c + d",
+			"(a & (b << (c + d)))",
+		},
+		{
+			"a >> b < c | d",
+			"((a >> b) < (c | d))",
+		},
+		{
+			"~a & ~b == c",
+			"(((~a) & (~b)) == c)",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a == b ? c + d : e",
+			"((a == b) ? (c + d) : e)",
+		},
+		{
+			"x = a ? b : c",
+			"(x = (a ? b : c))",
+		},
+		{
+			"a ?? b == c",
+			"(a ?? (b == c))",
+		},
+		{
+			"a ?? b ? c : d",
+			"((a ?? b) ? c : d)",
+		},
+		{
+			"a?[b] ?? c",
+			"((a?[b]) ?? c)",
+		},
+		{
+			"a?.Method(b) ?? c",
+			"(a?.Method(b) ?? c)",
+		},
+		{
+			"x = a == b",
+			"(x = (a == b))",
+		},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -700,6 +1068,138 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestFunctionParameterDefaultsAndRest(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var f = func(a, b = 2, c = a * b) {}", "var f = func(a, b = 2, c = (a * b)) {};"},
+		{"var f = func(a, ...rest) {}", "var f = func(a, ...rest) {};"},
+		{"func f([a] = [1], ...rest) {}", "func f($0 = [1], ...rest){var [a] = $0;}"},
+		{"class A { Init(this.a, b = 2) {} }", "class A {Init(this.a, b = 2) {}}"},
+		{"connect(host: \"x\", port: 80)", "connect(host: x, port: 80)"},
+		{"f(1, ...arr, 2, x: a ? b : c)", "f(1, ...arr, 2, x: (a ? b : c))"},
+		{"p.Move(...delta, by: 2)", "p.Move(...delta, by: 2)"},
+		{"new Point(...xy)", "new Point(...xy)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"func f(...rest, a) {}", "a rest parameter must be the last parameter"},
+		{"func f(...rest = 1) {}", "expected next token to be ), got = instead"},
+		{"f(a: 1, 2)", "a named argument can only be followed by named arguments"},
+		{"f(a: 1, ...b)", "a named argument can only be followed by named arguments"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestArrowFunctionsAndPipelines(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x => x * 2", "func(x) {return (x * 2);}"},
+		{"(x) => x * 2", "func(x) {return (x * 2);}"},
+		{"() => 42", "func() {return 42;}"},
+		{"(a, b = 1, ...c) => a + b", "func(a, b = 1, ...c) {return (a + b);}"},
+		{"([a, b]) => a", "func($0) {var [a, b] = $0;return a;}"},
+		{"x => { var y = x; y }", "func(x) {var y = x;y}"},
+		{"x => y => x + y", "func(x) {return func(y) {return (x + y);};}"},
+		{"f(x => x, 1)", "f(func(x) {return x;}, 1)"},
+		{"(a + b) * c", "((a + b) * c)"},
+		{"(f(a)) + b", "(f(a) + b)"},
+		{"data |> filter(isValid) |> map(toName)", "map(filter(data, isValid), toName)"},
+		{"x |> f", "f(x)"},
+		{"x |> obj.Method(1)", "obj.Method(x, 1)"},
+		{"a + 1 |> f == b", "(f((a + 1)) == b)"},
+		{"x |> (y => y * 2)", "func(y) {return (y * 2);}(x)"},
+		{"match (x) { n if ok => n }", "match (x) {n if ok => n}"},
+		{"match (x) { n if (ok) => n }", "match (x) {n if ok => n}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[x * x for x in nums]", "[(x * x) for x in nums]"},
+		{"[x for x in nums if x % 2 == 0]", "[x for x in nums if ((x % 2) == 0)]"},
+		{"{k: v * 2 for k, v in m}", "{k:(v * 2) for k, v in m}"},
+		{"[a + b for [a, b] in pairs]", "[(a + b) for [a, b] in pairs]"},
+		{"[f(x) for x in g(y) if ok]", "[f(x) for x in g(y) if ok]"},
+		{"[1, 2]", "[1, 2]"},
+		{"[]", "[]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestComprehensionErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"[x for a, b, c in xs]", "a comprehension can only have one or two variables"},
+		{"[x for x of xs]", "expected next token to be IN, got IDENT instead"},
+		{"{k: v for k in m, 1}", "expected next token to be }, got , instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
 func TestDirectFunctionStatementParsing(t *testing.T) {
 	input := `func add(x, y) { x + y; }`
 
@@ -861,6 +1361,117 @@ func TestParsingArrayLiterals(t *testing.T) {
 	testInfixExpression(t, array.Elements[2], 3, "+", 3)
 }
 
+func TestParsingSetLiterals(t *testing.T) {
+	input := "#{1, 2 * 2}"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	set, ok := stmt.Expression.(*ast.SetLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.SetLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(set.Elements) != 2 {
+		t.Fatalf("len(set.Elements) not 2. got=%d", len(set.Elements))
+	}
+
+	testIntegerLiteral(t, set.Elements[0], 1)
+	testInfixExpression(t, set.Elements[1], 2, "*", 2)
+}
+
+func TestParsingInExpression(t *testing.T) {
+	input := "a + 1 in b"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	if stmt.Expression.String() != "((a + 1) in b)" {
+		t.Errorf("expected=%q, got=%q", "((a + 1) in b)", stmt.Expression.String())
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (x) {
+		1, -2 => "a",
+		[a, _] if a > 1 => a,
+		{"type": t, 1: true} => t
+		Person p => { var n = p; n }
+		_ => 0
+	}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	match, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("exp not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, match.Subject, "x") {
+		return
+	}
+
+	expectedArms := []string{
+		"1, (-2) => a",
+		"[a, _] if (a > 1) => a",
+		"{type: t, 1: true} => t",
+		"Person p => var n = p;n",
+		"_ => 0",
+	}
+	if len(match.Arms) != len(expectedArms) {
+		t.Fatalf("match.Arms does not contain %d arms. got=%d", len(expectedArms), len(match.Arms))
+	}
+	for i, expected := range expectedArms {
+		if match.Arms[i].String() != expected {
+			t.Errorf("arm %d wrong. expected=%q, got=%q", i, expected, match.Arms[i].String())
+		}
+	}
+
+	if _, ok := match.Arms[1].Patterns[0].(*ast.ArrayPattern); !ok {
+		t.Errorf("pattern not ast.ArrayPattern. got=%T", match.Arms[1].Patterns[0])
+	}
+	if _, ok := match.Arms[2].Patterns[0].(*ast.HashPattern); !ok {
+		t.Errorf("pattern not ast.HashPattern. got=%T", match.Arms[2].Patterns[0])
+	}
+	if _, ok := match.Arms[3].Patterns[0].(*ast.TypePattern); !ok {
+		t.Errorf("pattern not ast.TypePattern. got=%T", match.Arms[3].Patterns[0])
+	}
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"match (x) { a + 1 => 1 }", "expected next token to be =>, got + instead"},
+		{"match (x) { (1) => 1 }", "expected a pattern, got ("},
+		{"match (x) { 1 }", "expected next token to be =>, got } instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expectedError {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
 func TestParsingIndexExpressions(t *testing.T) {
 	input := "myArray[1 + 1]"
 
@@ -4,7 +4,9 @@ import (
 	"Pron-Lang/evaluator"
 	"Pron-Lang/lexer"
 	"Pron-Lang/object"
+	"Pron-Lang/optimizer"
 	"Pron-Lang/parser"
+	"Pron-Lang/resolver"
 	"bufio"
 	"fmt"
 	"io"
@@ -15,6 +17,7 @@ const PROMT = ">> "
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	macroEnv := object.NewEnvironment()
 
 	for {
 		fmt.Printf(PROMT)
@@ -36,7 +39,18 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
+		if errors := evaluator.ExpandMacros(program, macroEnv); len(errors) != 0 {
+			PrintMacroErrors(out, errors)
+			continue
+		}
+
+		if errors := resolver.Resolve(program, env); len(errors) != 0 {
+			PrintResolverErrors(out, errors)
+			continue
+		}
+		optimizer.OptimizeLine(program)
+
+		evaluated := evaluator.Run(program, env)
 		if evaluated != nil && evaluated.Inspect() != "null" {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
@@ -50,3 +64,17 @@ func PrintParserErrors(out io.Writer, errors []string) {
 		io.WriteString(out, "\t"+"- "+msg+"\n")
 	}
 }
+
+func PrintResolverErrors(out io.Writer, errors []string) {
+	io.WriteString(out, " resolver errors:\n")
+	for _, msg := range errors {
+		io.WriteString(out, "\t"+"- "+msg+"\n")
+	}
+}
+
+func PrintMacroErrors(out io.Writer, errors []string) {
+	io.WriteString(out, " macro errors:\n")
+	for _, msg := range errors {
+		io.WriteString(out, "\t"+"- "+msg+"\n")
+	}
+}
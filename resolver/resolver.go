@@ -0,0 +1,592 @@
+// Package resolver gives the variables of a program their slots before it runs
+package resolver
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/object"
+	"fmt"
+)
+
+// scope mirrors one object.Environment frame the evaluator will create
+type scope struct {
+	slots  map[string]int
+	locals *[]string
+	outer  *scope // nil for the global env and class envs
+}
+
+// declare gives name a new slot, so a name declared in an inner block
+// doesn't overwrite the variable it shadows
+func (s *scope) declare(name string) int {
+	slot := len(*s.locals)
+	*s.locals = append(*s.locals, name)
+	s.slots[name] = slot
+	return slot
+}
+
+// bind points ident at the closest variable with its name, looking from
+// s outwards. Returns false if there is none
+func (s *scope) bind(ident *ast.Identifier) bool {
+	depth := 0
+	for ; s != nil; s = s.outer {
+		if ident.HasThisPrefix && s.outer != nil {
+			depth++
+			continue
+		}
+		if slot, ok := s.slots[ident.Value]; ok {
+			ident.Resolved = true
+			ident.Depth = depth
+			ident.Slot = slot
+			return true
+		}
+		depth++
+	}
+	return false
+}
+
+// block is a block of code in a frame. A name declared in it is visible
+// until the end of the block
+type block struct {
+	declared map[string]bool // names declared in the block, for duplicate checks
+	slots    map[string]int  // the slot of every name declared in the block
+	hidden   map[string]int  // the slot each of those names hid in the frame, or -1
+	pending  []*reference    // names in functions of the block that weren't declared yet
+}
+
+// reference is a name used in a function before the block around the
+// function declares it. A function only runs once it's called, so the
+// name can still be declared later in the block
+type reference struct {
+	ident  *ast.Identifier
+	scope  *scope // the scope the name is used in
+	target bool   // true when the name is assigned rather than read
+}
+
+func newBlock() *block {
+	return &block{declared: make(map[string]bool), slots: make(map[string]int), hidden: make(map[string]int)}
+}
+
+type resolver struct {
+	scope  *scope
+	blocks []*block
+	tail   bool // true when a return ends the function the statements are in
+	async  bool // true where await can be used: in async functions and at the top level
+	macros bool // true where a macro can be defined: at the top level, while macros are defined
+	quote  bool // true where quote can be used: in macros
+	fn     int  // the number of blocks around the function being resolved, 0 outside functions
+	funcs  bool // true once a function is made in the loop being resolved
+	errors []string
+}
+
+// Resolve gives every variable in the program a (depth, slot) pair,
+// so the evaluator can find it without looking up its name.
+// The top level of the program is resolved against the frame env.
+// The variables already in env count as declared, so the program
+// can't declare them again.
+// Returns the undefined and duplicate variables it found.
+func Resolve(program *ast.Program, env *object.Environment) []string {
+	return resolveProgram(program, env, &resolver{async: true})
+}
+
+// ResolveMacros resolves the macro definitions of a program like Resolve.
+// Macros can be defined there, and use quote
+func ResolveMacros(program *ast.Program, env *object.Environment) []string {
+	return resolveProgram(program, env, &resolver{macros: true})
+}
+
+// resolveProgram resolves the program with r, which decides what can be used in it
+func resolveProgram(program *ast.Program, env *object.Environment, r *resolver) []string {
+	globals := append([]string{}, env.Names()...)
+	root := &scope{slots: make(map[string]int), locals: &globals}
+
+	r.scope = root
+	r.beginBlock()
+	global := r.blocks[0]
+	for slot, name := range globals {
+		if name != "" {
+			root.slots[name] = slot
+			global.declared[name] = true
+			global.slots[name] = slot
+		}
+	}
+	r.resolveStatements(program.Statements)
+	r.endBlock()
+
+	return r.errors
+}
+
+func (r *resolver) addError(format string, a ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, a...))
+}
+
+func (r *resolver) beginBlock() {
+	r.blocks = append(r.blocks, newBlock())
+}
+
+// endBlock binds the names its functions used before the block declared
+// them, and passes the others on to the block around it. Then it hides the
+// names declared in the block again, and shows the ones they shadowed
+func (r *resolver) endBlock() {
+	block := r.blocks[len(r.blocks)-1]
+	for _, ref := range block.pending {
+		if ref.scope.bind(ref.ident) {
+			continue
+		}
+		if len(r.blocks) > 1 {
+			outer := r.blocks[len(r.blocks)-2]
+			outer.pending = append(outer.pending, ref)
+		} else {
+			r.notFound(ref.ident, ref.target)
+		}
+	}
+	for name, slot := range block.hidden {
+		if slot == -1 {
+			delete(r.scope.slots, name)
+		} else {
+			r.scope.slots[name] = slot
+		}
+	}
+	r.blocks = r.blocks[:len(r.blocks)-1]
+}
+
+// beginScope starts a new frame. Pass a nil outer to start a root frame
+func (r *resolver) beginScope(locals *[]string, outer *scope) *scope {
+	previous := r.scope
+	r.scope = &scope{slots: make(map[string]int), locals: locals, outer: outer}
+	r.beginBlock()
+	return previous
+}
+
+func (r *resolver) endScope(previous *scope) {
+	r.endBlock()
+	r.scope = previous
+}
+
+// declare binds ident in the current frame and reports it if it's
+// already declared in the current block
+func (r *resolver) declare(ident *ast.Identifier) {
+	block := r.blocks[len(r.blocks)-1]
+	if block.declared[ident.Value] {
+		r.addError("%s is already declared in this scope", ident.Value)
+	}
+	block.declared[ident.Value] = true
+
+	ident.Resolved = true
+	ident.Depth = 0
+	if slot, ok := block.slots[ident.Value]; ok {
+		ident.Slot = slot
+		return
+	}
+	if slot, ok := r.scope.slots[ident.Value]; ok {
+		block.hidden[ident.Value] = slot
+	} else {
+		block.hidden[ident.Value] = -1
+	}
+	ident.Slot = r.scope.declare(ident.Value)
+	block.slots[ident.Value] = ident.Slot
+}
+
+// bind points ident at the closest variable with its name. Returns false if there is none
+func (r *resolver) bind(ident *ast.Identifier) bool {
+	return r.scope.bind(ident)
+}
+
+// later leaves a name that isn't declared yet to the block around the
+// function it's used in. Returns false outside functions, where the
+// name has to be declared already
+func (r *resolver) later(ident *ast.Identifier, target bool) bool {
+	if r.fn == 0 {
+		return false
+	}
+	outer := r.blocks[r.fn-1]
+	outer.pending = append(outer.pending, &reference{ident: ident, scope: r.scope, target: target})
+	return true
+}
+
+func (r *resolver) resolveIdentifier(ident *ast.Identifier) {
+	if r.bind(ident) || r.later(ident, false) {
+		return
+	}
+	r.notFound(ident, false)
+}
+
+// resolveTarget resolves a variable that is being changed rather than read
+func (r *resolver) resolveTarget(ident *ast.Identifier) {
+	if r.bind(ident) || r.later(ident, true) {
+		return
+	}
+	r.notFound(ident, true)
+}
+
+func (r *resolver) notFound(ident *ast.Identifier, target bool) {
+	switch {
+	case target && ident.HasThisPrefix:
+		r.addError("%s is not defined. Try to remove 'this.'", ident.Value)
+	case target:
+		r.addError("%s is not defined", ident.Value)
+	case ident.HasThisPrefix:
+		r.addError("identifier not found: '%s'. Try to remove 'this.'", ident.Value)
+	default:
+		if _, ok := object.GetBuiltin(ident.Value); !ok {
+			r.addError("identifier not found: %s", ident.Value)
+		}
+	}
+}
+
+// resolveStatements hoists the functions and classes of a block,
+// so they can call each other regardless of order
+func (r *resolver) resolveStatements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.DirectFunctionStatement:
+			r.declare(stmt.Name)
+		case *ast.ClassStatement:
+			r.declare(stmt.Name)
+		case *ast.EnumStatement:
+			r.declare(stmt.Name)
+		}
+	}
+
+	for _, stmt := range stmts {
+		r.resolve(stmt)
+	}
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	// A return can only end the function from its body, or from the branches
+	// of an if or a match there. In a loop it only ends the loop
+	tail := r.tail
+	switch node.(type) {
+	case *ast.ExpressionStatement, *ast.BlockStatement, *ast.ReturnStatement,
+		*ast.IfExpression, *ast.ElseIfExpression, *ast.MatchExpression:
+	default:
+		r.tail = false
+	}
+	defer func() { r.tail = tail }()
+
+	switch node := node.(type) {
+	// Statements
+	case *ast.ExpressionStatement:
+		r.resolve(node.Expression)
+
+	case *ast.ReturnStatement:
+		if _, ok := node.ReturnValue.(*ast.CallExpression); ok && r.tail {
+			node.Tail = true
+		}
+		r.resolve(node.ReturnValue)
+
+	case *ast.VarStatement:
+		// A function can call itself through the variable it's assigned to
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok && node.Pattern == nil {
+			r.declare(node.Name)
+			r.resolve(node.Value)
+			break
+		}
+		r.resolve(node.Value)
+		if node.Pattern != nil {
+			r.declarePattern(node.Pattern)
+		} else {
+			r.declare(node.Name)
+		}
+
+	case *ast.DirectFunctionStatement:
+		r.resolveFunction(&node.Function)
+
+	case *ast.ClassStatement:
+		r.resolveClass(node)
+
+	case *ast.BlockStatement:
+		r.beginBlock()
+		r.resolveStatements(node.Statements)
+		r.endBlock()
+
+	// Expressions
+	case *ast.Identifier:
+		r.resolveIdentifier(node)
+
+	case *ast.PrefixExpression:
+		r.resolve(node.Right)
+
+	case *ast.InfixExpression:
+		if ident, ok := node.Left.(*ast.Identifier); ok && node.Operator == "=" {
+			r.resolveTarget(ident)
+		} else {
+			r.resolve(node.Left)
+		}
+		r.resolve(node.Right)
+
+	case *ast.MatchExpression:
+		r.resolve(node.Subject)
+		for _, arm := range node.Arms {
+			r.beginBlock()
+			for _, pattern := range arm.Patterns {
+				// Each pattern binds its own variables, which the guard and body share.
+				// A name in more than one pattern gets the same slot in all of them
+				r.blocks[len(r.blocks)-1].declared = make(map[string]bool)
+				r.declarePattern(pattern)
+			}
+			r.beginBlock()
+			if arm.Guard != nil {
+				r.resolve(arm.Guard)
+			}
+			r.resolveStatements(arm.Body.Statements)
+			r.endBlock()
+			r.endBlock()
+		}
+
+	case *ast.NamedArgument:
+		r.resolve(node.Value)
+
+	case *ast.SpreadExpression:
+		r.resolve(node.Value)
+
+	case *ast.ConditionalExpression:
+		r.resolve(node.Condition)
+		r.resolve(node.Consequence)
+		r.resolve(node.Alternative)
+
+	case *ast.IfExpression:
+		r.resolve(node.Condition)
+		r.resolve(node.Consequence)
+		if node.Alternative != nil {
+			r.resolve(node.Alternative)
+		}
+
+	case *ast.ElseIfExpression:
+		for _, conditionAndBlockstatement := range node.ConditionAndBlockstatementList {
+			r.resolve(conditionAndBlockstatement.Condition)
+			r.resolve(conditionAndBlockstatement.Consequence)
+		}
+		if node.Alternative != nil {
+			r.resolve(node.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		r.resolveFunction(node)
+
+	case *ast.CallExpression:
+		r.resolve(node.Function)
+		r.resolveExpressions(node.Arguments)
+
+	case *ast.SpawnExpression:
+		r.resolve(node.Call)
+
+	case *ast.MacroLiteral:
+		if !r.macros {
+			r.addError("a macro can only be defined by a var at the top level")
+		}
+		macros, quote := r.macros, r.quote
+		r.macros, r.quote = false, true
+		r.resolveFunction(node.Function)
+		r.macros, r.quote = macros, quote
+
+	case *ast.QuoteExpression:
+		if !r.quote {
+			r.addError("quote is only allowed in macros")
+		}
+		// The quoted code is resolved where the macro is called, but what is
+		// unquoted runs in the macro
+		ast.Walk(node.Node, func(node ast.Node) bool {
+			if unquote, ok := node.(*ast.UnquoteExpression); ok {
+				r.resolve(unquote.Value)
+				return false
+			}
+			return true
+		})
+
+	case *ast.UnquoteExpression:
+		r.addError("unquote is only allowed in quote")
+
+	case *ast.AwaitExpression:
+		if !r.async {
+			r.addError("await is only allowed in async functions and at the top level")
+		}
+		r.resolve(node.Value)
+
+	case *ast.ArrayLiteral:
+		r.resolveExpressions(node.Elements)
+
+	case *ast.SetLiteral:
+		r.resolveExpressions(node.Elements)
+
+	case *ast.IndexExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Index)
+
+	case *ast.HashLiteral:
+		for _, key := range node.Keys {
+			r.resolve(key)
+			r.resolve(node.Pairs[key])
+		}
+
+	case *ast.IncrementForloopExpression:
+		r.resolve(node.From)
+		r.resolve(node.To)
+		node.Reuse = r.resolveForloop(node.LocalVar, node.Body, &node.Locals)
+
+	case *ast.ArrayForloopExpression:
+		r.resolve(node.ArrayName)
+		node.Reuse = r.resolveForloop(node.LocalVar, node.Body, &node.Locals)
+
+	case *ast.ComprehensionExpression:
+		r.resolve(node.Iterable)
+		node.Locals = []string{}
+		previous := r.beginScope(&node.Locals, r.scope)
+		for _, variable := range node.Variables {
+			r.declarePattern(variable)
+		}
+		if node.Condition != nil {
+			r.resolve(node.Condition)
+		}
+		if node.Key != nil {
+			r.resolve(node.Key)
+		}
+		r.resolve(node.Value)
+		r.endScope(previous)
+
+	case *ast.ObjectInitialization:
+		// Classes that aren't declared are loaded from their file when the program runs
+		r.bind(node.Name)
+		r.resolveExpressions(node.Arguments)
+
+	case *ast.CallObjectFunction:
+		r.resolveIdentifier(node.ObjectName)
+		r.resolveExpressions(node.Arguments)
+
+	case *ast.MemberExpression:
+		r.resolveIdentifier(node.Object)
+
+	case *ast.Increment:
+		r.resolveTarget(&node.Name)
+
+	case *ast.Decrement:
+		r.resolveTarget(&node.Name)
+	}
+}
+
+// declarePattern declares the variables a pattern binds
+func (r *resolver) declarePattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			r.declare(pattern)
+		}
+	case *ast.ArrayPattern:
+		for _, elem := range pattern.Elements {
+			r.declarePattern(elem)
+		}
+	case *ast.HashPattern:
+		for _, value := range pattern.Values {
+			r.declarePattern(value)
+		}
+	case *ast.TypePattern:
+		r.declarePattern(pattern.Name)
+	case *ast.RestPattern:
+		r.declarePattern(pattern.Name)
+	case *ast.LiteralPattern:
+		// the member of an enum refers to the enum
+		r.resolve(pattern.Value)
+	}
+}
+
+func (r *resolver) resolveExpressions(exps []ast.Expression) {
+	for _, e := range exps {
+		r.resolve(e)
+	}
+}
+
+func (r *resolver) resolveFunction(function *ast.FunctionLiteral) {
+	r.funcs = true
+	function.Locals = []string{}
+	fn := r.fn
+	r.fn = len(r.blocks)
+	previous := r.beginScope(&function.Locals, r.scope)
+	async := r.async
+	r.async = function.Async
+
+	// A default value can use the parameters before it
+	for i, param := range function.Parameters {
+		if i < len(function.Defaults) && function.Defaults[i] != nil {
+			r.resolve(function.Defaults[i])
+		}
+		r.declare(param)
+	}
+	// The body shares the block of the parameters
+	tail := r.tail
+	r.tail = true
+	r.resolveStatements(function.Body.Statements)
+	r.tail = tail
+
+	r.async = async
+	r.endScope(previous)
+	r.fn = fn
+}
+
+// resolveForloop resolves a forloop in a frame of its own. Returns true
+// when the body makes no functions, since only a function can keep the
+// frame of an iteration after it
+func (r *resolver) resolveForloop(localVar ast.Expression, body *ast.BlockStatement, locals *[]string) bool {
+	*locals = []string{}
+	previous := r.beginScope(locals, r.scope)
+	funcs := r.funcs
+	r.funcs = false
+
+	if ident, ok := localVar.(*ast.Identifier); ok {
+		r.declare(ident)
+	}
+	r.resolveStatements(body.Statements)
+
+	reuse := !r.funcs
+	r.funcs = funcs || r.funcs
+	r.endScope(previous)
+	return reuse
+}
+
+// resolveClass resolves a class in its own root frame, since the
+// class env doesn't enclose the env it's declared in
+func (r *resolver) resolveClass(class *ast.ClassStatement) {
+	class.Locals = []string{}
+	previous := r.beginScope(&class.Locals, nil)
+	async := r.async
+	r.async = false
+
+	for _, field := range class.Fields {
+		r.resolve(field.Value)
+		r.declare(field.Name)
+	}
+	for _, function := range class.Functions {
+		r.declare(function.Name)
+	}
+	if class.InitBody != nil {
+		r.declare(&ast.Identifier{Value: "Init"})
+	}
+
+	for _, function := range class.Functions {
+		r.resolveFunction(&function.Function)
+	}
+
+	if class.InitBody != nil {
+		classScope := r.scope
+		class.InitLocals = []string{}
+		fn := r.fn
+		r.fn = len(r.blocks)
+		r.beginScope(&class.InitLocals, classScope)
+
+		for _, param := range class.InitParams {
+			if param.Default != nil {
+				r.resolve(param.Default)
+			}
+			if param.IsThisParam {
+				r.resolveTarget(&ast.Identifier{Value: param.Parameter.Value, HasThisPrefix: true})
+			} else {
+				r.declare(param.Parameter)
+			}
+		}
+		r.resolveStatements(class.InitBody.Statements)
+
+		r.endScope(classScope)
+		r.fn = fn
+	}
+
+	r.async = async
+	r.endScope(previous)
+}
@@ -0,0 +1,256 @@
+package resolver
+
+import (
+	"Pron-Lang/ast"
+	"Pron-Lang/lexer"
+	"Pron-Lang/object"
+	"Pron-Lang/parser"
+	"reflect"
+	"testing"
+)
+
+func TestResolverErrors(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+	}{
+		{"var a = 1; a", []string{}},
+		{"print(len([1]))", []string{}},
+		{"foobar", []string{"identifier not found: foobar"}},
+		{"var a = 1; var a = 2", []string{"a is already declared in this scope"}},
+		{"func f(x, x) { x }", []string{"x is already declared in this scope"}},
+		{"var f = 1; func f() { 1 }", []string{"f is already declared in this scope"}},
+		{"if (true) { var a = 1 } else { var a = 2 }", []string{}},
+		{"x = 5", []string{"x is not defined"}},
+		{"x++", []string{"x is not defined"}},
+		{"func a() { b() } func b() { a() }", []string{}},
+		{"func f() { y } var y = 1", []string{}},
+		{"func f() { y = 2 } var y = 1", []string{}},
+		{"func f() { y } if (true) { var y = 1 }", []string{"identifier not found: y"}},
+		{"func f() { y }", []string{"identifier not found: y"}},
+		{"func f() { y = 2 }", []string{"y is not defined"}},
+		{"y; var y = 1", []string{"identifier not found: y"}},
+		{"var f = func(n) { if (n > 0) { f(n - 1) } }", []string{}},
+		{"var isEven = func(n) { isOdd(n - 1) }; var isOdd = func(n) { isEven(n - 1) }", []string{}},
+		{"func f() { func g() { y } var y = 1 } y", []string{"identifier not found: y"}},
+		{"for (i from 0 to 5) { var i = 2 }", []string{"i is already declared in this scope"}},
+		{"var g = 1; class A { func F() { return g } }", []string{"identifier not found: g"}},
+		{"class A { var n; func F() { return this.m } }", []string{"identifier not found: 'm'. Try to remove 'this.'"}},
+		{"var p = new Unknown()", []string{}},
+		{"match (1) { [a, a] => a }", []string{"a is already declared in this scope"}},
+		{"var a = 1; var [b, ...a] = [1]", []string{"a is already declared in this scope"}},
+		{"func f([a], a) { a }", []string{"a is already declared in this scope"}},
+		{"func f(a = b, b = 1) { a }", []string{"identifier not found: b"}},
+		{"var b = 1; func f(a = b, b = 2) { a }", []string{}},
+		{"func f(a, ...a) { a }", []string{"a is already declared in this scope"}},
+		{"print(x: y)", []string{"identifier not found: y"}},
+		{"print(...y)", []string{"identifier not found: y"}},
+		{"var [a, _] = [1, 2]; var [b, _] = [1, 2]; a + b", []string{}},
+		{"match (1) { [a, 1], [1, a] => a, _ => 0 }", []string{}},
+		{"match (1) { n if m => n }", []string{"identifier not found: m"}},
+		{"[x for x in [1]]; x", []string{"identifier not found: x"}},
+		{"var xs = [1]; [y for x in xs]", []string{"identifier not found: y"}},
+		{"[k for k, k in {}]", []string{"k is already declared in this scope"}},
+		{"[x for x in x]", []string{"identifier not found: x"}},
+		{"func f() { return Status.Done } enum Status { Done }", []string{}},
+		{"Status.Done", []string{"identifier not found: Status"}},
+		{"match (1) { Status.Done => 1 }", []string{"identifier not found: Status"}},
+		{"enum Status { Done } var Status = 1", []string{"Status is already declared in this scope"}},
+		{"if (true) { var a = 1 } a", []string{"identifier not found: a"}},
+		{"var a = 1; if (true) { var a = 2; a } a", []string{}},
+		{"if (true) { var a = 1; var a = 2 }", []string{"a is already declared in this scope"}},
+		{"match (1) { n => n } n", []string{"identifier not found: n"}},
+		{"for (i from 0 to 2) { var x = i } x", []string{"identifier not found: x"}},
+		{"await sleep(1)", []string{}},
+		{"async func f() { await sleep(1) }", []string{}},
+		{"var f = async func() { return await sleep(1) }", []string{}},
+		{"func f() { await sleep(1) }", []string{"await is only allowed in async functions and at the top level"}},
+		{"async func f() { func g() { await sleep(1) } }", []string{"await is only allowed in async functions and at the top level"}},
+		{"class A { async func F() { await sleep(1) } func G() { await sleep(1) } }", []string{"await is only allowed in async functions and at the top level"}},
+		{"var m = macro(x) { x }", []string{"a macro can only be defined by a var at the top level"}},
+		{"quote(1)", []string{"quote is only allowed in macros"}},
+		{"func f() { quote(1) }", []string{"quote is only allowed in macros"}},
+		{"unquote(1)", []string{"unquote is only allowed in quote"}},
+		{"var a = 1; func f() { quote(unquote(b)) }", []string{"quote is only allowed in macros", "identifier not found: b"}},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		errors := Resolve(program, object.NewEnvironment())
+
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. expected=%v, got=%v",
+				tt.input, tt.expectedErrors, errors)
+			continue
+		}
+
+		for i, msg := range tt.expectedErrors {
+			if errors[i] != msg {
+				t.Errorf("wrong error message. expected=%q, got=%q", msg, errors[i])
+			}
+		}
+	}
+}
+
+func TestResolverSlots(t *testing.T) {
+	input := `
+	var a = 1
+	var f = func(x) {
+		var y = x
+		return func() { a + y }
+	}`
+
+	program := parse(input)
+	if errors := Resolve(program, object.NewEnvironment()); len(errors) != 0 {
+		t.Fatalf("resolver has errors: %v", errors)
+	}
+
+	outer := program.Statements[1].(*ast.VarStatement).Value.(*ast.FunctionLiteral)
+	if len(outer.Locals) != 2 || outer.Locals[0] != "x" || outer.Locals[1] != "y" {
+		t.Fatalf("outer.Locals is not [x y]. got=%v", outer.Locals)
+	}
+
+	ret := outer.Body.Statements[1].(*ast.ReturnStatement)
+	inner := ret.ReturnValue.(*ast.FunctionLiteral)
+	sum := inner.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+
+	tests := []struct {
+		ident *ast.Identifier
+		depth int
+		slot  int
+	}{
+		{sum.Left.(*ast.Identifier), 2, 0},
+		{sum.Right.(*ast.Identifier), 1, 1},
+	}
+
+	for _, tt := range tests {
+		if !tt.ident.Resolved {
+			t.Errorf("%s is not resolved", tt.ident.Value)
+			continue
+		}
+		if tt.ident.Depth != tt.depth || tt.ident.Slot != tt.slot {
+			t.Errorf("%s has wrong position. expected=(%d, %d), got=(%d, %d)",
+				tt.ident.Value, tt.depth, tt.slot, tt.ident.Depth, tt.ident.Slot)
+		}
+	}
+}
+
+func TestResolverKeepsGlobalsOfEnvironment(t *testing.T) {
+	env := object.NewEnvironment()
+
+	first := parse("var a = 5")
+	if errors := Resolve(first, env); len(errors) != 0 {
+		t.Fatalf("resolver has errors: %v", errors)
+	}
+	name := first.Statements[0].(*ast.VarStatement).Name
+	env.Define(name.Slot, name.Value, object.NewInteger(5))
+
+	second := parse("a + 1")
+	if errors := Resolve(second, env); len(errors) != 0 {
+		t.Fatalf("resolver has errors: %v", errors)
+	}
+	ident := second.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression).Left.(*ast.Identifier)
+	if !ident.Resolved || ident.Depth != 0 || ident.Slot != name.Slot {
+		t.Fatalf("a isn't resolved to its global slot. got=(%d, %d)", ident.Depth, ident.Slot)
+	}
+
+	third := parse("var a = 6")
+	errors := Resolve(third, env)
+	if len(errors) != 1 || errors[0] != "a is already declared in this scope" {
+		t.Fatalf("redeclaring a global gave wrong errors. got=%v", errors)
+	}
+}
+
+func TestResolverMarksTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"func f(n) { return f(n) }", true},
+		{"func f(n) { if (n) { return f(n) } }", true},
+		{"func f(n) { match (n) { _ => { return f(n) } } }", true},
+		{"func f(n) { return f(n) + 1 }", false},
+		{"func f(n) { for (i from 0 to 1) { return f(n) } }", false},
+		{"func f(n) { var x = if (n) { return f(n) } }", false},
+		{"class A { Init(n) { return f(n) } } func f(n) { }", false},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		Resolve(program, object.NewEnvironment())
+
+		ret := findReturn(reflect.ValueOf(program))
+		if ret == nil {
+			t.Fatalf("no return statement in %q", tt.input)
+		}
+		if ret.Tail != tt.expected {
+			t.Errorf("wrong Tail for %q. expected=%t, got=%t", tt.input, tt.expected, ret.Tail)
+		}
+	}
+}
+
+func TestResolverMarksReusableForloops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []bool
+	}{
+		{"for (i from 0 to 3) { var y = i }", []bool{true}},
+		{"var xs = [1, 2]; for (x in xs) { print(x) }", []bool{true}},
+		{"for (i from 0 to 3) { var f = func() { return i } }", []bool{false}},
+		{"for (i from 0 to 3) { for (j from 0 to 3) { func f() { return j } } }", []bool{false, false}},
+		{"for (i from 0 to 3) { for (j from 0 to 3) { } var f = func() { } }", []bool{false, true}},
+		{"var f = func() { for (i from 0 to 3) { } }", []bool{true}},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		Resolve(program, object.NewEnvironment())
+
+		reuse := []bool{}
+		ast.Walk(program, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.IncrementForloopExpression:
+				reuse = append(reuse, node.Reuse)
+			case *ast.ArrayForloopExpression:
+				reuse = append(reuse, node.Reuse)
+			}
+			return true
+		})
+		if !reflect.DeepEqual(reuse, tt.expected) {
+			t.Errorf("wrong Reuse for %q. expected=%v, got=%v", tt.input, tt.expected, reuse)
+		}
+	}
+}
+
+// findReturn finds the first return statement in the tree of nodes v
+func findReturn(v reflect.Value) *ast.ReturnStatement {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if ret, ok := v.Interface().(*ast.ReturnStatement); ok {
+			return ret
+		}
+		return findReturn(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if ret := findReturn(v.Field(i)); ret != nil {
+				return ret
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if ret := findReturn(v.Index(i)); ret != nil {
+				return ret
+			}
+		}
+	}
+	return nil
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
@@ -1,10 +1,23 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // where the token starts in the source
+}
+
+// Position is a line and column in the source, both counted from 1
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -12,10 +25,11 @@ const (
 	EOF     = "EOF"     // End of File
 
 	// Identifiers + literals
-	IDENT  = "IDENT"  //add, foobar, x, y, ...
-	INT    = "INT"    // 42
-	STRING = "STRING" // "Hello World!"
-	REAL   = "REAL"   // 42.0, 4.5, 3.15, ...
+	IDENT   = "IDENT"   //add, foobar, x, y, ...
+	INT     = "INT"     // 42
+	STRING  = "STRING"  // "Hello World!"
+	REAL    = "REAL"    // 42.0, 4.5, 3.15, ...
+	DECIMAL = "DECIMAL" // 1.10d, 5d
 
 	// Operators
 	ASSIGN    = "="
@@ -25,6 +39,8 @@ const (
 	ASTERISK  = "*"
 	SLASH     = "/"
 	MODULO    = "%"
+	POWER     = "**"
+	FLOOR_DIV = "//"
 	EQ        = "=="
 	NOT_EQ    = "!="
 	INCREMENT = "++"
@@ -33,11 +49,29 @@ const (
 	LT = "<"
 	GT = ">"
 
+	ARROW = "=>"
+
+	QUESTION          = "?"
+	COALESCE          = "??"
+	OPTIONAL_DOT      = "?."
+	OPTIONAL_LBRACKET = "?["
+
+	// Bitwise operators
+	BIT_AND = "&"
+	BIT_OR  = "|"
+	BIT_XOR = "^"
+	BIT_NOT = "~"
+	LSHIFT  = "<<"
+	RSHIFT  = ">>"
+
+	PIPELINE = "|>"
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
 	DOT       = "."
+	ELLIPSIS  = "..."
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -46,9 +80,12 @@ const (
 	LBRACKET = "["
 	RBRACKET = "]"
 
+	HASHBRACE = "#{" // Starts a set literal
+
 	// Keywords
 	FUNCTION = "FUNCTION"
 	VAR      = "VAR"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
@@ -63,6 +100,14 @@ const (
 	INIT     = "INIT"
 	THIS     = "THIS"
 	NEW      = "NEW"
+	MATCH    = "MATCH"
+	ENUM     = "ENUM"
+	SPAWN    = "SPAWN"
+	ASYNC    = "ASYNC"
+	AWAIT    = "AWAIT"
+	MACRO    = "MACRO"
+	QUOTE    = "QUOTE"
+	UNQUOTE  = "UNQUOTE"
 
 	// Comments
 	STARTBLOCKCOMMENT = "/*"
@@ -70,22 +115,31 @@ const (
 )
 
 var keywords = map[string]TokenType{
-	"func":   FUNCTION,
-	"var":    VAR,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"elif":   ELIF,
-	"return": RETURN,
-	"for":    FOR,
-	"from":   FROM,
-	"to":     TO,
-	"in":     IN,
-	"class":  CLASS,
-	"Init":   INIT,
-	"this":   THIS,
-	"new":    NEW,
+	"func":    FUNCTION,
+	"var":     VAR,
+	"const":   CONST,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"elif":    ELIF,
+	"return":  RETURN,
+	"for":     FOR,
+	"from":    FROM,
+	"to":      TO,
+	"in":      IN,
+	"class":   CLASS,
+	"Init":    INIT,
+	"this":    THIS,
+	"new":     NEW,
+	"match":   MATCH,
+	"enum":    ENUM,
+	"spawn":   SPAWN,
+	"async":   ASYNC,
+	"await":   AWAIT,
+	"macro":   MACRO,
+	"quote":   QUOTE,
+	"unquote": UNQUOTE,
 }
 
 // Returns the TokenType that matches the ident given as argument.
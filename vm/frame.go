@@ -0,0 +1,94 @@
+package vm
+
+import (
+	"Pron-Lang/code"
+	"Pron-Lang/object"
+)
+
+// loop is a forloop that is running in a frame
+type loop struct {
+	base   int // position of the iterator on the stack
+	env    *object.Environment
+	outer  *object.Environment // the env of the frame before the loop began
+	locals []string
+	reuse  bool // the iterations share env, since the body makes no functions
+}
+
+// iterate gives the loop a fresh env for its next iteration,
+// so closures made in one iteration keep their own variables
+func (f *Frame) iterate() *loop {
+	l := &f.loops[len(f.loops)-1]
+	if !l.reuse {
+		l.env = object.NewEnclosedFrame(l.outer, l.locals)
+	}
+	f.env = l.env
+	return l
+}
+
+type Frame struct {
+	fn          *object.CompiledFunction
+	ip          int
+	basePointer int
+	env         *object.Environment
+	loops       []loop
+
+	// instance is returned instead of the result when the frame is an Init
+	instance *object.ClassInstance
+}
+
+func NewFrame(fn *object.CompiledFunction, env *object.Environment, basePointer int) *Frame {
+	return &Frame{fn: fn, ip: -1, basePointer: basePointer, env: env}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.fn.Instructions
+}
+
+// iterator gives a forloop its values. It lives on the stack while the loop runs
+type iterator interface {
+	object.Object
+	next() (object.Object, bool)
+}
+
+// rangeIterator counts from 'from' towards 'to', without reaching 'to'
+type rangeIterator struct {
+	current int64
+	to      int64
+	step    int64
+}
+
+func newRangeIterator(from, to int64) *rangeIterator {
+	if from < to {
+		return &rangeIterator{current: from, to: to, step: 1}
+	}
+	return &rangeIterator{current: from, to: to, step: -1}
+}
+
+func (ri *rangeIterator) Type() object.ObjectType { return "ITERATOR" }
+func (ri *rangeIterator) Inspect() string         { return "range iterator" }
+
+func (ri *rangeIterator) next() (object.Object, bool) {
+	if ri.current == ri.to {
+		return nil, false
+	}
+	value := ri.current
+	ri.current += ri.step
+	return object.NewInteger(value), true
+}
+
+type arrayIterator struct {
+	elements []object.Object
+	index    int
+}
+
+func (ai *arrayIterator) Type() object.ObjectType { return "ITERATOR" }
+func (ai *arrayIterator) Inspect() string         { return "array iterator" }
+
+func (ai *arrayIterator) next() (object.Object, bool) {
+	if ai.index >= len(ai.elements) {
+		return nil, false
+	}
+	value := ai.elements[ai.index]
+	ai.index++
+	return value, true
+}
@@ -0,0 +1,1111 @@
+package vm
+
+import (
+	"Pron-Lang/code"
+	"Pron-Lang/compiler"
+	"Pron-Lang/loader"
+	"Pron-Lang/object"
+	"fmt"
+	"math"
+)
+
+// StackSize is the size the stack starts with. It grows when calls nest deeper
+const StackSize = 1 << 16
+
+// VM runs bytecode with the same semantics as the evaluator.
+// Variables live in object.Environment frames like they do in the evaluator,
+// so closures, classes and the REPL work the same way in both.
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // Always points to the next free slot. Top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	arithmetic object.Arithmetic // How numbers are computed, from the env of the program
+	task       *object.Task      // The task the vm runs, from the env of the program or spawn
+}
+
+// New creates a vm that runs the program in env
+func New(bytecode *compiler.Bytecode, env *object.Environment) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+
+	frames := []*Frame{NewFrame(mainFn, env, 0)}
+
+	return &VM{
+		constants:   checkConstants(bytecode.Constants, env.Arithmetic()),
+		stack:       make([]object.Object, StackSize),
+		sp:          0,
+		frames:      frames,
+		framesIndex: 1,
+		arithmetic:  env.Arithmetic(),
+		task:        env.Task(),
+	}
+}
+
+// spawn creates a vm that runs task with the constants of vm
+func (vm *VM) spawn(task *object.Task) *VM {
+	return &VM{
+		constants:  vm.constants,
+		stack:      make([]object.Object, 1<<8),
+		arithmetic: vm.arithmetic,
+		task:       task,
+	}
+}
+
+// checkConstants replaces the big integer literals with errors when overflow
+// is an error, so the program stops when it gets to one, like in the evaluator
+func checkConstants(constants []object.Object, arithmetic object.Arithmetic) []object.Object {
+	if arithmetic.Overflow != object.ErrorOnOverflow {
+		return constants
+	}
+
+	checked := append([]object.Object{}, constants...)
+	for i, constant := range checked {
+		if big, ok := constant.(*object.BigInteger); ok {
+			checked[i] = newError("integer overflow: %s doesn't fit in 64 bits", big.Inspect())
+		}
+	}
+	return checked
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) *object.Error {
+	// The main frame doesn't count as a call
+	if vm.framesIndex > object.MaxDepth {
+		return object.RecursionError()
+	}
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Run runs the program, and then its event loop until no timer or async
+// function is left. It returns the result of the program, or the error that
+// stopped it or a timer
+func (vm *VM) Run() object.Object {
+	result := vm.run(0)
+	if isError(result) {
+		return result
+	}
+	if err := vm.task.Loop.Run(vm.task, vm.Call); err != nil {
+		return err
+	}
+	return result
+}
+
+// Call runs fn with args and returns its result. It lets the operators and
+// builtins the vm shares with the evaluator call functions, like Equals
+func (vm *VM) Call(fn object.Object, args []object.Object) object.Object {
+	switch fn := fn.(type) {
+	case *object.Closure:
+		if fn.Fn.Async {
+			return vm.callAsync(fn, &object.Arguments{Positional: args})
+		}
+		stopAt := vm.framesIndex
+		if err := vm.push(fn); err != nil {
+			return err
+		}
+		for _, arg := range args {
+			if err := vm.push(arg); err != nil {
+				return err
+			}
+		}
+		if err := vm.callClosure(fn, len(args)); err != nil {
+			return err
+		}
+		return vm.run(stopAt)
+
+	case *object.Builtin:
+		return fn.Call(vm.task, vm.Call, args...)
+
+	default:
+		return newError("not a function %s", fn.Type())
+	}
+}
+
+// run runs until the frame at index stopAt returns, and returns its result
+func (vm *VM) run(stopAt int) object.Object {
+	for {
+		frame := vm.currentFrame()
+		frame.ip++
+		ins := frame.Instructions()
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+
+		var err *object.Error
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpNull:
+			err = vm.push(object.NULL)
+
+		case code.OpNil:
+			err = vm.push(nil)
+
+		case code.OpTrue:
+			err = vm.push(object.TRUE)
+
+		case code.OpFalse:
+			err = vm.push(object.FALSE)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+			// Two integers are worked out in place
+			if left, ok := vm.stack[vm.sp-2].(*object.Integer); ok {
+				if right, ok := vm.stack[vm.sp-1].(*object.Integer); ok {
+					if result := integerOperation(op, left.Value, right.Value); result != nil {
+						vm.sp--
+						vm.stack[vm.sp-1] = result
+						continue
+					}
+				}
+			}
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.push(object.Infix(binaryOperators[op], left, right, vm.Call, vm.arithmetic))
+
+		case code.OpInfix:
+			operator := vm.name(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.push(object.Infix(operator, left, right, vm.Call, vm.arithmetic))
+
+		case code.OpMinus:
+			err = vm.push(object.Prefix("-", vm.pop(), vm.arithmetic))
+
+		case code.OpBang:
+			err = vm.push(object.Prefix("!", vm.pop(), vm.arithmetic))
+
+		case code.OpPrefix:
+			operator := vm.name(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			err = vm.push(object.Prefix(operator, vm.pop(), vm.arithmetic))
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.push(object.Index(left, index, vm.Call))
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNull:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if vm.stack[vm.sp-1] == object.NULL {
+				frame.ip = pos - 1
+			}
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			condition := vm.pop()
+			switch condition {
+			case object.TRUE:
+			case object.FALSE:
+				frame.ip = pos - 1
+			default:
+				if isError(condition) {
+					return condition
+				}
+				if !object.IsTruthy(condition) {
+					frame.ip = pos - 1
+				}
+			}
+
+		case code.OpRaise:
+			return vm.pop()
+
+		case code.OpGetVar:
+			depth := int(code.ReadUint8(ins[ip+1:]))
+			slot := int(code.ReadUint16(ins[ip+2:]))
+			frame.ip += 6
+
+			val, ok := frame.env.GetAt(depth, slot)
+			if !ok {
+				name := vm.name(code.ReadUint16(ins[ip+4:]))
+				val = identifierNotFound(name, code.ReadUint8(ins[ip+6:]) == 1)
+			}
+			err = vm.push(val)
+
+		case code.OpSetVar:
+			depth := int(code.ReadUint8(ins[ip+1:]))
+			slot := int(code.ReadUint16(ins[ip+2:]))
+			frame.ip += 6
+
+			val := vm.stack[vm.sp-1]
+			if isError(val) {
+				return val
+			}
+			// The name is only needed for the errors
+			if mutability := frame.env.MutabilityAt(depth, slot); mutability != object.Mutable {
+				return object.ReadOnlyError(vm.name(code.ReadUint16(ins[ip+4:])), mutability)
+			}
+			if vm.task.Concurrent() && frame.env.RaceAt(depth, slot, vm.task) {
+				return object.RaceError(vm.name(code.ReadUint16(ins[ip+4:])))
+			}
+			if !frame.env.Assign(depth, slot, val) {
+				return notDefined(vm.name(code.ReadUint16(ins[ip+4:])), code.ReadUint8(ins[ip+6:]) == 1)
+			}
+
+		case code.OpDefine:
+			slot := int(code.ReadUint16(ins[ip+1:]))
+			name := vm.name(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+
+			val := vm.pop()
+			if isError(val) {
+				return val
+			}
+			frame.env.Define(slot, name, val)
+
+		case code.OpDefineConstant:
+			slot := int(code.ReadUint16(ins[ip+1:]))
+			name := vm.name(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+
+			val := vm.pop()
+			if isError(val) {
+				return val
+			}
+			frame.env.DefineConstant(slot, name, val)
+
+		case code.OpIncrement, code.OpDecrement:
+			depth := int(code.ReadUint8(ins[ip+1:]))
+			slot := int(code.ReadUint16(ins[ip+2:]))
+			name := vm.name(code.ReadUint16(ins[ip+4:]))
+			frame.ip += 5
+
+			var factor int64 = 1
+			if op == code.OpDecrement {
+				factor = -1
+			}
+			err = vm.executeIncrement(frame.env, depth, slot, name, factor)
+
+		case code.OpGetName:
+			name := vm.name(code.ReadUint16(ins[ip+1:]))
+			hasThisPrefix := code.ReadUint8(ins[ip+3:]) == 1
+			frame.ip += 3
+
+			var val object.Object
+			var ok bool
+			if hasThisPrefix {
+				val, ok = frame.env.GetOuterMost(name)
+			} else {
+				val, ok = frame.env.Get(name)
+			}
+			if !ok {
+				val = identifierNotFound(name, hasThisPrefix)
+			}
+			err = vm.push(val)
+
+		case code.OpSetName:
+			name := vm.name(code.ReadUint16(ins[ip+1:]))
+			hasThisPrefix := code.ReadUint8(ins[ip+3:]) == 1
+			frame.ip += 3
+
+			val := vm.stack[vm.sp-1]
+			if isError(val) {
+				return val
+			}
+			mutability := frame.env.Mutability(name)
+			if hasThisPrefix {
+				mutability = frame.env.MutabilityOuterMost(name)
+			}
+			if readOnlyErr := object.ReadOnlyError(name, mutability); readOnlyErr != nil {
+				return readOnlyErr
+			}
+			var ok bool
+			if hasThisPrefix {
+				ok = frame.env.UpdateOuterMost(name, val)
+			} else {
+				ok = frame.env.Update(name, val)
+			}
+			if !ok {
+				return notDefined(name, hasThisPrefix)
+			}
+
+		case code.OpDefineName:
+			name := vm.name(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			val := vm.pop()
+			if isError(val) {
+				return val
+			}
+			frame.env.Set(name, val)
+
+		case code.OpDefineConstantName:
+			name := vm.name(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			val := vm.pop()
+			if isError(val) {
+				return val
+			}
+			frame.env.SetConstant(name, val)
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			array := object.NewArray(vm.stack[vm.sp-numElements : vm.sp])
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(array)
+
+		case code.OpHash:
+			numPairs := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			hash, hashErr := vm.buildHash(vm.sp-2*numPairs, vm.sp)
+			if hashErr != nil {
+				return hashErr
+			}
+			vm.sp = vm.sp - 2*numPairs
+
+			err = vm.push(hash)
+
+		case code.OpSet:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			// The elements stay on the stack while Hash methods run
+			set := object.BuildSet(vm.stack[vm.sp-numElements:vm.sp], vm.Call)
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(set)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			fn := vm.constants[constIndex].(*object.CompiledFunction)
+			err = vm.push(&object.Closure{Fn: fn, Env: frame.env})
+
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			err = vm.executeCall(numArgs)
+
+		case code.OpSpawn:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			err = vm.executeSpawn(numArgs)
+
+		case code.OpAwait:
+			val := vm.pop()
+			result, ok := vm.task.Await(val, vm.Call)
+			if !ok {
+				return object.AwaitError()
+			}
+			err = vm.push(result)
+
+		case code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			err = vm.executeTailCall(numArgs)
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			returned := vm.popFrame()
+			if returned.instance != nil {
+				returnValue = returned.instance
+			}
+			if vm.framesIndex == 0 {
+				return returnValue
+			}
+
+			vm.sp = returned.basePointer
+			if vm.framesIndex == stopAt {
+				return returnValue
+			}
+			err = vm.push(returnValue)
+
+		case code.OpRangeFrom:
+			from := vm.stack[vm.sp-1]
+			if isError(from) {
+				return from
+			}
+			if _, ok := from.(*object.Integer); !ok {
+				return newError("'from' expression in forloop was not integer. got=%s", typeName(from))
+			}
+
+		case code.OpRangeTo:
+			to := vm.pop()
+			if isError(to) {
+				return to
+			}
+			if _, ok := to.(*object.Integer); !ok {
+				return newError("'to' expression in forloop was not integer. got=%s", typeName(to))
+			}
+			from := vm.pop()
+
+			err = vm.push(newRangeIterator(from.(*object.Integer).Value, to.(*object.Integer).Value))
+
+		case code.OpIterStart:
+			array := vm.pop()
+			if isError(array) {
+				return array
+			}
+			elements, ok := object.LoopElements(array)
+			if !ok {
+				return newError("'in' expression in forloop was not array, hash or set. got=%s", typeName(array))
+			}
+
+			err = vm.push(&arrayIterator{elements: elements})
+
+		case code.OpLoopBegin:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			locals := vm.constants[constIndex].(*compiler.Locals)
+			env := object.NewEnclosedFrame(frame.env, locals.Names)
+			frame.loops = append(frame.loops, loop{base: vm.sp - 1, env: env, outer: frame.env, locals: locals.Names, reuse: locals.Reuse})
+			frame.env = env
+
+			// The result of a loop that doesn't run is null
+			err = vm.push(object.NULL)
+
+		case code.OpLoopNext:
+			end := int(code.ReadUint16(ins[ip+1:]))
+			slot := int(code.ReadUint16(ins[ip+3:]))
+			name := vm.name(code.ReadUint16(ins[ip+5:]))
+			frame.ip += 6
+
+			l := frame.loops[len(frame.loops)-1]
+			value, ok := vm.stack[l.base].(iterator).next()
+			if !ok {
+				frame.ip = end - 1
+				continue
+			}
+			env := frame.iterate().env
+			if slot == compiler.UnresolvedSlot {
+				env.Set(name, value)
+			} else {
+				env.Define(slot, name, value)
+			}
+
+		case code.OpLoopBreak:
+			end := int(code.ReadUint16(ins[ip+1:]))
+
+			value := vm.pop()
+			l := frame.loops[len(frame.loops)-1]
+			vm.sp = l.base + 1
+			frame.env = l.env
+			frame.ip = end - 1
+
+			err = vm.push(value)
+
+		case code.OpLoopEnd:
+			result := vm.pop()
+			l := frame.loops[len(frame.loops)-1]
+			frame.loops = frame.loops[:len(frame.loops)-1]
+			vm.sp = l.base // removes the iterator
+			frame.env = l.outer
+
+			err = vm.push(result)
+
+		case code.OpClass:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			builder := vm.constants[constIndex].(*object.CompiledFunction)
+			classEnv := object.NewEnclosedFrame(nil, builder.Locals)
+			classEnv.SetTask(vm.task)
+			err = vm.pushFrame(NewFrame(builder, classEnv, vm.sp))
+
+		case code.OpMakeClass:
+			name := vm.name(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			err = vm.push(&object.ClassInstance{Name: name, Env: frame.env})
+
+		case code.OpLoadClass:
+			depth := int(code.ReadUint8(ins[ip+1:]))
+			slot := int(code.ReadUint16(ins[ip+2:]))
+			name := vm.name(code.ReadUint16(ins[ip+4:]))
+			resolved := code.ReadUint8(ins[ip+6:]) == 1
+			frame.ip += 6
+
+			err = vm.loadClass(frame.env, depth, slot, name, resolved)
+
+		case code.OpNew:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			name := vm.name(code.ReadUint16(ins[ip+2:]))
+			frame.ip += 3
+
+			err = vm.executeNew(numArgs, name)
+
+		case code.OpGetMethod:
+			method := vm.name(code.ReadUint16(ins[ip+1:]))
+			objectName := vm.name(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+
+			err = vm.executeGetMethod(method, objectName)
+
+		case code.OpGetMember:
+			name := vm.name(code.ReadUint16(ins[ip+1:]))
+			objectName := vm.name(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+
+			err = vm.push(object.GetMember(vm.pop(), objectName, name))
+
+		case code.OpMatch:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			patterns := vm.constants[constIndex].(*compiler.Patterns)
+			matched, matchErr := object.MatchPatterns(patterns.Patterns, vm.stack[vm.sp-1], frame.env, vm.Call)
+			if matchErr != nil {
+				return matchErr
+			}
+			err = vm.push(object.NewBoolean(matched))
+
+		case code.OpNoMatch:
+			return object.NoMatchError(vm.pop())
+
+		case code.OpArguments:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			exps := vm.constants[constIndex].(*compiler.CallArguments).Arguments
+			values := make([]object.Object, len(exps))
+			copy(values, vm.stack[vm.sp-len(exps):vm.sp])
+			vm.sp -= len(exps)
+
+			args, argsErr := object.CollectArguments(exps, values)
+			if argsErr != nil {
+				return argsErr
+			}
+			err = vm.push(args)
+
+		case code.OpDestructure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			patterns := vm.constants[constIndex].(*compiler.Patterns)
+			if destructureErr := object.Destructure(patterns.Patterns[0], vm.pop(), frame.env, vm.Call); destructureErr != nil {
+				return destructureErr
+			}
+
+		case code.OpIterRows:
+			variables := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			iterable := vm.pop()
+			if isError(iterable) {
+				return iterable
+			}
+			rows, rowsErr := object.ComprehensionRows(iterable, variables)
+			if rowsErr != nil {
+				return rowsErr
+			}
+
+			err = vm.push(&arrayIterator{elements: rows})
+
+		case code.OpLoopValue:
+			end := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			l := frame.loops[len(frame.loops)-1]
+			value, ok := vm.stack[l.base].(iterator).next()
+			if !ok {
+				frame.ip = end - 1
+				continue
+			}
+			frame.iterate()
+
+			err = vm.push(value)
+
+		case code.OpCollect:
+			collected := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			l := frame.loops[len(frame.loops)-1]
+			value := vm.pop()
+			if collected == 1 {
+				array := vm.stack[l.base+1].(*object.Array)
+				vm.stack[l.base+1] = &object.Array{Elements: array.Elements.Push(value)}
+				continue
+			}
+
+			key, keyErr := object.AsKey(vm.pop(), vm.Call)
+			if keyErr != nil {
+				return keyErr
+			}
+			hash := vm.stack[l.base+1].(*object.Hash)
+			hash, keyErr = hash.Set(key, value)
+			if keyErr != nil {
+				return keyErr
+			}
+			vm.stack[l.base+1] = hash
+
+		default:
+			return newError("unknown opcode %d", op)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// push puts obj on the stack. Errors stop the program, like they do in the evaluator
+func (vm *VM) push(obj object.Object) *object.Error {
+	if err, ok := obj.(*object.Error); ok {
+		return err
+	}
+	if vm.sp == len(vm.stack) {
+		vm.stack = append(vm.stack, make([]object.Object, len(vm.stack))...)
+	}
+
+	vm.stack[vm.sp] = obj
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	obj := vm.stack[vm.sp-1]
+	vm.sp--
+	return obj
+}
+
+func (vm *VM) name(constIndex uint16) string {
+	return vm.constants[constIndex].(*object.String).Value
+}
+
+// integerOperation works out a binary operator on two integers natively.
+// It returns nil when the result doesn't fit in 64 bits, or is an error
+// like a division by zero, which object.Infix then handles
+func integerOperation(op code.Opcode, left, right int64) object.Object {
+	switch op {
+	case code.OpAdd:
+		if sum, ok := object.AddInt64(left, right); ok {
+			return object.NewInteger(sum)
+		}
+	case code.OpSub:
+		if difference, ok := object.SubInt64(left, right); ok {
+			return object.NewInteger(difference)
+		}
+	case code.OpMul:
+		if product, ok := object.MulInt64(left, right); ok {
+			return object.NewInteger(product)
+		}
+	case code.OpDiv:
+		if right != 0 && (left != math.MinInt64 || right != -1) {
+			return object.NewInteger(left / right)
+		}
+	case code.OpMod:
+		if right != 0 {
+			return object.NewInteger(left % right)
+		}
+	case code.OpEqual:
+		return object.NewBoolean(left == right)
+	case code.OpNotEqual:
+		return object.NewBoolean(left != right)
+	case code.OpGreaterThan:
+		return object.NewBoolean(left > right)
+	case code.OpLessThan:
+		return object.NewBoolean(left < right)
+	}
+	return nil
+}
+
+var binaryOperators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpMod:         "%",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+}
+
+func (vm *VM) executeIncrement(env *object.Environment, depth, slot int, name string, factor int64) *object.Error {
+	integerObj, ok := env.GetAt(depth, slot)
+	if !ok {
+		return newError("%s is not defined", name)
+	}
+
+	integer, ok := object.AddToInteger(integerObj, factor, vm.arithmetic)
+	if !ok {
+		return newError("%s is not an integer. got=%s", name, integerObj.Type())
+	}
+	if err, ok := integer.(*object.Error); ok {
+		return err
+	}
+	if err := object.ReadOnlyError(name, env.MutabilityAt(depth, slot)); err != nil {
+		return err
+	}
+	if vm.task.Concurrent() && env.RaceAt(depth, slot, vm.task) {
+		return object.RaceError(name)
+	}
+	env.Assign(depth, slot, integer)
+	return vm.push(integer)
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, *object.Error) {
+	hash := object.NewHash()
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, err := object.AsKey(key, vm.Call)
+		if err != nil {
+			return nil, err
+		}
+
+		hash, err = hash.Set(hashKey, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return hash, nil
+}
+
+func (vm *VM) executeCall(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		if callee.Fn.ThisParams != nil {
+			return newError("not a function %s", callee.Type())
+		}
+		if callee.Fn.Async {
+			args := vm.arguments(numArgs)
+			vm.sp = vm.sp - numArgs - 1
+			return vm.push(vm.callAsync(callee, args))
+		}
+		return vm.callClosure(callee, numArgs)
+
+	case *object.Builtin:
+		args := vm.arguments(numArgs)
+		if len(args.Names) != 0 {
+			return newError("builtin functions take no named arguments")
+		}
+
+		result := callee.Call(vm.task, vm.Call, args.Positional...)
+		vm.sp = vm.sp - numArgs - 1
+
+		return vm.push(result)
+
+	default:
+		return newError("not a function %s", callee.Type())
+	}
+}
+
+// executeSpawn starts a task that calls the function on the stack
+// with its arguments on a vm of its own
+func (vm *VM) executeSpawn(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	if err := object.CheckSpawn(callee); err != nil {
+		return err
+	}
+	args := vm.arguments(numArgs)
+	vm.sp = vm.sp - numArgs - 1
+
+	task := vm.task.Spawn()
+	child := vm.spawn(task)
+	go func() {
+		task.Finish(child.callWith(callee, args))
+	}()
+	return vm.push(task)
+}
+
+// callAsync calls an async closure on a vm of its own until it awaits,
+// and returns the promise of its result
+func (vm *VM) callAsync(cl *object.Closure, args *object.Arguments) object.Object {
+	return vm.task.Async(func(task *object.Task) object.Object {
+		return vm.spawn(task).callWith(cl, args)
+	})
+}
+
+// callWith calls fn with args and returns its result
+func (vm *VM) callWith(fn object.Object, args *object.Arguments) object.Object {
+	closure, ok := fn.(*object.Closure)
+	if !ok {
+		return vm.Call(fn, args.Positional)
+	}
+	stopAt := vm.framesIndex
+	if err := vm.push(closure); err != nil {
+		return err
+	}
+	// The arguments are passed packed, like OpArguments does
+	if err := vm.push(args); err != nil {
+		return err
+	}
+	if err := vm.callClosure(closure, 1); err != nil {
+		return err
+	}
+	return vm.run(stopAt)
+}
+
+// executeTailCall calls a closure in place of the frame that returns its
+// result, so a function that calls itself in a return doesn't use more frames.
+// Other calls are made like OpCall, and the OpReturnValue after them returns
+func (vm *VM) executeTailCall(numArgs int) *object.Error {
+	callee, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok || callee.Fn.ThisParams != nil || callee.Fn.Async {
+		return vm.executeCall(numArgs)
+	}
+
+	// The closure and its arguments take the place of the frame on the stack
+	frame := vm.popFrame()
+	copy(vm.stack[frame.basePointer:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.sp = frame.basePointer + numArgs + 1
+
+	return vm.callClosure(callee, numArgs)
+}
+
+// arguments are the arguments of a call on the stack. Spread and named
+// arguments were packed into one Arguments by OpArguments
+func (vm *VM) arguments(numArgs int) *object.Arguments {
+	if numArgs == 1 {
+		if args, ok := vm.stack[vm.sp-1].(*object.Arguments); ok {
+			return args
+		}
+	}
+	positional := make([]object.Object, numArgs)
+	copy(positional, vm.stack[vm.sp-numArgs:vm.sp])
+	return &object.Arguments{Positional: positional}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	fn := cl.Fn
+	values, err := object.BindArguments(fn.Parameters, fn.Defaults, fn.Variadic, vm.arguments(numArgs))
+	if err != nil {
+		return err
+	}
+
+	basePointer := vm.sp - numArgs - 1
+	vm.sp = basePointer
+
+	env := object.NewEnclosedFrame(cl.Env, fn.Locals)
+	env.SetTask(vm.task)
+	for i, param := range fn.Parameters {
+		if values[i] != nil {
+			env.Declare(param, values[i])
+		}
+	}
+	for i, param := range fn.Parameters {
+		if values[i] == nil {
+			val, err := vm.runDefault(fn.DefaultFns[i], env)
+			if err != nil {
+				return err
+			}
+			env.Declare(param, val)
+		}
+	}
+
+	return vm.pushFrame(NewFrame(fn, env, basePointer))
+}
+
+// runDefault computes the default value of a parameter in the env of the call
+func (vm *VM) runDefault(fn *object.CompiledFunction, env *object.Environment) (object.Object, *object.Error) {
+	stopAt := vm.framesIndex
+	if err := vm.pushFrame(NewFrame(fn, env, vm.sp)); err != nil {
+		return nil, err
+	}
+	result := vm.run(stopAt)
+	if err, ok := result.(*object.Error); ok {
+		return nil, err
+	}
+	return result, nil
+}
+
+// loadClass pushes the class with the given name. A class that isn't
+// declared is loaded from its file, which runs in a frame of its own
+func (vm *VM) loadClass(env *object.Environment, depth, slot int, name string, resolved bool) *object.Error {
+	var class object.Object
+	var ok bool
+	if resolved {
+		class, ok = env.GetAt(depth, slot)
+	} else {
+		class, ok = env.Get(name)
+	}
+	if ok {
+		if err := checkClass(class, name); err != nil {
+			return err
+		}
+		return vm.push(class)
+	}
+
+	program, loadErr := loader.Class(name, env)
+	if loadErr != nil {
+		return loadErr
+	}
+
+	comp := compiler.NewWithState(vm.constants)
+	if err := comp.Compile(program); err != nil {
+		return newError("%s", err)
+	}
+	bytecode := comp.Bytecode()
+	vm.constants = bytecode.Constants
+
+	// The result of the file is the class
+	fn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	return vm.pushFrame(NewFrame(fn, env, vm.sp))
+}
+
+func checkClass(class object.Object, name string) *object.Error {
+	if _, ok := class.(*object.ClassInstance); !ok {
+		return newError("%s is not a class. got=%s", name, class.Type())
+	}
+	return nil
+}
+
+// executeNew replaces a class and the arguments with a new instance, and runs Init
+func (vm *VM) executeNew(numArgs int, name string) *object.Error {
+	basePointer := vm.sp - numArgs - 1
+	class := vm.stack[basePointer]
+	if err := checkClass(class, name); err != nil {
+		return err
+	}
+	instance := class.(*object.ClassInstance).Instantiate()
+
+	args := vm.arguments(numArgs)
+
+	initObject, ok := instance.Env.Get("Init")
+	if !ok {
+		if len(args.Positional)+len(args.Named) != 0 {
+			return newError("Number of arguments in %s should be 0. got %d", name, len(args.Positional)+len(args.Named))
+		}
+		vm.sp = basePointer
+		return vm.push(instance)
+	}
+
+	fn := initObject.(*object.Closure).Fn
+	values, err := object.BindArguments(fn.Parameters, fn.Defaults, false, args)
+	if err != nil {
+		return err
+	}
+	vm.sp = basePointer
+
+	env := object.NewEnclosedFrame(instance.Env, fn.Locals)
+	bindParam := func(i int, arg object.Object) {
+		if fn.ThisParams[i] {
+			instance.Env.Update(fn.Parameters[i].Value, arg)
+		} else {
+			env.Declare(fn.Parameters[i], arg)
+		}
+	}
+	for i := range fn.Parameters {
+		if values[i] != nil {
+			bindParam(i, values[i])
+		}
+	}
+	for i := range fn.Parameters {
+		if values[i] == nil {
+			val, err := vm.runDefault(fn.DefaultFns[i], env)
+			if err != nil {
+				return err
+			}
+			bindParam(i, val)
+		}
+	}
+
+	frame := NewFrame(fn, env, basePointer)
+	frame.instance = instance
+	return vm.pushFrame(frame)
+}
+
+// executeGetMethod replaces an instance with one of its public methods
+func (vm *VM) executeGetMethod(method, objectName string) *object.Error {
+	objObject := vm.pop()
+
+	if enumMethod, ok := object.EnumMethod(objObject, method); ok {
+		return vm.push(enumMethod)
+	}
+
+	obj, ok := objObject.(*object.ClassInstance)
+	if !ok {
+		return newError("%s is not an object. It's a %s", objectName, typeName(objObject))
+	}
+
+	functionObject, ok := obj.Env.Get(method)
+	if !ok {
+		return newError("%s is not a defined method", method)
+	}
+	function, ok := functionObject.(*object.Closure)
+	if !ok || function.Fn.ThisParams != nil {
+		return newError("%s is not a defined method", method)
+	}
+
+	if !function.Fn.IsPublic {
+		return newError("%s is not a public function in %s", method, objectName)
+	}
+
+	return vm.push(function)
+}
+
+// typeName is the Go type the evaluator would have for obj
+func typeName(obj object.Object) string {
+	if _, ok := obj.(*object.Closure); ok {
+		return fmt.Sprintf("%T", &object.Function{})
+	}
+	return fmt.Sprintf("%T", obj)
+}
+
+func identifierNotFound(name string, hasThisPrefix bool) object.Object {
+	if hasThisPrefix {
+		return newError("identifier not found: '%s'. Try to remove 'this.'", name)
+	}
+	if builtin, ok := object.GetBuiltin(name); ok {
+		return builtin
+	}
+	return newError("identifier not found: %s", name)
+}
+
+func notDefined(name string, hasThisPrefix bool) *object.Error {
+	if hasThisPrefix {
+		return newError("%s is not defined. Try to remove 'this.'", name)
+	}
+	return newError("%s is not defined", name)
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
@@ -0,0 +1,506 @@
+package vm
+
+import (
+	"Pron-Lang/compiler"
+	"Pron-Lang/evaluator"
+	"Pron-Lang/lexer"
+	"Pron-Lang/object"
+	"Pron-Lang/parser"
+	"Pron-Lang/resolver"
+	"testing"
+)
+
+func TestVM(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 + 2 * 3", 7},
+		{"10 / 3 + 10 % 3", 4},
+		{"1.5 + 1", "2.5"},
+		{`"a" + "b"`, "ab"},
+		{"!true", false},
+		{"if (1 > 2) { 10 } elif (1 == 1) { 20 } else { 30 }", 20},
+		{"if (false) { 10 }", nil},
+		{"var a = 1; a = a + 1; a++; a", 3},
+		{"var f = func(x) { return func(y) { x + y } }; f(1)(2)", 3},
+		{"func fib(n) { if (n < 2) { return n } return fib(n - 1) + fib(n - 2) } fib(15)", 610},
+		{"var sum = 0; for (i from 5 to 0) { sum = sum + i }; sum", 15},
+		{"var arr = [1, 2, 3]; for (x in arr) { if (x == 2) { return x * 10 } }", 20},
+		{"func f() { for (i from 0 to 3) { return i } return 99 } f()", 99},
+		{"var h = {1: 2, \"a\": 3}; h[1] + h[\"a\"]", 5},
+		{"len([1, 2, 3])", 3},
+		{"[1, 2, 3][1]", 2},
+		{"var a = 1; a()", "ERROR: not a function INTEGER"},
+		{"1 + true", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{"var s = #{1, 2, 2}; len(s)", 2},
+		{"var s = #{1, 2}; if (2 in s) { 1 } else { 0 }", 1},
+		{"len(union(#{1, 2}, #{2, 3}))", 3},
+		{"#{{}}", "ERROR: unusable as hash key: HASH"},
+		{"var n = 5; for (i in n) { i }", "ERROR: 'in' expression in forloop was not array, hash or set. got=*object.Integer"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestClasses(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`class P { var n = 0; Init(this.n) {} func Get() { return n } }
+		var p = new P(5); var q = new P(7); p.Get() + q.Get()`, 12},
+		{`class C { var c = 0; func Inc() { this.c = c + 1; return c } }
+		var c = new C(); c.Inc(); c.Inc()`, 2},
+		{`class C { func hidden() { 1 } func Call() { hidden() } }
+		var c = new C(); c.hidden()`, "ERROR: hidden is not a public function in c"},
+		{`class C { var x = 1 } var c = new C(1)`, "ERROR: Number of arguments in C should be 0. got 1"},
+		{`var c = 1; c.Do()`, "ERROR: c is not an object. It's a *object.Integer"},
+		{`var c = func() {}; c.Do()`, "ERROR: c is not an object. It's a *object.Function"},
+		{`class P { var n = 0; Init(this.n) {} func Get() { return n } func Equals(o) { return n % 10 == o.Get() % 10 } }
+		var p = new P(5); var q = new P(15); if (p == q) { p.Get() + q.Get() } else { 0 }`, 20},
+		{`class P { func Equals(o) { return 1 + true } } new P() == new P()`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		promoted string
+		err      string
+	}{
+		{"var max = 9223372036854775807; max + 1", "9223372036854775808", "integer overflow: 9223372036854775807 + 1"},
+		{"var a = 4294967296; a * a", "18446744073709551616", "integer overflow: 4294967296 * 4294967296"},
+		{"var min = -9223372036854775807 - 1; min - 1", "-9223372036854775809", "integer overflow: -9223372036854775808 - 1"},
+		{"var max = 9223372036854775807; max++; max", "9223372036854775808", "integer overflow: 9223372036854775807 + 1"},
+		{"100000000000000000000 / 3", "33333333333333333333", "integer overflow: 100000000000000000000 doesn't fit in 64 bits"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.promoted, result)
+
+		env := object.NewEnvironment()
+		env.SetArithmetic(object.Arithmetic{Overflow: object.ErrorOnOverflow})
+		result = run(t, tt.input, env)
+		testExpectedObject(t, tt.input, "ERROR: "+tt.err, result)
+	}
+}
+
+func TestExactNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0.1d + 0.2d", "0.3"},
+		{"var price = 19.99d; price * 3", "59.97"},
+		{"1d / 3", "0.3333333333333333333333333333"},
+		{"rational(1, 3) + rational(1, 6)", "1/2"},
+		{"round(rational(2, 3), 2)", "0.67"},
+		{"1.5d / 0", "ERROR: division by zero"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+
+	env := object.NewEnvironment()
+	env.SetArithmetic(object.Arithmetic{Precision: 3, Rounding: object.RoundDown})
+	result := run(t, "2d / 3", env)
+	testExpectedObject(t, "2d / 3", "0.666", result)
+}
+
+func TestBitwiseAndPowerOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"6 & 3 | 8 ^ 1", 11},
+		{"var a = 5; ~a << 2 >> 1", -12},
+		{"var a = 2; a ** 3 ** 2", 512},
+		{"var a = 2; a ** 64", "18446744073709551616"},
+		{"var a = -7; a // 2", -4},
+		{"var a = 2.0; a ** -1", 0.5},
+		{"var a = 1; a << -1", "ERROR: negative shift count: -1"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestCollectionOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`var a = [1, 2]; a + [3]`, "[1, 2, 3]"},
+		{`var m = {"a": 1}; m + {"b": 2}`, "{a: 1, b: 2}"},
+		{`var s = "ab"; s * 2`, "abab"},
+		{`var z = [0]; z * 3`, "[0, 0, 0]"},
+		{`var a = [1, 2]; 2 in a`, true},
+		{`var s = "hello"; "ell" in s`, true},
+		{`var a = [1, 2]; a < [1, 3]`, true},
+		{`var s = "b"; s > "a"`, true},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestConditionalAndNullSafeOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`var n = -3; n > 0 ? "pos" : n < 0 ? "neg" : "zero"`, "neg"},
+		{`var x; x ?? 5`, 5},
+		{`var a = [1]; a[3] ?? 0`, 0},
+		{`var x = 1; x ?? 1 + true`, 1},
+		{`var x; x?[1 + true]`, nil},
+		{`var a = [1, 2]; a?[1]`, 2},
+		{`class C { func Get() { return 7 } } var c = new C(); c?.Get()`, 7},
+		{`var c; c?.Get(1 + true) ?? "none"`, "none"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestArrowFunctionsAndComposition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`var double = x => x * 2; double(4)`, 8},
+		{`var add = (a, b) => a + b; add(1, 2)`, 3},
+		{`var adder = x => y => x + y; var add2 = adder(2); add2(3)`, 5},
+		{`var double = x => x * 2; 3 + 1 |> double`, 8},
+		{`func twice(x, f) { return f(f(x)) } 1 |> twice(x => x + 10)`, 21},
+		{`compose(x => x * 2, x => x + 1)(5)`, 12},
+		{`partial((a, b) => a - b, 10)(3)`, 7},
+		{`compose(1)`, "ERROR: argument to `compose` must be FUNCTION, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestConstAndFreeze(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`const MAX = 10; MAX * 2`, 20},
+		{`const MAX = 10; MAX = 11`, "ERROR: cannot assign to constant MAX"},
+		{`const MAX = 10; MAX++`, "ERROR: cannot assign to constant MAX"},
+		{`const MAX = 10; func f() { MAX = 1 } f()`, "ERROR: cannot assign to constant MAX"},
+		{`class A { const b = 1; func F() { b = 2 } } var a = new A(); a.F()`, "ERROR: cannot assign to constant b"},
+		{`class A { var b = 1; func F() { b = 2; return b } } var a = new A(); a.F()`, 2},
+		{`class A { var b = 1; func F() { b = 2 } } var a = freeze(new A()); a.F()`, "ERROR: cannot assign to b of a frozen object"},
+		{`class A { var b = 1; func F() { this.b = 2 } } var a = new A(); freeze([a]); a.F()`, "ERROR: cannot assign to b of a frozen object"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestEnums(t *testing.T) {
+	enum := "enum Status { Pending, Running, Done }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`Status.Done == Status.Done`, true},
+		{`Status.Done == Status.Running`, false},
+		{`var s = Status.Running; s.Ordinal()`, 1},
+		{`var s = Status.FromName("Done"); s.Ordinal()`, 2},
+		{`var names = {Status.Pending: 10, Status.Done: 20}; names[Status.Done]`, 20},
+		{`match (Status.Running) { Status.Pending => 1, Status.Running => 2, _ => 3 }`, 2},
+		{`var total = 0; for (s in Status) { total = total + s.Ordinal() } total`, 3},
+		{`[s.Ordinal() for s in Status]`, []int{0, 1, 2}},
+		{`func f() { return Status.Done } var d = f(); d.Ordinal()`, 2},
+		{`Status.Unknown`, "ERROR: Status has no member called Unknown"},
+		{`Status.FromOrdinal(3)`, "ERROR: Status has no member with ordinal 3"},
+		{`Status.Next()`, "ERROR: Next is not a defined method"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, enum+tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`var nums = [1, 2, 3, 4]; [x * x for x in nums if x % 2 == 0]`, []int{4, 16}},
+		{`[i * x for i, x in [5, 6, 7]]`, []int{0, 6, 14}},
+		{`[a + b for [a, b] in [[1, 2], [3, 4]]]`, []int{3, 7}},
+		{`var m = {k: v * 2 for k, v in {"a": 1, "b": 2}}; m["b"]`, 4},
+		{`var x = 10; var ys = [x for x in [1, 2]]; x`, 10},
+		{`func f(xs) { var n = 3; return [x * n for x in xs] } f([1, 2])`, []int{3, 6}},
+		{`[x for x in 5]`, "ERROR: 'in' expression in comprehension was not array, hash or set. got=INTEGER"},
+		{`[x for k, x in 5]`, "ERROR: a comprehension with two variables needs an array or a hash. got=INTEGER"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestBlockScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`var a = 1; if (true) { var a = 2 } a`, 1},
+		{`func f() { var a = 1; if (true) { var a = 2; return a } } f()`, 2},
+		{`var fs = []; for (i from 0 to 3) { fs = fs + [func() { return i }] }; [f() for f in fs]`, []int{0, 1, 2}},
+		{`var fs = []; var xs = [4, 5]; for (x in xs) { var y = x * 2; fs = fs + [func() { return y }] }; [f() for f in fs]`, []int{8, 10}},
+		{`var fs = [func() { return x } for x in [1, 2]]; [f() for f in fs]`, []int{1, 2}},
+		{`var n = 1; match (5) { n => n } n`, 1},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`func count(n, acc) { if (n == 0) { return acc } return count(n - 1, acc + 1) } count(100000, 0)`, 100000},
+		{`func even(n) { if (n == 0) { return true } return odd(n - 1) } func odd(n) { if (n == 0) { return false } return even(n - 1) } even(100001)`, false},
+		{`func f(n) { return len([n]) } f(1)`, 1},
+		{`func f(n) { for (i from 0 to 2) { return g(i) } return 9 } func g(i) { return i } f(5)`, 9},
+		{`var f = func(n) { return [n, n] }; func g() { return f(2) } g()`, []int{2, 2}},
+		{`func sum(n) { if (n == 0) { return 0 } return n + sum(n - 1) } sum(100000)`, "ERROR: maximum recursion depth of 10000 exceeded"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`func square(x) { return x * x } wait(spawn square(7))`, 49},
+		{`func square(x) { return x * x } wait([spawn square(1), spawn square(2), spawn len("abc")])`, "[1, 4, 3]"},
+		{`var c = channel(); func produce(n) { for (i from 0 to n) { send(c, i) } close(c) } spawn produce(2); [receive(c), receive(c), receive(c)]`, "[0, 1, null]"},
+		{`var a = channel(); var b = channel(1); send(b, 5); select([a, b])`, "[1, 5]"},
+		{`var total = 0; func add(n) { total = total + n } wait([spawn add(1), spawn add(2)])`, "ERROR: data race on total: tasks that don't wait for each other assign it"},
+		{`var total = 0; func add(n) { total++ } wait([spawn add(1), spawn add(2)])`, "ERROR: data race on total: tasks that don't wait for each other assign it"},
+		{`var total = 0; func add(n) { total = total + n } wait(spawn add(1)); wait(spawn add(2)); total = total + 10; total`, 13},
+		{`var total = 0; var done = channel(); func add(n) { total = total + n; send(done, true) } spawn add(1); receive(done); spawn add(2); receive(done); total`, 3},
+		{`var c = channel(); close(c); send(c, 1)`, "ERROR: send on closed channel"},
+		{`var x = 1; spawn x()`, "ERROR: not a function INTEGER"},
+		{`var ping = channel(); var pong = channel(); func serve(n) { for (i from 0 to n) { send(ping, i); receive(pong) } } spawn serve(100); var sum = 0; for (i from 0 to 100) { sum = sum + receive(ping); send(pong, 0) } sum`, 4950},
+		{`receive(channel())`, "ERROR: deadlock: every task is waiting for another"},
+		{`var a = channel(); var b = channel(); func relay() { send(b, receive(a)) } spawn relay(); receive(b)`, "ERROR: deadlock: every task is waiting for another"},
+		{`var c = channel(); func f() { return receive(c) } await spawn f()`, "ERROR: deadlock: every task is waiting for another"},
+		{`async func f() { return receive(channel()) } await f()`, "ERROR: deadlock: every task is waiting for another"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestEventLoop(t *testing.T) {
+	notes := `var log = []; func note(x) { log = log + [x] } `
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{notes + `setTimeout(note, 30, "c"); setTimeout(note, 10, "a"); setTimeout(note, 10, "b"); await sleep(100); log`, "[a, b, c]"},
+		{`var n = 0; var id = 0; id = setInterval(func() { n++; if (n == 3) { clearInterval(id) } }, 10); await sleep(100); [n, now()]`, "[3, 100]"},
+		{`var x = 0; setTimeout(func() { x = 1 }, 5); 7`, 7},
+		{notes + `async func f() { note(1); await g(); note(3) } async func g() { return 0 } f(); note(2); await sleep(0); log`, "[1, 2, 3]"},
+		{`async func fetch(x, ms) { await sleep(ms); return [x, now()] } var a = fetch("a", 30); var b = fetch("b", 10); [await a, await b]`, "[[a, 30], [b, 10]]"},
+		{`async func count(n) { if (n == 0) { return "done" } await sleep(1); return count(n - 1) } await count(3)`, "done"},
+		{`func square(x) { return x * x } await spawn square(4)`, 16},
+		{`async func fail() { await sleep(1); return 1 / 0 } async func f() { var x = await fail(); return x + 1 } await f()`, "ERROR: division by zero"},
+		{`async func fail() { return 1 / 0 } fail(); 1`, "ERROR: division by zero"},
+		{`setTimeout(func() { return 1 / 0 }, 5); 1`, "ERROR: division by zero"},
+		{`var a = 0; async func f() { await sleep(1); return await a } a = f(); await a`, "ERROR: await never ends: nothing is left that could settle the promise"},
+		{`var n = 0; var ch = channel(1); async func a() { await sleep(1); n++ } func s() { send(ch, a()); n++ } var t = spawn s(); await receive(ch); wait(t); n`, "ERROR: data race on n: tasks that don't wait for each other assign it"},
+		{`var n = 0; async func a() { await sleep(1); n++ } func s() { var p = a(); n++; return p } await wait(spawn s()); n`, 2},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.SetClock(object.NewManualClock())
+		result := run(t, tt.input, env)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestMacros(t *testing.T) {
+	unless := `var unless = macro(cond, then, otherwise) { quote(if (!(unquote(cond))) { unquote(then) } else { unquote(otherwise) }) } `
+	square := `var square = macro(x) { quote(unquote(x) * unquote(x)) } `
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{unless + `unless(10 > 5, "not greater", "greater")`, "greater"},
+		{unless + `var calls = []; func f(x) { calls = calls + [x]; return x } unless(false, f(1), f(2)); calls`, "[1]"},
+		{square + `func f(x) { return square(x + 1) } f(4)`, 25},
+		{`var six = macro() { quote(unquote(1 + 2) * 2) } six()`, 6},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`func f(a, b = a * 2) { return a + b } f(1)`, 3},
+		{`func f(a, b = a * 2) { return a + b } f(1, 5)`, 6},
+		{`func f(host, port = 80) { return port } f(port: 8080, host: "x")`, 8080},
+		{`func sum(...nums) { var total = 0; for (n in nums) { total = total + n } return total } sum(1, ...[2, 3], 4)`, 10},
+		{`len(...["abc"])`, 3},
+		{`class A { var a = 0; var b = 0; Init(this.a, this.b = a + 1) {} func B() { return b } } var x = new A(b: 5, a: 1); x.B()`, 5},
+		{`class A { var a = 0; var b = 0; Init(this.a, this.b = a + 1) {} func B() { return b } } var x = new A(1); x.B()`, 2},
+		{`func f(a, b) { a } f(1)`, "ERROR: wrong number of arguments. got=1, want=2"},
+		{`func f(a, b) { a } f(1, 2, 3)`, "ERROR: wrong number of arguments. got=3, want=2"},
+		{`func f(a) { a } f(b: 1)`, "ERROR: unknown argument b"},
+		{`len(x: [])`, "ERROR: builtin functions take no named arguments"},
+		{`class A { Init(a) {} } new A()`, "ERROR: wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`var [q, r] = [3, 1]; q * 10 + r`, 31},
+		{`var {"name": n} = {"name": "Ann"}; n`, "Ann"},
+		{`var [head, ...tail] = [1, 2, 3]; len(tail) + head`, 3},
+		{`func sum([a, b], {"k": c}) { return a + b + c } sum([1, 2], {"k": 3})`, 6},
+		{`var total = 0; var pairs = [[1, 2], [3, 4]]; for ([a, b] in pairs) { total = total + a * b } total`, 14},
+		{`var [a, b] = [1]`, "ERROR: cannot destructure [1] with [a, b]"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match (2) { 1, 2 => "small", _ => "other" }`, "small"},
+		{`match ([3, 4]) { [a, b] => a + b }`, 7},
+		{`match ({"type": "cat"}) { {"type": t} => t }`, "cat"},
+		{`match (500) { int n if n > 100 => "big", _ => "other" }`, "big"},
+		{`match (3) { n if n > 5 => "gt", n => { var d = n * 2; d } }`, 6},
+		{`func f() { match (1) { 1 => { return "early" } } return "late" } f()`, "early"},
+		{`match (7) { 1 => 1 }`, "ERROR: no pattern matched 7"},
+	}
+
+	for _, tt := range tests {
+		result := run(t, tt.input)
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func TestEnvironmentIsShared(t *testing.T) {
+	env := object.NewEnvironment()
+
+	run(t, "var a = 5", env)
+	result := run(t, "a * 2", env)
+
+	testExpectedObject(t, "a * 2", 10, result)
+}
+
+func run(t *testing.T, input string, envs ...*object.Environment) object.Object {
+	env := object.NewEnvironment()
+	if len(envs) > 0 {
+		env = envs[0]
+	}
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if errors := evaluator.ExpandMacros(program, object.NewEnvironment()); len(errors) != 0 {
+		t.Fatalf("macro errors for %q: %v", input, errors)
+	}
+	if errors := resolver.Resolve(program, env); len(errors) != 0 {
+		t.Fatalf("resolver has errors for %q: %v", input, errors)
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return New(comp.Bytecode(), env).Run()
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := actual.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("wrong result for %q. expected=%d, got=%v", input, expected, actual)
+		}
+	case bool:
+		boolean, ok := actual.(*object.Boolean)
+		if !ok || boolean.Value != expected {
+			t.Errorf("wrong result for %q. expected=%t, got=%v", input, expected, actual)
+		}
+	case string:
+		if actual == nil || actual.Inspect() != expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%v", input, expected, actual)
+		}
+	case nil:
+		if actual != object.NULL {
+			t.Errorf("wrong result for %q. expected=null, got=%v", input, actual)
+		}
+	}
+}